@@ -3,7 +3,11 @@ module github.com/Sn0w1eo/crypto-fetcher
 go 1.15
 
 require (
+	github.com/fergusstrange/embedded-postgres v1.19.0
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/gorilla/websocket v1.4.2
+	github.com/lib/pq v1.10.4
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/stretchr/testify v1.7.0
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
@@ -1,9 +1,99 @@
 package main
 
-func init() {
+import (
+	"flag"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/exchanges/all"
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/storage/all"
+	"os"
+	"strings"
+)
 
+// Version of binary, set on build by -ldflags "-X main.version=..."
+var version = "dev"
+
+// Prefix of environment variables which are used as flag defaults
+const envPrefix = "CF_"
+
+// command is a subcommand of binary
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
 }
 
-func main() {
+var commands = []command{
+	{"fetch", "streams ticks from exchange into storage until SIGINT/SIGTERM", runFetch},
+	{"run", "runs exchanges and storages described by config, SIGHUP reloads pairs", runConfig},
+	{"backfill", "writes historical candles of pair into storage", runBackfill},
+	{"migrate", "migrates schema of MySQL storage up or down", runMigrate},
+	{"pairs", "lists pairs available on exchange", runPairs},
+	{"exchanges", "lists registered exchanges with protocols and channels", runExchanges},
+	{"version", "prints version", runVersion},
+}
+
+// Returns environment variable by flag name (e.g. CF_DSN for dsn) or def if it isn't set
+func env(name string, def string) string {
+	if v, ok := os.LookupEnv(envPrefix + strings.ToUpper(name)); ok {
+		return v
+	}
+	return def
+}
+
+// Defines string flag with default value taken from environment
+func envString(fs *flag.FlagSet, name string, def string, usage string) *string {
+	return fs.String(name, env(name, def), fmt.Sprintf("%s (env %s%s)", usage, envPrefix, strings.ToUpper(name)))
+}
 
+// Parses comma separated pairs, e.g. "btc-usd,eth-btc"
+func parsePairs(s string) ([]crypto.Pair, error) {
+	var pairs []crypto.Pair
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		pair, err := crypto.ParsePair(p)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("at least one pair should be set")
+	}
+	return pairs, nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for flags of command\n", os.Args[0])
+}
+
+func runVersion(args []string) error {
+	fmt.Println(version)
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	usage()
+	os.Exit(2)
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges"
+	"strings"
+)
+
+func runPairs(args []string) error {
+	fs := flag.NewFlagSet("pairs", flag.ExitOnError)
+	exchangeName := envString(fs, "exchange", "coinbase", "exchange name")
+	_ = fs.Parse(args)
+
+	cbr, err := restClient(*exchangeName, "pairs")
+	if err != nil {
+		return err
+	}
+	pairs, err := cbr.Products()
+	if err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		fmt.Println(pair.String(crypto.PairDefaultDelimiter))
+	}
+	return nil
+}
+
+// Prints registered exchanges with their protocols and channels
+func runExchanges(args []string) error {
+	fs := flag.NewFlagSet("exchanges", flag.ExitOnError)
+	_ = fs.Parse(args)
+
+	for _, info := range exchanges.List() {
+		for _, s := range info.Protocols {
+			channels := make([]string, len(s.Channels))
+			for i, ch := range s.Channels {
+				channels[i] = string(ch)
+			}
+			fmt.Printf("%-10s %-5s %s\n", info.Name, s.Protocol, strings.Join(channels, ","))
+		}
+	}
+	return nil
+}
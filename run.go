@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/config"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func runConfig(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	path := envString(fs, "config", "crypto-fetcher.yaml", "path to YAML config")
+	_ = fs.Parse(args)
+
+	cfg, err := config.Load(*path)
+	if err != nil {
+		return err
+	}
+	top, err := config.Build(cfg, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if err = top.Run(); err != nil {
+		_ = top.Stop(err)
+		return err
+	}
+
+	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			return top.Stop(fmt.Sprintf("signal received: %s", sig))
+		}
+		next, err := config.Load(*path)
+		if err == nil {
+			err = top.Reload(next)
+		}
+		if err != nil {
+			logger.Println("reload failed:", err)
+		}
+	}
+	return nil
+}
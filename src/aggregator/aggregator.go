@@ -0,0 +1,241 @@
+package aggregator
+
+import (
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"sort"
+	"time"
+)
+
+// Default period of closing candles by wall clock when pair has no new ticks
+const DefaultFlushPeriod = time.Second
+
+// Used to get mid price of tick
+var half = crypto.MustDecimal("0.5")
+
+// CandleWriter is a destination of closed candles, e.g. storage.Storage
+type CandleWriter interface {
+	WriteCandle(candle crypto.Candle) error
+}
+
+// key of open candles
+type key struct {
+	pair     string
+	interval time.Duration
+}
+
+// bucket is an open candle with time of first and last price
+// first and last are used to keep Open and Close right on out-of-order prices
+type bucket struct {
+	candle crypto.Candle
+	first  time.Time
+	last   time.Time
+}
+
+// Aggregator builds OHLCV candles out of ticks or trades
+// Tick's price is mid price between bid and ask, tick has no volume
+// Trade's price is trade price, trade's size is added to volume
+// Ticks and trades of the same pair shouldn't be mixed
+// Candle is closed when time of pair passes candle end plus grace window
+// Time of pair is time of its prices, it's moved by wall clock time elapsed since its last price
+// so candles of idle pairs are closed too. Prices older than grace window are dropped
+type Aggregator struct {
+	intervals   []time.Duration
+	grace       time.Duration
+	flushPeriod time.Duration
+
+	open map[key]map[time.Time]*bucket
+	// latest price time seen by pair
+	watermark map[string]time.Time
+	// wall clock time of pair's latest watermark
+	seen map[string]time.Time
+	// time till which candles of pair have been closed by wall clock
+	closed  map[string]time.Time
+	dropped int
+
+	out chan crypto.Candle
+	now func() time.Time
+}
+
+// Creates new Aggregator for intervals
+// Returns error if intervals aren't set or some of them isn't positive
+func New(grace time.Duration, intervals ...time.Duration) (*Aggregator, error) {
+	if len(intervals) == 0 {
+		return nil, fmt.Errorf("at least one interval should be set")
+	}
+	for _, interval := range intervals {
+		if interval <= 0 {
+			return nil, fmt.Errorf("interval should be positive: %s", interval)
+		}
+	}
+	if grace < 0 {
+		return nil, fmt.Errorf("grace window should not be negative: %s", grace)
+	}
+	a := &Aggregator{
+		intervals:   make([]time.Duration, len(intervals)),
+		grace:       grace,
+		flushPeriod: DefaultFlushPeriod,
+		open:        map[key]map[time.Time]*bucket{},
+		watermark:   map[string]time.Time{},
+		seen:        map[string]time.Time{},
+		closed:      map[string]time.Time{},
+		out:         make(chan crypto.Candle, 16),
+		now:         time.Now,
+	}
+	copy(a.intervals, intervals)
+	return a, nil
+}
+
+// Returns chan of closed candles
+// Chan will be closed after Run returns
+func (a *Aggregator) Candles() <-chan crypto.Candle {
+	return a.out
+}
+
+// Returns count of prices dropped because they were older than grace window
+// Important: safe to call after Run returned only
+func (a *Aggregator) Dropped() int {
+	return a.dropped
+}
+
+// Run reads ticks and trades until both chans are closed. Nil chan is treated as closed
+// Candles are closed on new prices and on wall clock every flush period
+// Left open candles are emitted and Candles() chan is closed on return
+func (a *Aggregator) Run(ticks <-chan crypto.Tick, trades <-chan crypto.Trade) {
+	flush := time.NewTicker(a.flushPeriod)
+	defer flush.Stop()
+
+	for ticks != nil || trades != nil {
+		select {
+		case tick, ok := <-ticks:
+			if !ok {
+				ticks = nil
+				continue
+			}
+			a.addTick(tick)
+		case trade, ok := <-trades:
+			if !ok {
+				trades = nil
+				continue
+			}
+			a.addTrade(trade)
+		case <-flush.C:
+			a.advance(a.now())
+		}
+	}
+	a.flush(time.Time{}, "")
+	close(a.out)
+}
+
+// Writes closed candles to w until Candles() chan is closed
+// Returns first write error, rest of candles are drained to not block Run
+func (a *Aggregator) WriteTo(w CandleWriter) (err error) {
+	for candle := range a.out {
+		if err != nil {
+			continue
+		}
+		err = w.WriteCandle(candle)
+	}
+	return err
+}
+
+// Adds mid price of tick
+func (a *Aggregator) addTick(tick crypto.Tick) {
+	a.add(tick.P, tick.T, tick.Bid.Add(tick.Ask).Mul(half), crypto.Decimal{})
+}
+
+// Adds price and size of trade
+func (a *Aggregator) addTrade(trade crypto.Trade) {
+	a.add(trade.P, trade.T, trade.Price, trade.Size)
+}
+
+// Adds price to candle of every interval and closes candles which are out of grace window
+func (a *Aggregator) add(pair crypto.Pair, t time.Time, price crypto.Decimal, size crypto.Decimal) {
+	name := pair.String()
+	watermark := a.watermark[name]
+	if t.Add(a.grace).Before(watermark) || t.Before(a.closed[name]) {
+		a.dropped++
+		return
+	}
+	for _, interval := range a.intervals {
+		k := key{pair: name, interval: interval}
+		if a.open[k] == nil {
+			a.open[k] = map[time.Time]*bucket{}
+		}
+		start := t.Truncate(interval)
+		b, ok := a.open[k][start]
+		if !ok {
+			b = &bucket{
+				candle: crypto.Candle{T: start, P: pair, Interval: interval, Open: price, High: price, Low: price, Close: price},
+				first:  t,
+				last:   t,
+			}
+			a.open[k][start] = b
+		}
+		b.update(t, price, size)
+	}
+	if t.After(watermark) {
+		a.watermark[name] = t
+		a.seen[name] = a.now()
+		a.flush(t.Add(-a.grace), name)
+	}
+}
+
+// Moves time of every pair by wall clock time elapsed since its latest price and closes candles
+// which are out of grace window. Used to close candles of pairs without new prices
+// Watermark stays in time of prices, so feeds lagging behind wall clock and replayed prices aren't dropped
+func (a *Aggregator) advance(now time.Time) {
+	for name, watermark := range a.watermark {
+		elapsed := now.Sub(a.seen[name])
+		if elapsed <= 0 {
+			continue
+		}
+		till := watermark.Add(elapsed - a.grace)
+		if till.After(a.closed[name]) {
+			a.closed[name] = till
+			a.flush(till, name)
+		}
+	}
+}
+
+// Updates candle by price at time t
+func (b *bucket) update(t time.Time, price crypto.Decimal, size crypto.Decimal) {
+	if price.Cmp(b.candle.High) > 0 {
+		b.candle.High = price
+	}
+	if price.Cmp(b.candle.Low) < 0 {
+		b.candle.Low = price
+	}
+	if t.Before(b.first) {
+		b.first = t
+		b.candle.Open = price
+	}
+	if !t.Before(b.last) {
+		b.last = t
+		b.candle.Close = price
+	}
+	b.candle.Volume = b.candle.Volume.Add(size)
+}
+
+// Emits candles which end not after till ordered by time. Zero till closes all candles
+// Empty pair means all pairs
+func (a *Aggregator) flush(till time.Time, pair string) {
+	for k, buckets := range a.open {
+		if pair != "" && k.pair != pair {
+			continue
+		}
+		var closed []crypto.Candle
+		for start, b := range buckets {
+			if till.IsZero() || !b.candle.End().After(till) {
+				closed = append(closed, b.candle)
+				delete(buckets, start)
+			}
+		}
+		sort.Slice(closed, func(i, j int) bool {
+			return closed[i].T.Before(closed[j].T)
+		})
+		for _, candle := range closed {
+			a.out <- candle
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package aggregator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Collects written candles, fails on first write if err is set
+type fCandleWriter struct {
+	candles []crypto.Candle
+	err     error
+}
+
+func (w *fCandleWriter) WriteCandle(candle crypto.Candle) error {
+	w.candles = append(w.candles, candle)
+	return w.err
+}
+
+// Returns decimal as string without trailing zeros
+func norm(d crypto.Decimal) string {
+	s := d.String()
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// Returns candle as string, decimals are compared regardless of scale
+func candle(t time.Time, p crypto.Pair, interval time.Duration, open, high, low, close, volume string) string {
+	return fmt.Sprintf("%s %s %s O:%s H:%s L:%s C:%s V:%s", t.UTC(), p.String(), interval, open, high, low, close, volume)
+}
+
+// Returns candles as strings
+func candleStrings(candles []crypto.Candle) []string {
+	s := make([]string, 0, len(candles))
+	for _, c := range candles {
+		s = append(s, candle(c.T, c.P, c.Interval, norm(c.Open), norm(c.High), norm(c.Low), norm(c.Close), norm(c.Volume)))
+	}
+	return s
+}
+
+// Reads all candles which are ready without blocking
+func readCandles(a *Aggregator) (candles []crypto.Candle) {
+	for len(a.out) > 0 {
+		candles = append(candles, <-a.out)
+	}
+	return candles
+}
+
+func TestNew(t *testing.T) {
+	cases := []struct {
+		grace     time.Duration
+		intervals []time.Duration
+		hasError  bool
+	}{
+		{0, []time.Duration{time.Minute}, false},
+		{time.Second, []time.Duration{time.Minute, time.Hour}, false},
+		{0, nil, true},
+		{0, []time.Duration{0}, true},
+		{-time.Second, []time.Duration{time.Minute}, true},
+	}
+	for _, testCase := range cases {
+		a, err := New(testCase.grace, testCase.intervals...)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.intervals, a.intervals)
+	}
+}
+
+func TestAggregator_addTrade(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	base := time.Unix(600, 0).UTC()
+
+	t.Run("builds candles aligned by interval", func(t *testing.T) {
+		a, _ := New(0, time.Minute, 5*time.Minute)
+		a.addTrade(crypto.Trade{T: base.Add(10 * time.Second), P: btc_usd, Price: crypto.MustDecimal("10"), Size: crypto.MustDecimal("1")})
+		a.addTrade(crypto.Trade{T: base.Add(20 * time.Second), P: btc_usd, Price: crypto.MustDecimal("12"), Size: crypto.MustDecimal("2")})
+		a.addTrade(crypto.Trade{T: base.Add(30 * time.Second), P: btc_usd, Price: crypto.MustDecimal("8"), Size: crypto.MustDecimal("1")})
+		a.addTrade(crypto.Trade{T: base.Add(40 * time.Second), P: btc_usd, Price: crypto.MustDecimal("9"), Size: crypto.MustDecimal("1")})
+		assert.Empty(t, readCandles(a))
+
+		a.addTrade(crypto.Trade{T: base.Add(61 * time.Second), P: btc_usd, Price: crypto.MustDecimal("11"), Size: crypto.MustDecimal("1")})
+		assert.Equal(t, []string{
+			candle(base, btc_usd, time.Minute, "10", "12", "8", "9", "5"),
+		}, candleStrings(readCandles(a)))
+
+		a.flush(time.Time{}, "")
+		candles := readCandles(a)
+		assert.Len(t, candles, 2)
+		assert.Contains(t, candleStrings(candles), candle(base.Add(time.Minute), btc_usd, time.Minute, "11", "11", "11", "11", "1"))
+		assert.Contains(t, candleStrings(candles), candle(base, btc_usd, 5*time.Minute, "10", "12", "8", "11", "6"))
+	})
+
+	t.Run("out-of-order trades within grace window update candle", func(t *testing.T) {
+		a, _ := New(50*time.Second, time.Minute)
+		a.addTrade(crypto.Trade{T: base.Add(30 * time.Second), P: btc_usd, Price: crypto.MustDecimal("10"), Size: crypto.MustDecimal("1")})
+		a.addTrade(crypto.Trade{T: base.Add(65 * time.Second), P: btc_usd, Price: crypto.MustDecimal("20"), Size: crypto.MustDecimal("1")})
+		a.addTrade(crypto.Trade{T: base.Add(20 * time.Second), P: btc_usd, Price: crypto.MustDecimal("5"), Size: crypto.MustDecimal("1")})
+		a.addTrade(crypto.Trade{T: base.Add(59 * time.Second), P: btc_usd, Price: crypto.MustDecimal("7"), Size: crypto.MustDecimal("1")})
+		assert.Empty(t, readCandles(a))
+
+		a.addTrade(crypto.Trade{T: base.Add(111 * time.Second), P: btc_usd, Price: crypto.MustDecimal("20"), Size: crypto.MustDecimal("1")})
+		assert.Equal(t, []string{
+			candle(base, btc_usd, time.Minute, "5", "10", "5", "7", "3"),
+		}, candleStrings(readCandles(a)))
+
+		a.addTrade(crypto.Trade{T: base.Add(50 * time.Second), P: btc_usd, Price: crypto.MustDecimal("1"), Size: crypto.MustDecimal("1")})
+		assert.Equal(t, 1, a.Dropped())
+	})
+}
+
+func TestAggregator_addTick(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	eth_usd, _ := crypto.NewPair("eth", "usd")
+	base := time.Unix(600, 0).UTC()
+
+	a, _ := New(0, time.Minute)
+	a.addTick(crypto.Tick{T: base, P: btc_usd, Bid: crypto.MustDecimal("9"), Ask: crypto.MustDecimal("11")})
+	a.addTick(crypto.Tick{T: base, P: eth_usd, Bid: crypto.MustDecimal("1"), Ask: crypto.MustDecimal("3")})
+	a.addTick(crypto.Tick{T: base.Add(time.Minute), P: btc_usd, Bid: crypto.MustDecimal("10"), Ask: crypto.MustDecimal("12")})
+	assert.Equal(t, []string{
+		candle(base, btc_usd, time.Minute, "10", "10", "10", "10", "0"),
+	}, candleStrings(readCandles(a)))
+}
+
+func TestAggregator_advance(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	base := time.Unix(600, 0).UTC()
+
+	t.Run("closes candles of idle pair by wall clock", func(t *testing.T) {
+		a, _ := New(5*time.Second, time.Minute)
+		clock := time.Now()
+		a.now = func() time.Time { return clock }
+		a.addTrade(crypto.Trade{T: base, P: btc_usd, Price: crypto.MustDecimal("10"), Size: crypto.MustDecimal("1")})
+		a.advance(clock.Add(time.Minute))
+		assert.Empty(t, readCandles(a))
+		a.advance(clock.Add(65 * time.Second))
+		assert.Len(t, readCandles(a), 1)
+
+		a.addTrade(crypto.Trade{T: base.Add(30 * time.Second), P: btc_usd, Price: crypto.MustDecimal("10"), Size: crypto.MustDecimal("1")})
+		assert.Equal(t, 1, a.Dropped())
+	})
+
+	t.Run("prices of lagging feed are kept", func(t *testing.T) {
+		a, _ := New(5*time.Second, time.Minute)
+		// feed lags wall clock by an hour
+		clock := base.Add(time.Hour)
+		a.now = func() time.Time { return clock }
+		for i := 0; i < 14; i++ {
+			a.addTrade(crypto.Trade{T: base.Add(time.Duration(i) * 5 * time.Second), P: btc_usd, Price: crypto.MustDecimal("10"), Size: crypto.MustDecimal("1")})
+			clock = clock.Add(time.Second)
+			a.advance(clock)
+			clock = clock.Add(4 * time.Second)
+		}
+		assert.Zero(t, a.Dropped())
+		assert.Equal(t, []string{
+			candle(base, btc_usd, time.Minute, "10", "10", "10", "10", "12"),
+		}, candleStrings(readCandles(a)))
+	})
+}
+
+func TestAggregator_Run(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	base := time.Unix(600, 0).UTC()
+
+	a, _ := New(0, time.Minute)
+	ticks := make(chan crypto.Tick)
+	trades := make(chan crypto.Trade)
+	go a.Run(ticks, trades)
+	ticks <- crypto.Tick{T: base, P: btc_usd, Bid: crypto.MustDecimal("1"), Ask: crypto.MustDecimal("1")}
+	trades <- crypto.Trade{T: base.Add(time.Second), P: btc_usd, Price: crypto.MustDecimal("2"), Size: crypto.MustDecimal("1")}
+	close(ticks)
+	close(trades)
+
+	w := &fCandleWriter{}
+	assert.NoError(t, a.WriteTo(w))
+	assert.Equal(t, []string{
+		candle(base, btc_usd, time.Minute, "1", "2", "1", "2", "1"),
+	}, candleStrings(w.candles))
+}
+
+func TestAggregator_WriteTo(t *testing.T) {
+	a, _ := New(0, time.Minute)
+	a.out <- crypto.Candle{}
+	a.out <- crypto.Candle{}
+	close(a.out)
+
+	w := &fCandleWriter{err: errors.New("write failed")}
+	assert.Error(t, a.WriteTo(w))
+	assert.Len(t, w.candles, 1)
+	assert.Empty(t, a.out)
+}
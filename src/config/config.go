@@ -0,0 +1,277 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/Sn0w1eo/crypto-fetcher/src/storage"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Channels which can be written to storage
+const (
+	ChannelTicker = "ticker"
+	ChannelTrades = "trades"
+)
+
+// Default protocol of exchange if it isn't set
+const defaultProtocol = "ws"
+
+// Config describes exchanges to fetch data from and storages to write data to
+type Config struct {
+	Exchanges []Exchange `yaml:"exchanges"`
+	Storages  []Storage  `yaml:"storages"`
+}
+
+// Exchange describes one Exchanger
+// Type is name of exchange registered in exchanges package, Protocol is name of exchanges.Protocol (ws by default)
+// Channels are ticker (default) and trades
+// Storages are names of storages to write to, all storages by default
+// RawPayload keeps messages of exchange in ticks, so storages persist them
+type Exchange struct {
+	Name       string     `yaml:"name"`
+	Type       string     `yaml:"type"`
+	Protocol   string     `yaml:"protocol"`
+	Pairs      []string   `yaml:"pairs"`
+	Channels   []string   `yaml:"channels"`
+	URL        string     `yaml:"url"`
+	Storages   []string   `yaml:"storages"`
+	Reconnect  *Reconnect `yaml:"reconnect"`
+	RawPayload bool       `yaml:"raw_payload"`
+}
+
+// Reconnect describes reconnect.Policy of Exchanger
+type Reconnect struct {
+	InitialDelay time.Duration `yaml:"initial_delay"`
+	MaxDelay     time.Duration `yaml:"max_delay"`
+	Jitter       float64       `yaml:"jitter"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+}
+
+// Storage describes one storage.Storage. Type is name of registered storage, it may be omitted if DSN has scheme,
+// e.g. postgres://host/db
+type Storage struct {
+	Name  string `yaml:"name"`
+	Type  string `yaml:"type"`
+	DSN   string `yaml:"dsn"`
+	Batch Batch  `yaml:"batch"`
+}
+
+// Batch describes batched writes of storage. Zero fields keep defaults of storage
+// Overflow is policy of full queue: block, drop_oldest or spill, spill needs SpillPath
+type Batch struct {
+	Size      int           `yaml:"size"`
+	Interval  time.Duration `yaml:"interval"`
+	Queue     int           `yaml:"queue"`
+	Overflow  string        `yaml:"overflow"`
+	SpillPath string        `yaml:"spill_path"`
+}
+
+// Returns reconnect.Policy described by Reconnect
+func (r Reconnect) Policy() reconnect.Policy {
+	return reconnect.Policy{
+		InitialDelay: r.InitialDelay,
+		MaxDelay:     r.MaxDelay,
+		Jitter:       r.Jitter,
+		MaxAttempts:  r.MaxAttempts,
+	}
+}
+
+// Returns parsed pairs of Exchange
+func (e Exchange) ParsedPairs() ([]crypto.Pair, error) {
+	pairs := make([]crypto.Pair, 0, len(e.Pairs))
+	for _, p := range e.Pairs {
+		pair, err := crypto.ParsePair(p)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+// Returns true if Exchange writes to storage with name
+func (e Exchange) WritesTo(name string) bool {
+	if len(e.Storages) == 0 {
+		return true
+	}
+	for _, s := range e.Storages {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Reads and validates Config out of YAML file
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+// Parses and validates Config out of YAML. Unknown fields are treated as errors
+func Parse(data []byte) (*Config, error) {
+	cfg := new(Config)
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return nil, err
+	}
+	cfg.setDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Sets default protocol and channels of exchanges
+func (c *Config) setDefaults() {
+	for i := range c.Exchanges {
+		if c.Exchanges[i].Protocol == "" {
+			c.Exchanges[i].Protocol = defaultProtocol
+		}
+		if len(c.Exchanges[i].Channels) == 0 {
+			c.Exchanges[i].Channels = []string{ChannelTicker}
+		}
+	}
+}
+
+// validationErrors collects validation errors with path of field
+type validationErrors []string
+
+func (errs *validationErrors) add(path string, format string, args ...interface{}) {
+	*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+}
+
+// Returns path of list item with its name if it's set, e.g. exchanges[0] (main)
+func itemPath(list string, i int, name string) string {
+	if name == "" {
+		return fmt.Sprintf("%s[%d]", list, i)
+	}
+	return fmt.Sprintf("%s[%d] (%s)", list, i, name)
+}
+
+// Returns error describing every invalid field of Config
+func (c *Config) Validate() error {
+	errs := validationErrors{}
+	if len(c.Exchanges) == 0 {
+		errs.add("exchanges", "at least one exchange should be set")
+	}
+	if len(c.Storages) == 0 {
+		errs.add("storages", "at least one storage should be set")
+	}
+
+	storages := map[string]bool{}
+	for i, s := range c.Storages {
+		path := itemPath("storages", i, s.Name)
+		if s.Name == "" {
+			errs.add(path, "name should be set")
+		} else if storages[s.Name] {
+			errs.add(path, "name is duplicated")
+		}
+		storages[s.Name] = true
+		storageType := storage.TypeOf(s.DSN, s.Type)
+		if scheme := storage.Scheme(s.DSN); s.Type != "" && scheme != "" && !strings.EqualFold(s.Type, scheme) {
+			errs.add(path+".type", "type %s doesn't match DSN scheme %s", s.Type, scheme)
+		} else if storageType == "" {
+			errs.add(path+".type", "type should be set if DSN has no scheme")
+		} else if !storage.Registered(storageType) {
+			errs.add(path+".type", "storage type not found: %s", storageType)
+		}
+		if s.DSN == "" {
+			errs.add(path+".dsn", "dsn should be set")
+		}
+		if s.Batch.Size < 0 {
+			errs.add(path+".batch.size", "size should not be negative: %d", s.Batch.Size)
+		}
+		if s.Batch.Interval < 0 {
+			errs.add(path+".batch.interval", "interval should not be negative: %s", s.Batch.Interval)
+		}
+		if s.Batch.Queue < 0 {
+			errs.add(path+".batch.queue", "queue should not be negative: %d", s.Batch.Queue)
+		}
+		if s.Batch.Overflow != "" {
+			if policy, err := storage.ParseOverflowPolicy(s.Batch.Overflow); err != nil {
+				errs.add(path+".batch.overflow", "%s", err)
+			} else if policy == storage.Spill && s.Batch.SpillPath == "" {
+				errs.add(path+".batch.spill_path", "spill_path should be set for spill overflow")
+			}
+		}
+	}
+
+	names := map[string]bool{}
+	for i, e := range c.Exchanges {
+		path := itemPath("exchanges", i, e.Name)
+		if e.Name == "" {
+			errs.add(path, "name should be set")
+		} else if names[e.Name] {
+			errs.add(path, "name is duplicated")
+		}
+		names[e.Name] = true
+		info, errType := exchanges.Lookup(e.Type)
+		if errType != nil {
+			errs.add(path+".type", "%s", errType)
+		}
+		protocol, errProtocol := exchanges.ParseProtocol(e.Protocol)
+		if errProtocol != nil {
+			errs.add(path+".protocol", "%s", errProtocol)
+		} else if errType == nil && !info.Supports(protocol) {
+			errs.add(path+".protocol", "%s protocol is not supported by %s", protocol, info.Name)
+		}
+		if len(e.Pairs) == 0 {
+			errs.add(path+".pairs", "at least one pair should be set")
+		}
+		seen := map[string]bool{}
+		for j, p := range e.Pairs {
+			pair, err := crypto.ParsePair(p)
+			if err != nil {
+				errs.add(fmt.Sprintf("%s.pairs[%d]", path, j), "%s", err)
+				continue
+			}
+			if seen[pair.String()] {
+				errs.add(fmt.Sprintf("%s.pairs[%d]", path, j), "pair is duplicated: %s", p)
+			}
+			seen[pair.String()] = true
+		}
+		for j, ch := range e.Channels {
+			if ch != ChannelTicker && ch != ChannelTrades {
+				errs.add(fmt.Sprintf("%s.channels[%d]", path, j), "unknown channel %s, expected %s or %s", ch, ChannelTicker, ChannelTrades)
+			} else if ch == ChannelTrades && errType == nil && errProtocol == nil && !info.SupportsChannel(protocol, exchanges.TradesChannel) {
+				errs.add(fmt.Sprintf("%s.channels[%d]", path, j), "trades are not supported by %s %s", info.Name, protocol)
+			}
+		}
+		if e.URL != "" {
+			if u, err := url.Parse(e.URL); err != nil || u.Scheme == "" || u.Host == "" {
+				errs.add(path+".url", "bad URL: %s", e.URL)
+			}
+		}
+		for j, s := range e.Storages {
+			if !storages[s] {
+				errs.add(fmt.Sprintf("%s.storages[%d]", path, j), "storage not found: %s", s)
+			}
+		}
+		if e.Reconnect != nil {
+			if err := e.Reconnect.Policy().Validate(); err != nil {
+				errs.add(path+".reconnect", "%s", err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
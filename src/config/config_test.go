@@ -0,0 +1,191 @@
+package config
+
+import (
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/exchanges/all"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/storage/all"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const validConfig = `
+exchanges:
+  - name: coinbase-ws
+    type: coinbase
+    pairs: [btc-usd, eth-btc]
+    channels: [ticker, trades]
+    url: wss://ws-feed.pro.coinbase.com
+    storages: [main]
+    raw_payload: true
+    reconnect:
+      initial_delay: 1s
+      max_delay: 30s
+      jitter: 0.1
+      max_attempts: 5
+  - name: coinbase-rest
+    type: coinbase
+    protocol: rest
+    pairs: [btc-eur]
+storages:
+  - name: main
+    type: mysql
+    dsn: user:password@tcp(127.0.0.1:3306)/
+  - name: backup
+    type: mysql
+    dsn: user:password@tcp(127.0.0.2:3306)/
+    batch:
+      size: 100
+      interval: 1s
+      queue: 5000
+      overflow: spill
+      spill_path: /var/lib/crypto-fetcher/backup.spill
+`
+
+func TestParse(t *testing.T) {
+	t.Run("valid config with defaults", func(t *testing.T) {
+		cfg, err := Parse([]byte(validConfig))
+		assert.NoError(t, err)
+		assert.Len(t, cfg.Exchanges, 2)
+		assert.Len(t, cfg.Storages, 2)
+
+		ws := cfg.Exchanges[0]
+		assert.Equal(t, "ws", ws.Protocol)
+		assert.Equal(t, []string{ChannelTicker, ChannelTrades}, ws.Channels)
+		assert.Equal(t, reconnect.Policy{InitialDelay: time.Second, MaxDelay: 30 * time.Second, Jitter: 0.1, MaxAttempts: 5}, ws.Reconnect.Policy())
+
+		rest := cfg.Exchanges[1]
+		assert.Equal(t, "rest", rest.Protocol)
+		assert.Equal(t, []string{ChannelTicker}, rest.Channels)
+		assert.Nil(t, rest.Reconnect)
+
+		assert.Equal(t, Batch{Size: 100, Interval: time.Second, Queue: 5000, Overflow: "spill", SpillPath: "/var/lib/crypto-fetcher/backup.spill"}, cfg.Storages[1].Batch)
+	})
+
+	t.Run("storage type is taken from DSN scheme", func(t *testing.T) {
+		_, err := Parse([]byte("exchanges:\n  - {name: a, type: coinbase, pairs: [btc-usd]}\nstorages:\n  - {name: s, dsn: \"file:///tmp/ticks?format=csv\"}\n"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("unknown fields are errors", func(t *testing.T) {
+		_, err := Parse([]byte("exchanges:\n  - name: a\n    pair: [btc-usd]\n"))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "pair")
+	})
+
+	t.Run("errors describe path of field", func(t *testing.T) {
+		cases := []struct {
+			config   string
+			expected []string
+		}{
+			{"{}", []string{"exchanges: at least one exchange should be set", "storages: at least one storage should be set"}},
+			{
+				`
+exchanges:
+  - name: a
+    type: nasdaq
+    protocol: fix
+    pairs: [btc-usd, BTC-USD, btcusd]
+    channels: [level2]
+    url: "not a url"
+    storages: [missing]
+    reconnect: {initial_delay: 1s, max_delay: 1s, jitter: 2}
+  - name: a
+    type: coinbase
+  - name: b
+    type: kraken
+    protocol: rest
+    pairs: [btc-usd]
+  - name: c
+    type: coinbase
+    protocol: rest
+    pairs: [btc-usd]
+    channels: [trades]
+storages:
+  - type: oracle
+  - name: s
+    type: mysql
+    dsn: dsn
+    batch: {size: -1, interval: -1s, queue: -1, overflow: spill}
+  - name: t
+    dsn: dsn
+    batch: {overflow: panic}
+  - name: u
+    type: mysql
+    dsn: file:///tmp
+`,
+				[]string{
+					"exchanges[0] (a).type: exchange not found: nasdaq",
+					"exchanges[0] (a).protocol: protocol not found: fix",
+					"exchanges[0] (a).pairs[1]: pair is duplicated: BTC-USD",
+					"exchanges[0] (a).pairs[2]: failed to split pair btcusd by delimiter: -",
+					"exchanges[0] (a).channels[0]: unknown channel level2, expected ticker or trades",
+					"exchanges[0] (a).url: bad URL: not a url",
+					"exchanges[0] (a).storages[0]: storage not found: missing",
+					"exchanges[0] (a).reconnect: jitter should be in range [0, 1]: 2.000000",
+					"exchanges[1] (a): name is duplicated",
+					"exchanges[1] (a).pairs: at least one pair should be set",
+					"exchanges[2] (b).protocol: rest protocol is not supported by kraken",
+					"exchanges[3] (c).channels[0]: trades are not supported by coinbase rest",
+					"storages[0]: name should be set",
+					"storages[0].type: storage type not found: oracle",
+					"storages[0].dsn: dsn should be set",
+					"storages[1] (s).batch.size: size should not be negative: -1",
+					"storages[1] (s).batch.interval: interval should not be negative: -1s",
+					"storages[1] (s).batch.queue: queue should not be negative: -1",
+					"storages[1] (s).batch.spill_path: spill_path should be set for spill overflow",
+					"storages[2] (t).type: type should be set if DSN has no scheme",
+					"storages[2] (t).batch.overflow: overflow policy not found: panic",
+					"storages[3] (u).type: type mysql doesn't match DSN scheme file",
+				},
+			},
+		}
+		for _, testCase := range cases {
+			_, err := Parse([]byte(testCase.config))
+			assert.Error(t, err)
+			for _, e := range testCase.expected {
+				assert.Contains(t, err.Error(), e)
+			}
+		}
+	})
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(validConfig), 0600))
+	cfg, err := Load(path)
+	assert.NoError(t, err)
+	assert.Len(t, cfg.Exchanges, 2)
+
+	_, err = Load(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("exchanges: []"), 0600))
+	_, err = Load(path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), path)
+}
+
+func TestExchange_ParsedPairs(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	pairs, err := Exchange{Pairs: []string{"btc-usd"}}.ParsedPairs()
+	assert.NoError(t, err)
+	assert.Equal(t, []crypto.Pair{btc_usd}, pairs)
+
+	_, err = Exchange{Pairs: []string{"btcusd"}}.ParsedPairs()
+	assert.Error(t, err)
+}
+
+func TestExchange_WritesTo(t *testing.T) {
+	assert.True(t, Exchange{}.WritesTo("main"))
+	assert.True(t, Exchange{Storages: []string{"main"}}.WritesTo("main"))
+	assert.False(t, Exchange{Storages: []string{"main"}}.WritesTo("backup"))
+}
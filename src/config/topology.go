@@ -0,0 +1,317 @@
+package config
+
+import (
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/Sn0w1eo/crypto-fetcher/src/storage"
+	"io"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Max time of draining pending ticks and trades on Stop
+const DrainTimeout = 10 * time.Second
+
+// Constructors of exchangers and storages, replaced in tests
+var (
+	newExchanger = exchanges.New
+	newStorage   = storage.New
+)
+
+// Optional setters of Exchanger
+type urlSetter interface {
+	SetURL(url string)
+}
+
+type reconnectSetter interface {
+	SetReconnectPolicy(policy reconnect.Policy) error
+}
+
+type rawPayloadSetter interface {
+	SetRawPayload(on bool)
+}
+
+// Optional batching of storage
+type batcher interface {
+	SetBatch(size int, interval time.Duration) error
+}
+
+// Optional write queue of storage
+type queuer interface {
+	SetQueue(capacity int, policy storage.OverflowPolicy, spillPath string) error
+}
+
+// node is a running Exchanger with storages it writes to
+type node struct {
+	cfg   Exchange
+	ex    exchanges.Exchanger
+	sinks []storage.Storage
+	// requested channels, nil if not requested
+	ticks  <-chan crypto.Tick
+	trades <-chan crypto.Trade
+}
+
+// Topology is a set of exchangers and storages built out of Config
+type Topology struct {
+	cfg      *Config
+	nodes    []*node
+	storages map[string]storage.Storage
+	logger   *log.Logger
+	writers  sync.WaitGroup
+}
+
+// Builds exchangers and opens storages described by cfg. Exchangers aren't dialed yet
+// Logs of exchangers and writers are written to w
+func Build(cfg *Config, w io.Writer) (*Topology, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	t := &Topology{
+		cfg:      cfg,
+		storages: map[string]storage.Storage{},
+		logger:   log.New(w, "", log.Ldate|log.Ltime),
+	}
+	for i, s := range cfg.Storages {
+		st, err := openStorage(s)
+		if err != nil {
+			_ = t.closeStorages()
+			return nil, fmt.Errorf("%s: %s", itemPath("storages", i, s.Name), err)
+		}
+		t.storages[s.Name] = st
+	}
+	for i, e := range cfg.Exchanges {
+		ex, err := buildExchanger(e, w)
+		if err != nil {
+			_ = t.closeStorages()
+			return nil, fmt.Errorf("%s: %s", itemPath("exchanges", i, e.Name), err)
+		}
+		n := &node{cfg: e, ex: ex}
+		for _, s := range cfg.Storages {
+			if e.WritesTo(s.Name) {
+				n.sinks = append(n.sinks, t.storages[s.Name])
+			}
+		}
+		t.nodes = append(t.nodes, n)
+	}
+	return t, nil
+}
+
+// Creates, configures and opens storage
+func openStorage(s Storage) (storage.Storage, error) {
+	storageType := storage.TypeOf(s.DSN, s.Type)
+	st, err := newStorage(storageType)
+	if err != nil {
+		return nil, err
+	}
+	if s.Batch.Size != 0 || s.Batch.Interval != 0 {
+		b, ok := st.(batcher)
+		if !ok {
+			return nil, fmt.Errorf("batching is not supported by %s", storageType)
+		}
+		if err = b.SetBatch(s.Batch.Size, s.Batch.Interval); err != nil {
+			return nil, err
+		}
+	}
+	if s.Batch.Queue != 0 || s.Batch.Overflow != "" || s.Batch.SpillPath != "" {
+		q, ok := st.(queuer)
+		if !ok {
+			return nil, fmt.Errorf("write queue is not supported by %s", storageType)
+		}
+		policy := storage.Block
+		if s.Batch.Overflow != "" {
+			policy, _ = storage.ParseOverflowPolicy(s.Batch.Overflow)
+		}
+		if err = q.SetQueue(s.Batch.Queue, policy, s.Batch.SpillPath); err != nil {
+			return nil, err
+		}
+	}
+	return st, st.Open(s.DSN)
+}
+
+// Creates and configures Exchanger, requests channels
+func buildExchanger(e Exchange, w io.Writer) (exchanges.Exchanger, error) {
+	exchange := e.Type
+	protocol, _ := exchanges.ParseProtocol(e.Protocol)
+	ex, err := newExchanger(exchange, protocol)
+	if err != nil {
+		return nil, err
+	}
+	ex.SetLogger(w)
+	pairs, _ := e.ParsedPairs()
+	if err = ex.SetPairs(pairs...); err != nil {
+		return nil, err
+	}
+	if e.URL != "" {
+		s, ok := ex.(urlSetter)
+		if !ok {
+			return nil, fmt.Errorf("URL override is not supported by %s %s", exchange, protocol)
+		}
+		s.SetURL(e.URL)
+	}
+	if e.Reconnect != nil {
+		s, ok := ex.(reconnectSetter)
+		if !ok {
+			return nil, fmt.Errorf("reconnect policy is not supported by %s %s", exchange, protocol)
+		}
+		if err = s.SetReconnectPolicy(e.Reconnect.Policy()); err != nil {
+			return nil, err
+		}
+	}
+	if e.RawPayload {
+		s, ok := ex.(rawPayloadSetter)
+		if !ok {
+			return nil, fmt.Errorf("raw payload is not supported by %s %s", exchange, protocol)
+		}
+		s.SetRawPayload(true)
+	}
+	for _, ch := range e.Channels {
+		if _, ok := ex.(exchanges.Trader); ch == ChannelTrades && !ok {
+			return nil, fmt.Errorf("trades are not supported by %s %s", exchange, protocol)
+		}
+	}
+	return ex, nil
+}
+
+// Dials every Exchanger and starts serving it, ticks and trades are written to storages
+// Returns error if some Exchanger failed to dial, already started exchangers are stopped
+func (t *Topology) Run() error {
+	for i, n := range t.nodes {
+		// channels are requested before dial, writers are started once it succeeded
+		// otherwise chans of node are never closed and Stop would wait for its writers
+		t.subscribe(n)
+		if err := n.ex.Dial(); err != nil {
+			for _, started := range t.nodes[:i] {
+				started.ex.Stop("dial of " + n.cfg.Name + " failed")
+			}
+			return fmt.Errorf("%s: %s", n.cfg.Name, err)
+		}
+		t.startWriters(n)
+		go func(n *node) {
+			if err := n.ex.Serve(); err != nil {
+				t.logger.Println(n.cfg.Name, err)
+			}
+		}(n)
+	}
+	return nil
+}
+
+// Requests channels of node from its Exchanger
+func (t *Topology) subscribe(n *node) {
+	for _, ch := range n.cfg.Channels {
+		switch ch {
+		case ChannelTicker:
+			n.ticks = n.ex.Ticker()
+		case ChannelTrades:
+			n.trades = n.ex.(exchanges.Trader).Trades()
+		}
+	}
+}
+
+// Starts writers of requested channels of node
+func (t *Topology) startWriters(n *node) {
+	if ticks := n.ticks; ticks != nil {
+		t.writers.Add(1)
+		go func() {
+			defer t.writers.Done()
+			for tick := range ticks {
+				// ticks of exchanges which don't mark them are marked by type of exchange
+				if tick.ExchangeId == "" {
+					tick.ExchangeId = n.cfg.Type
+				}
+				for _, st := range n.sinks {
+					if err := st.WriteTick(tick); err != nil {
+						t.logger.Println(n.cfg.Name, err)
+					}
+				}
+			}
+		}()
+	}
+	if trades := n.trades; trades != nil {
+		t.writers.Add(1)
+		go func() {
+			defer t.writers.Done()
+			for trade := range trades {
+				for _, st := range n.sinks {
+					if err := st.WriteTrade(trade); err != nil {
+						t.logger.Println(n.cfg.Name, err)
+					}
+				}
+			}
+		}()
+	}
+}
+
+// Stops every Exchanger, waits until pending ticks and trades are written and closes storages
+func (t *Topology) Stop(reason interface{}) error {
+	for _, n := range t.nodes {
+		n.ex.Stop(reason)
+	}
+	drained := make(chan struct{})
+	go func() {
+		t.writers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(DrainTimeout):
+		t.logger.Println("pending ticks haven't been drained in", DrainTimeout)
+	}
+	return t.closeStorages()
+}
+
+// Closes all opened storages, returns first error
+func (t *Topology) closeStorages() (err error) {
+	for name, st := range t.storages {
+		if closeErr := st.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("%s: %s", name, closeErr)
+		}
+	}
+	return err
+}
+
+// Applies pairs of cfg to running exchangers without dropping connections
+// Returns error if anything except pairs has been changed, nothing is applied in this case
+func (t *Topology) Reload(cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(t.cfg.Storages, cfg.Storages) {
+		return fmt.Errorf("storages: only pairs can be reloaded, restart is required")
+	}
+	if len(t.cfg.Exchanges) != len(cfg.Exchanges) {
+		return fmt.Errorf("exchanges: only pairs can be reloaded, restart is required")
+	}
+	updates := make([][]crypto.Pair, len(t.nodes))
+	for i, n := range t.nodes {
+		next := cfg.Exchanges[i]
+		path := itemPath("exchanges", i, next.Name)
+		prev := n.cfg
+		prev.Pairs = next.Pairs
+		if !reflect.DeepEqual(prev, next) {
+			return fmt.Errorf("%s: only pairs can be reloaded, restart is required", path)
+		}
+		if reflect.DeepEqual(n.cfg.Pairs, next.Pairs) {
+			continue
+		}
+		if _, ok := n.ex.(exchanges.PairUpdater); !ok {
+			return fmt.Errorf("%s: pairs reload is not supported by %s %s", path, next.Type, next.Protocol)
+		}
+		updates[i], _ = next.ParsedPairs()
+	}
+	for i, n := range t.nodes {
+		if updates[i] == nil {
+			continue
+		}
+		if err := n.ex.(exchanges.PairUpdater).UpdatePairs(updates[i]...); err != nil {
+			return fmt.Errorf("%s: %s", itemPath("exchanges", i, n.cfg.Name), err)
+		}
+		n.cfg.Pairs = cfg.Exchanges[i].Pairs
+		t.logger.Println(n.cfg.Name, "pairs reloaded:", n.cfg.Pairs)
+	}
+	t.cfg = cfg
+	return nil
+}
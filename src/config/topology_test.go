@@ -0,0 +1,260 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/Sn0w1eo/crypto-fetcher/src/storage"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fake Exchanger which sends one tick and one trade per pair on Serve
+type fExchanger struct {
+	url     string
+	raw     bool
+	policy  reconnect.Policy
+	pairs   []crypto.Pair
+	updated []crypto.Pair
+	tick    chan crypto.Tick
+	trade   chan crypto.Trade
+	done    chan bool
+	dialErr error
+	// exchange id of sent ticks
+	exchange string
+}
+
+func (f *fExchanger) Dial() error { return f.dialErr }
+func (f *fExchanger) DialContext(ctx context.Context) error {
+	return f.dialErr
+}
+func (f *fExchanger) SetLogger(writer io.Writer) {}
+func (f *fExchanger) SetURL(url string)          { f.url = url }
+func (f *fExchanger) SetRawPayload(on bool)      { f.raw = on }
+func (f *fExchanger) SetPairs(pairs ...crypto.Pair) error {
+	f.pairs = pairs
+	return nil
+}
+func (f *fExchanger) UpdatePairs(pairs ...crypto.Pair) error {
+	f.updated = pairs
+	return nil
+}
+func (f *fExchanger) SetReconnectPolicy(policy reconnect.Policy) error {
+	f.policy = policy
+	return nil
+}
+func (f *fExchanger) Ticker() <-chan crypto.Tick {
+	f.tick = make(chan crypto.Tick, 10)
+	return f.tick
+}
+func (f *fExchanger) Trades() <-chan crypto.Trade {
+	f.trade = make(chan crypto.Trade, 10)
+	return f.trade
+}
+func (f *fExchanger) Stop(reason interface{}) { f.done <- true }
+func (f *fExchanger) Serve() error {
+	return f.ServeContext(context.Background())
+}
+func (f *fExchanger) ServeContext(ctx context.Context) error {
+	for _, pair := range f.pairs {
+		if f.tick != nil {
+			f.tick <- crypto.Tick{P: pair, ExchangeId: f.exchange}
+		}
+		if f.trade != nil {
+			f.trade <- crypto.Trade{P: pair}
+		}
+	}
+	<-f.done
+	if f.tick != nil {
+		close(f.tick)
+	}
+	if f.trade != nil {
+		close(f.trade)
+	}
+	return nil
+}
+
+// Fake Storage which counts written ticks and trades
+type fStorage struct {
+	mu     sync.Mutex
+	dsn    string
+	ticks  int
+	trades int
+	// exchanges of written ticks
+	exchanges map[string]int
+	closed    bool
+	batch     Batch
+	policy    storage.OverflowPolicy
+}
+
+func (f *fStorage) Open(dsn string) error {
+	f.dsn = dsn
+	return nil
+}
+func (f *fStorage) WriteTick(ticker crypto.Ticker) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ticks++
+	if f.exchanges == nil {
+		f.exchanges = map[string]int{}
+	}
+	f.exchanges[ticker.(crypto.Tick).Exchange()]++
+	return nil
+}
+func (f *fStorage) WriteTrade(trade crypto.Trade) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.trades++
+	return nil
+}
+func (f *fStorage) WriteCandle(candle crypto.Candle) error { return nil }
+func (f *fStorage) Close() error {
+	f.closed = true
+	return nil
+}
+func (f *fStorage) SetBatch(size int, interval time.Duration) error {
+	f.batch.Size, f.batch.Interval = size, interval
+	return nil
+}
+func (f *fStorage) SetQueue(capacity int, policy storage.OverflowPolicy, spillPath string) error {
+	f.batch.Queue, f.batch.SpillPath = capacity, spillPath
+	f.policy = policy
+	return nil
+}
+
+// Replaces constructors by fakes, returns created fakes and restore function
+func useFakes() (*[]*fExchanger, *[]*fStorage, func()) {
+	var exs []*fExchanger
+	var sts []*fStorage
+	newExchanger = func(name string, protocol exchanges.Protocol) (exchanges.Exchanger, error) {
+		f := &fExchanger{done: make(chan bool, 1)}
+		exs = append(exs, f)
+		return f, nil
+	}
+	newStorage = func(storageType string) (storage.Storage, error) {
+		f := &fStorage{}
+		sts = append(sts, f)
+		return f, nil
+	}
+	return &exs, &sts, func() {
+		newExchanger = exchanges.New
+		newStorage = storage.New
+	}
+}
+
+func TestBuild(t *testing.T) {
+	exs, sts, restore := useFakes()
+	defer restore()
+
+	cfg, err := Parse([]byte(validConfig))
+	assert.NoError(t, err)
+	top, err := Build(cfg, &bytes.Buffer{})
+	assert.NoError(t, err)
+
+	assert.Len(t, *exs, 2)
+	assert.Len(t, *sts, 2)
+	assert.Equal(t, "wss://ws-feed.pro.coinbase.com", (*exs)[0].url)
+	assert.Equal(t, 5, (*exs)[0].policy.MaxAttempts)
+	assert.True(t, (*exs)[0].raw)
+	assert.False(t, (*exs)[1].raw)
+	assert.Len(t, (*exs)[0].pairs, 2)
+	assert.Equal(t, "user:password@tcp(127.0.0.1:3306)/", (*sts)[0].dsn)
+	assert.Equal(t, Batch{Size: 100, Interval: time.Second, Queue: 5000, SpillPath: "/var/lib/crypto-fetcher/backup.spill"}, (*sts)[1].batch)
+	assert.Equal(t, storage.Spill, (*sts)[1].policy)
+	assert.Len(t, top.nodes[0].sinks, 1)
+	assert.Len(t, top.nodes[1].sinks, 2)
+
+	_, err = Build(&Config{}, &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestBuild_unsupported(t *testing.T) {
+	_, sts, restore := useFakes()
+	defer restore()
+	newExchanger = func(name string, protocol exchanges.Protocol) (exchanges.Exchanger, error) {
+		return nil, fmt.Errorf("not implemented")
+	}
+
+	cfg, _ := Parse([]byte(validConfig))
+	_, err := Build(cfg, &bytes.Buffer{})
+	assert.EqualError(t, err, "exchanges[0] (coinbase-ws): not implemented")
+	for _, st := range *sts {
+		assert.True(t, st.closed)
+	}
+}
+
+func TestTopology_RunStop(t *testing.T) {
+	exs, sts, restore := useFakes()
+	defer restore()
+
+	cfg, _ := Parse([]byte(validConfig))
+	top, err := Build(cfg, &bytes.Buffer{})
+	assert.NoError(t, err)
+	// exchange id set by exchanger is kept
+	(*exs)[1].exchange = "coinbase-pro"
+	assert.NoError(t, top.Run())
+	assert.NoError(t, top.Stop("test"))
+
+	main, backup := (*sts)[0], (*sts)[1]
+	assert.Equal(t, 3, main.ticks)
+	assert.Equal(t, 2, main.trades)
+	assert.Equal(t, 1, backup.ticks)
+	assert.Equal(t, 0, backup.trades)
+	assert.Equal(t, map[string]int{"coinbase": 2, "coinbase-pro": 1}, main.exchanges)
+	assert.Equal(t, map[string]int{"coinbase-pro": 1}, backup.exchanges)
+	assert.True(t, main.closed)
+	assert.True(t, backup.closed)
+}
+
+func TestTopology_Run_dialFailed(t *testing.T) {
+	exs, _, restore := useFakes()
+	defer restore()
+
+	cfg, _ := Parse([]byte(validConfig))
+	top, err := Build(cfg, &bytes.Buffer{})
+	assert.NoError(t, err)
+	(*exs)[1].dialErr = fmt.Errorf("refused")
+	assert.EqualError(t, top.Run(), "coinbase-rest: refused")
+
+	// chans of failed exchanger are never closed, Stop must not wait for them
+	start := time.Now()
+	assert.NoError(t, top.Stop("test"))
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestTopology_Reload(t *testing.T) {
+	exs, _, restore := useFakes()
+	defer restore()
+
+	cfg, _ := Parse([]byte(validConfig))
+	top, err := Build(cfg, &bytes.Buffer{})
+	assert.NoError(t, err)
+
+	t.Run("pairs are updated without rebuild", func(t *testing.T) {
+		next, _ := Parse([]byte(validConfig))
+		next.Exchanges[1].Pairs = []string{"btc-eur", "eth-eur"}
+		assert.NoError(t, top.Reload(next))
+		assert.Nil(t, (*exs)[0].updated)
+		assert.Len(t, (*exs)[1].updated, 2)
+	})
+
+	t.Run("other changes require restart", func(t *testing.T) {
+		cases := []func(c *Config){
+			func(c *Config) { c.Exchanges[0].URL = "wss://127.0.0.1" },
+			func(c *Config) { c.Exchanges = c.Exchanges[:1] },
+			func(c *Config) { c.Storages[0].DSN = "other" },
+			func(c *Config) { c.Exchanges[0].Pairs = []string{"btcusd"} },
+		}
+		for _, change := range cases {
+			next, _ := Parse([]byte(validConfig))
+			change(next)
+			assert.Error(t, top.Reload(next))
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package crypto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Aliases maps exchange specific currency ids to Currency ids and back, e.g. XBT is BTC
+// Ids without alias are passed as is
+type Aliases struct {
+	toCurrency map[string]string
+	toExchange map[string]string
+}
+
+// Aliases used by several exchanges, e.g. Kraken and BitMEX
+var DefaultAliases = NewAliases(map[string]string{
+	"XBT": "BTC",
+	"XDG": "DOGE",
+})
+
+// Creates Aliases out of map of exchange id to Currency id, case insensitive
+func NewAliases(aliases map[string]string) *Aliases {
+	a := &Aliases{
+		toCurrency: make(map[string]string, len(aliases)),
+		toExchange: make(map[string]string, len(aliases)),
+	}
+	for alias, id := range aliases {
+		alias, id = strings.ToUpper(alias), strings.ToUpper(id)
+		a.toCurrency[alias] = id
+		a.toExchange[id] = alias
+	}
+	return a
+}
+
+// Returns Currency of exchange id
+func (a *Aliases) Currency(id string) (Currency, error) {
+	if common, ok := a.toCurrency[strings.ToUpper(id)]; ok {
+		id = common
+	}
+	return NewCurrency(id)
+}
+
+// Returns exchange id of Currency
+func (a *Aliases) Id(c Currency) string {
+	if alias, ok := a.toExchange[c.Id()]; ok {
+		return alias
+	}
+	return c.Id()
+}
+
+// Parses Pair out of exchange pair string with delimiter, e.g. "XBT/USD" is BTC-USD
+func (a *Aliases) ParsePair(s string, delimiter rune) (p Pair, err error) {
+	currencies := strings.Split(s, string(delimiter))
+	if len(currencies) != 2 {
+		return p, fmt.Errorf("failed to split pair %s by delimiter: %c", s, delimiter)
+	}
+	if p.primary, err = a.Currency(currencies[0]); err != nil {
+		return p, err
+	}
+	p.secondary, err = a.Currency(currencies[1])
+	return p, err
+}
+
+// Represents Pair as exchange pair string with delimiter, e.g. BTC-USD is "XBT/USD"
+func (a *Aliases) PairString(p Pair, delimiter rune) string {
+	return fmt.Sprintf("%s%c%s", a.Id(p.primary), delimiter, a.Id(p.secondary))
+}
@@ -0,0 +1,74 @@
+package crypto
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAliases_Currency(t *testing.T) {
+	cases := []struct {
+		id       string
+		expected string
+		hasError bool
+	}{
+		{"XBT", "BTC", false},
+		{"xdg", "DOGE", false},
+		{"ETH", "ETH", false},
+		{"X", "", true},
+	}
+	for _, testCase := range cases {
+		c, err := DefaultAliases.Currency(testCase.id)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, c.Id())
+	}
+}
+
+func TestAliases_Id(t *testing.T) {
+	btc, _ := NewCurrency("btc")
+	eth, _ := NewCurrency("eth")
+	assert.Equal(t, "XBT", DefaultAliases.Id(btc))
+	assert.Equal(t, "ETH", DefaultAliases.Id(eth))
+
+	a := NewAliases(map[string]string{"usdt": "usd"})
+	usd, _ := NewCurrency("usd")
+	assert.Equal(t, "USDT", a.Id(usd))
+	assert.Equal(t, "BTC", a.Id(btc))
+}
+
+func TestAliases_ParsePair(t *testing.T) {
+	btc_usd, _ := NewPair("btc", "usd")
+	doge_btc, _ := NewPair("doge", "btc")
+
+	cases := []struct {
+		s        string
+		expected Pair
+		hasError bool
+	}{
+		{"XBT/USD", btc_usd, false},
+		{"XDG/XBT", doge_btc, false},
+		{"BTC/USD", btc_usd, false},
+		{"XBT-USD", Pair{}, true},
+		{"XBT/U", Pair{}, true},
+		{"X/USD", Pair{}, true},
+	}
+	for _, testCase := range cases {
+		pair, err := DefaultAliases.ParsePair(testCase.s, '/')
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, pair)
+	}
+}
+
+func TestAliases_PairString(t *testing.T) {
+	btc_usd, _ := NewPair("btc", "usd")
+	eth_usd, _ := NewPair("eth", "usd")
+	assert.Equal(t, "XBT/USD", DefaultAliases.PairString(btc_usd, '/'))
+	assert.Equal(t, "ETH/USD", DefaultAliases.PairString(eth_usd, '/'))
+}
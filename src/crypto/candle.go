@@ -0,0 +1,26 @@
+package crypto
+
+import "time"
+
+// Candle is a common struct for OHLCV record of pair
+// T is start of bucket, Interval is its length
+type Candle struct {
+	T        time.Time
+	P        Pair
+	Interval time.Duration
+	Open     Decimal
+	High     Decimal
+	Low      Decimal
+	Close    Decimal
+	Volume   Decimal
+}
+
+// Returns end of Candle's bucket (exclusive)
+func (c Candle) End() time.Time {
+	return c.T.Add(c.Interval)
+}
+
+// Returns true if t belongs to Candle's bucket
+func (c Candle) Contains(t time.Time) bool {
+	return !t.Before(c.T) && t.Before(c.End())
+}
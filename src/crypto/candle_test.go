@@ -0,0 +1,28 @@
+package crypto
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCandle_End(t *testing.T) {
+	c := Candle{T: time.Unix(60, 0), Interval: time.Minute}
+	assert.Equal(t, time.Unix(120, 0), c.End())
+}
+
+func TestCandle_Contains(t *testing.T) {
+	c := Candle{T: time.Unix(60, 0), Interval: time.Minute}
+	cases := []struct {
+		t        time.Time
+		expected bool
+	}{
+		{time.Unix(60, 0), true},
+		{time.Unix(119, 999), true},
+		{time.Unix(120, 0), false},
+		{time.Unix(59, 0), false},
+	}
+	for _, testCase := range cases {
+		assert.Equal(t, testCase.expected, c.Contains(testCase.t))
+	}
+}
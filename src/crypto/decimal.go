@@ -0,0 +1,255 @@
+package crypto
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal is an arbitrary precision fixed-point number
+// value is unscaled integer, Decimal equals value * 10^-scale
+// Zero value of Decimal is 0. Decimal is immutable, all operations return new Decimal
+// String keeps scale of parsed number, so "1.50" is represented as "1.50"
+type Decimal struct {
+	value *big.Int
+	scale int32
+}
+
+// Limits exponent and scale of parsed Decimal, larger ones would take huge memory and don't occur in market data
+const maxScale = 1000
+
+// Parses Decimal out of string like "-123.456" or "1e-8"
+// Returns error if s isn't a decimal number or its exponent or scale is out of [-1000, 1000]
+func NewDecimal(s string) (Decimal, error) {
+	mantissa, exp := s, int64(0)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		exp, err = strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("bad decimal exponent: %s", s)
+		}
+		if exp < -maxScale || exp > maxScale {
+			return Decimal{}, fmt.Errorf("decimal exponent is out of range: %s", s)
+		}
+		mantissa = s[:i]
+	}
+	scale := int64(0)
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		scale = int64(len(mantissa) - i - 1)
+		mantissa = mantissa[:i] + mantissa[i+1:]
+	}
+	if mantissa == "" || mantissa == "-" || mantissa == "+" || strings.ContainsAny(mantissa[1:], "+-") {
+		return Decimal{}, fmt.Errorf("bad decimal: %s", s)
+	}
+	value, ok := new(big.Int).SetString(mantissa, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("bad decimal: %s", s)
+	}
+	scale -= exp
+	if scale < -maxScale || scale > maxScale {
+		return Decimal{}, fmt.Errorf("decimal scale is out of range: %s", s)
+	}
+	if scale < 0 {
+		value.Mul(value, pow10(-scale))
+		scale = 0
+	}
+	return Decimal{value: value, scale: int32(scale)}, nil
+}
+
+// Same as NewDecimal but panics on error. Used for constants
+func MustDecimal(s string) Decimal {
+	d, err := NewDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Creates Decimal out of int64
+func NewDecimalFromInt(i int64) Decimal {
+	return Decimal{value: big.NewInt(i)}
+}
+
+// Creates Decimal out of float64 using the shortest representation of f
+// Used as migration path for float64 based callers, NaN and Inf become 0
+func NewDecimalFromFloat(f float64) Decimal {
+	d, err := NewDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return Decimal{}
+	}
+	return d
+}
+
+// Returns 10^n
+func pow10(n int64) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(n), nil)
+}
+
+// Returns unscaled value, zero Decimal has nil value
+func (d Decimal) unscaled() *big.Int {
+	if d.value == nil {
+		return new(big.Int)
+	}
+	return d.value
+}
+
+// Returns unscaled value of d rescaled to scale, scale should not be less than d.scale
+func (d Decimal) rescaled(scale int32) *big.Int {
+	v := new(big.Int).Set(d.unscaled())
+	if scale > d.scale {
+		v.Mul(v, pow10(int64(scale-d.scale)))
+	}
+	return v
+}
+
+// Returns unscaled values of a and b with common scale
+func align(a Decimal, b Decimal) (*big.Int, *big.Int, int32) {
+	scale := a.scale
+	if b.scale > scale {
+		scale = b.scale
+	}
+	return a.rescaled(scale), b.rescaled(scale), scale
+}
+
+// Returns d + o
+func (d Decimal) Add(o Decimal) Decimal {
+	a, b, scale := align(d, o)
+	return Decimal{value: a.Add(a, b), scale: scale}
+}
+
+// Returns d - o
+func (d Decimal) Sub(o Decimal) Decimal {
+	a, b, scale := align(d, o)
+	return Decimal{value: a.Sub(a, b), scale: scale}
+}
+
+// Returns d * o
+func (d Decimal) Mul(o Decimal) Decimal {
+	v := new(big.Int).Mul(d.unscaled(), o.unscaled())
+	return Decimal{value: v, scale: d.scale + o.scale}
+}
+
+// Returns d / o rounded half away from zero to scale digits after point
+// Returns error on division by zero
+func (d Decimal) Div(o Decimal, scale int32) (Decimal, error) {
+	if o.Sign() == 0 {
+		return Decimal{}, fmt.Errorf("division by zero")
+	}
+	// d / o = (dv * 10^(scale + o.scale - d.scale + 1)) / ov, extra digit is used for rounding
+	num := new(big.Int).Set(d.unscaled())
+	den := new(big.Int).Set(o.unscaled())
+	shift := int64(scale) + int64(o.scale) - int64(d.scale) + 1
+	if shift >= 0 {
+		num.Mul(num, pow10(shift))
+	} else {
+		den.Mul(den, pow10(-shift))
+	}
+	q := num.Quo(num, den)
+	return Decimal{value: q, scale: scale + 1}.Round(scale), nil
+}
+
+// Returns d rounded half away from zero to scale digits after point
+func (d Decimal) Round(scale int32) Decimal {
+	if scale >= d.scale {
+		return d
+	}
+	div := pow10(int64(d.scale - scale))
+	q, r := new(big.Int).QuoRem(d.unscaled(), div, new(big.Int))
+	r.Abs(r).Mul(r, big.NewInt(2))
+	if r.Cmp(div) >= 0 {
+		q.Add(q, big.NewInt(int64(d.Sign())))
+	}
+	return Decimal{value: q, scale: scale}
+}
+
+// Returns -d
+func (d Decimal) Neg() Decimal {
+	return Decimal{value: new(big.Int).Neg(d.unscaled()), scale: d.scale}
+}
+
+// Returns -1, 0 or +1 depending on d < o, d == o or d > o
+func (d Decimal) Cmp(o Decimal) int {
+	a, b, _ := align(d, o)
+	return a.Cmp(b)
+}
+
+// Returns true if d and o are numerically equal, scale is ignored
+func (d Decimal) Equal(o Decimal) bool {
+	return d.Cmp(o) == 0
+}
+
+// Returns -1, 0 or +1 depending on sign of d
+func (d Decimal) Sign() int {
+	return d.unscaled().Sign()
+}
+
+// Returns true if d is 0
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Returns count of digits after point
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// Returns the nearest float64 to d. Used as migration path for float64 based callers
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Represents Decimal as string without exponent
+func (d Decimal) String() string {
+	v := d.unscaled()
+	s := new(big.Int).Abs(v).String()
+	if d.scale > 0 {
+		if len(s) <= int(d.scale) {
+			s = strings.Repeat("0", int(d.scale)-len(s)+1) + s
+		}
+		s = s[:len(s)-int(d.scale)] + "." + s[len(s)-int(d.scale):]
+	}
+	if v.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// Marshals Decimal as JSON string to keep precision
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// Unmarshals Decimal out of JSON string or number
+func (d *Decimal) UnmarshalJSON(b []byte) (err error) {
+	s := string(b)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	*d, err = NewDecimal(s)
+	return err
+}
+
+// Implements driver.Valuer, Decimal is passed to database as string
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Implements sql.Scanner for DECIMAL columns
+func (d *Decimal) Scan(src interface{}) (err error) {
+	switch v := src.(type) {
+	case []byte:
+		*d, err = NewDecimal(string(v))
+	case string:
+		*d, err = NewDecimal(v)
+	case int64:
+		*d = NewDecimalFromInt(v)
+	case float64:
+		*d = NewDecimalFromFloat(v)
+	default:
+		err = fmt.Errorf("unable to scan %T into Decimal", src)
+	}
+	return err
+}
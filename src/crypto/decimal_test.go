@@ -0,0 +1,195 @@
+package crypto
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestNewDecimal(t *testing.T) {
+	cases := []struct {
+		actual   string
+		expected string
+		hasError bool
+	}{
+		{"0.00001234", "0.00001234", false},
+		{"123.4500", "123.4500", false},
+		{"-1.5", "-1.5", false},
+		{"+7", "7", false},
+		{".5", "0.5", false},
+		{"-.5", "-0.5", false},
+		{"1e-8", "0.00000001", false},
+		{"1.5E3", "1500", false},
+		{"12345678901234567890.123456789012345678", "12345678901234567890.123456789012345678", false},
+		{"", "", true},
+		{".", "", true},
+		{"-", "", true},
+		{"1.2.3", "", true},
+		{"1-2", "", true},
+		{"ABC", "", true},
+		{"1e", "", true},
+		{" 1", "", true},
+		{"1e1000", "1" + strings.Repeat("0", 1000), false},
+		{"1e-1000", "0." + strings.Repeat("0", 999) + "1", false},
+		{"1e999999999", "", true},
+		{"1e-1001", "", true},
+		{"1e99999999999", "", true},
+		{"0." + strings.Repeat("0", 1000) + "1", "", true},
+		{"0.1e-1000", "", true},
+	}
+	for _, testCase := range cases {
+		d, err := NewDecimal(testCase.actual)
+		if testCase.hasError {
+			assert.Error(t, err, testCase.actual)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, d.String())
+	}
+}
+
+func TestMustDecimal(t *testing.T) {
+	assert.Equal(t, "1.5", MustDecimal("1.5").String())
+	assert.Panics(t, func() { MustDecimal("X") })
+}
+
+func TestNewDecimalFromFloat(t *testing.T) {
+	assert.Equal(t, "0.00001234", NewDecimalFromFloat(0.00001234).String())
+	assert.Equal(t, "-2.5", NewDecimalFromFloat(-2.5).String())
+	assert.Equal(t, "100", NewDecimalFromFloat(100).String())
+	assert.Equal(t, "42", NewDecimalFromInt(42).String())
+}
+
+func TestDecimal_Zero(t *testing.T) {
+	var d Decimal
+	assert.True(t, d.IsZero())
+	assert.Equal(t, "0", d.String())
+	assert.Equal(t, "1.5", d.Add(MustDecimal("1.5")).String())
+	assert.Equal(t, 0, d.Cmp(MustDecimal("0.000")))
+}
+
+func TestDecimal_Arithmetic(t *testing.T) {
+	cases := []struct {
+		a   string
+		b   string
+		add string
+		sub string
+		mul string
+	}{
+		{"0.1", "0.2", "0.3", "-0.1", "0.02"},
+		{"1.50", "2", "3.50", "-0.50", "3.00"},
+		{"-0.00001234", "0.00001234", "0.00000000", "-0.00002468", "-0.0000000001522756"},
+	}
+	for _, testCase := range cases {
+		a, b := MustDecimal(testCase.a), MustDecimal(testCase.b)
+		assert.Equal(t, testCase.add, a.Add(b).String())
+		assert.Equal(t, testCase.sub, a.Sub(b).String())
+		assert.Equal(t, testCase.mul, a.Mul(b).String())
+	}
+	assert.Equal(t, "-1.5", MustDecimal("1.5").Neg().String())
+}
+
+func TestDecimal_Div(t *testing.T) {
+	cases := []struct {
+		a        string
+		b        string
+		scale    int32
+		expected string
+		hasError bool
+	}{
+		{"1", "3", 4, "0.3333", false},
+		{"2", "3", 4, "0.6667", false},
+		{"-2", "3", 2, "-0.67", false},
+		{"10.5", "2", 0, "5", false},
+		{"0.045", "1", 1, "0.0", false},
+		{"0.05", "1", 1, "0.1", false},
+		{"100", "0.25", 0, "400", false},
+		{"1", "0", 2, "", true},
+	}
+	for _, testCase := range cases {
+		d, err := MustDecimal(testCase.a).Div(MustDecimal(testCase.b), testCase.scale)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, d.String())
+	}
+}
+
+func TestDecimal_Round(t *testing.T) {
+	cases := []struct {
+		actual   string
+		scale    int32
+		expected string
+	}{
+		{"1.2345", 2, "1.23"},
+		{"1.235", 2, "1.24"},
+		{"-1.235", 2, "-1.24"},
+		{"1.5", 0, "2"},
+		{"1.5", 3, "1.5"},
+	}
+	for _, testCase := range cases {
+		assert.Equal(t, testCase.expected, MustDecimal(testCase.actual).Round(testCase.scale).String())
+	}
+}
+
+func TestDecimal_Cmp(t *testing.T) {
+	assert.Equal(t, -1, MustDecimal("0.00001233").Cmp(MustDecimal("0.00001234")))
+	assert.Equal(t, 1, MustDecimal("10").Cmp(MustDecimal("9.99999999")))
+	assert.Equal(t, 0, MustDecimal("1.50").Cmp(MustDecimal("1.5")))
+	assert.True(t, MustDecimal("1.50").Equal(MustDecimal("1.5")))
+	assert.Equal(t, -1, MustDecimal("-1").Sign())
+	assert.Equal(t, int32(2), MustDecimal("1.50").Scale())
+}
+
+func TestDecimal_Float64(t *testing.T) {
+	assert.Equal(t, 0.00001234, MustDecimal("0.00001234").Float64())
+	assert.Equal(t, -2.5, MustDecimal("-2.50").Float64())
+}
+
+func TestDecimal_JSON(t *testing.T) {
+	var v struct {
+		A Decimal `json:"a"`
+		B Decimal `json:"b"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"a":"0.00001234","b":1.5}`), &v))
+	assert.Equal(t, "0.00001234", v.A.String())
+	assert.Equal(t, "1.5", v.B.String())
+
+	b, err := json.Marshal(v)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":"0.00001234","b":"1.5"}`, string(b))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"a":"X"}`), &v))
+}
+
+func TestDecimal_SQL(t *testing.T) {
+	value, err := MustDecimal("0.00001234").Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "0.00001234", value)
+
+	cases := []struct {
+		src      interface{}
+		expected string
+		hasError bool
+	}{
+		{[]byte("0.000012340000"), "0.000012340000", false},
+		{"1.5", "1.5", false},
+		{int64(3), "3", false},
+		{2.5, "2.5", false},
+		{nil, "", true},
+		{[]byte("X"), "", true},
+	}
+	for _, testCase := range cases {
+		var d Decimal
+		err := d.Scan(testCase.src)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, d.String())
+	}
+}
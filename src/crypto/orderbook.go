@@ -0,0 +1,239 @@
+package crypto
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Used to get mid price
+var half = MustDecimal("0.5")
+
+// Side of order book
+type Side int
+
+const (
+	Bid Side = iota + 1
+	Ask
+)
+
+// Returns Side as string
+func (s Side) String() string {
+	switch s {
+	case Bid:
+		return "bid"
+	case Ask:
+		return "ask"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// Level is an aggregated price level of order book
+type Level struct {
+	Price Decimal
+	Size  Decimal
+}
+
+// BookChange is a single change of price level. Zero Size removes level
+type BookChange struct {
+	Side  Side
+	Price Decimal
+	Size  Decimal
+}
+
+// BookUpdate is sent by Exchanger on every order book change
+// Snapshot is true if Book has been fully replaced
+// Book is shared with Exchanger and is safe for concurrent read
+type BookUpdate struct {
+	T        time.Time
+	P        Pair
+	Snapshot bool
+	Changes  []BookChange
+	Book     *OrderBook
+}
+
+// OrderBook stores sorted price levels of concrete pair
+// bids are sorted by price descending, asks ascending
+// OrderBook is safe for concurrent use and satisfies Ticker interface
+type OrderBook struct {
+	mu   sync.RWMutex
+	t    time.Time
+	pair Pair
+	bids []Level
+	asks []Level
+}
+
+// Creates new empty OrderBook
+func NewOrderBook(pair Pair) *OrderBook {
+	return &OrderBook{pair: pair}
+}
+
+// Returns pair of OrderBook
+func (ob *OrderBook) Pair() (Pair, error) {
+	return ob.pair, nil
+}
+
+// Returns time of last change
+func (ob *OrderBook) Timestamp() time.Time {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return ob.t
+}
+
+// Replaces all levels of OrderBook. Levels with zero size are skipped
+func (ob *OrderBook) Reset(t time.Time, bids []Level, asks []Level) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	ob.t = t
+	ob.bids = ob.bids[:0]
+	ob.asks = ob.asks[:0]
+	for _, l := range bids {
+		ob.bids = setLevel(ob.bids, Bid, l)
+	}
+	for _, l := range asks {
+		ob.asks = setLevel(ob.asks, Ask, l)
+	}
+}
+
+// Applies changes to OrderBook. Returns error on unknown side or negative size
+// Changes are applied all or none, OrderBook stays unchanged on error
+func (ob *OrderBook) Apply(t time.Time, changes ...BookChange) error {
+	for _, c := range changes {
+		if c.Size.Sign() < 0 {
+			return fmt.Errorf("negative size of level: %s", c.Size)
+		}
+		if c.Side != Bid && c.Side != Ask {
+			return fmt.Errorf("unknown side: %s", c.Side)
+		}
+	}
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	for _, c := range changes {
+		l := Level{Price: c.Price, Size: c.Size}
+		if c.Side == Bid {
+			ob.bids = setLevel(ob.bids, Bid, l)
+		} else {
+			ob.asks = setLevel(ob.asks, Ask, l)
+		}
+	}
+	ob.t = t
+	return nil
+}
+
+// Returns count of levels of side
+func (ob *OrderBook) Len(side Side) int {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	return len(ob.levels(side))
+}
+
+// Returns copy of best n levels of side. All levels are returned if n is less than 1
+func (ob *OrderBook) Top(side Side, n int) []Level {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	levels := ob.levels(side)
+	if n < 1 || n > len(levels) {
+		n = len(levels)
+	}
+	top := make([]Level, n)
+	copy(top, levels)
+	return top
+}
+
+// Returns total size of side's levels with price same or better than limit
+func (ob *OrderBook) Depth(side Side, limit Decimal) (size Decimal) {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	for _, l := range ob.levels(side) {
+		if better(side, limit, l.Price) {
+			break
+		}
+		size = size.Add(l.Size)
+	}
+	return size
+}
+
+// Returns best level of side. Error occurs if side is empty
+func (ob *OrderBook) Best(side Side) (Level, error) {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+	levels := ob.levels(side)
+	if len(levels) == 0 {
+		return Level{}, fmt.Errorf("%s side of %s is empty", side, ob.pair.String())
+	}
+	return levels[0], nil
+}
+
+// Returns best bid price
+func (ob *OrderBook) BestBid() (Decimal, error) {
+	l, err := ob.Best(Bid)
+	return l.Price, err
+}
+
+// Returns best ask price
+func (ob *OrderBook) BestAsk() (Decimal, error) {
+	l, err := ob.Best(Ask)
+	return l.Price, err
+}
+
+// Returns price between best bid and best ask
+func (ob *OrderBook) Mid() (Decimal, error) {
+	bid, ask, err := ob.bidAsk()
+	return bid.Add(ask).Mul(half), err
+}
+
+// Returns difference between best ask and best bid
+func (ob *OrderBook) Spread() (Decimal, error) {
+	bid, ask, err := ob.bidAsk()
+	return ask.Sub(bid), err
+}
+
+// Returns best bid and best ask prices
+func (ob *OrderBook) bidAsk() (bid Decimal, ask Decimal, err error) {
+	bid, err = ob.BestBid()
+	if err != nil {
+		return Decimal{}, Decimal{}, err
+	}
+	ask, err = ob.BestAsk()
+	if err != nil {
+		return Decimal{}, Decimal{}, err
+	}
+	return bid, ask, nil
+}
+
+// Returns levels of side, important: lock should be held
+func (ob *OrderBook) levels(side Side) []Level {
+	if side == Bid {
+		return ob.bids
+	}
+	return ob.asks
+}
+
+// Returns true if price a is better than b for side
+func better(side Side, a Decimal, b Decimal) bool {
+	if side == Bid {
+		return a.Cmp(b) > 0
+	}
+	return a.Cmp(b) < 0
+}
+
+// Inserts, replaces or removes (on zero size) level keeping levels sorted
+func setLevel(levels []Level, side Side, l Level) []Level {
+	i := sort.Search(len(levels), func(i int) bool {
+		return !better(side, levels[i].Price, l.Price)
+	})
+	found := i < len(levels) && levels[i].Price.Equal(l.Price)
+	switch {
+	case found && l.Size.IsZero():
+		return append(levels[:i], levels[i+1:]...)
+	case found:
+		levels[i] = l
+	case !l.Size.IsZero():
+		levels = append(levels, Level{})
+		copy(levels[i+1:], levels[i:])
+		levels[i] = l
+	}
+	return levels
+}
@@ -0,0 +1,151 @@
+package crypto
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Returns Level out of price and size strings
+func lv(price string, size string) Level {
+	return Level{Price: MustDecimal(price), Size: MustDecimal(size)}
+}
+
+// Returns levels as "price:size" strings to compare them regardless of scale
+func levelStrings(levels []Level) []string {
+	s := make([]string, 0, len(levels))
+	for _, l := range levels {
+		s = append(s, l.Price.String()+":"+l.Size.String())
+	}
+	return s
+}
+
+func newTestBook() *OrderBook {
+	pair, _ := NewPair("btc", "usd")
+	ob := NewOrderBook(pair)
+	ob.Reset(time.Unix(1, 0),
+		[]Level{lv("99", "1"), lv("100", "2"), lv("98", "0")},
+		[]Level{lv("102", "3"), lv("101", "4")},
+	)
+	return ob
+}
+
+func TestSide_String(t *testing.T) {
+	assert.Equal(t, "bid", Bid.String())
+	assert.Equal(t, "ask", Ask.String())
+	assert.Equal(t, "unknown(0)", Side(0).String())
+}
+
+func TestOrderBook_Reset(t *testing.T) {
+	ob := newTestBook()
+	assert.Equal(t, []string{"100:2", "99:1"}, levelStrings(ob.Top(Bid, 0)))
+	assert.Equal(t, []string{"101:4", "102:3"}, levelStrings(ob.Top(Ask, 0)))
+	assert.Equal(t, time.Unix(1, 0), ob.Timestamp())
+
+	ob.Reset(time.Unix(2, 0), nil, []Level{lv("1", "1")})
+	assert.Equal(t, 0, ob.Len(Bid))
+	assert.Equal(t, 1, ob.Len(Ask))
+}
+
+func TestOrderBook_Apply(t *testing.T) {
+	cases := []struct {
+		change   BookChange
+		bids     []string
+		asks     []string
+		hasError bool
+	}{
+		{BookChange{Bid, MustDecimal("99.5"), MustDecimal("1")}, []string{"100:2", "99.5:1", "99:1"}, []string{"101:4", "102:3"}, false},
+		{BookChange{Bid, MustDecimal("100.00"), MustDecimal("5")}, []string{"100.00:5", "99:1"}, []string{"101:4", "102:3"}, false},
+		{BookChange{Bid, MustDecimal("100"), MustDecimal("0.000")}, []string{"99:1"}, []string{"101:4", "102:3"}, false},
+		{BookChange{Ask, MustDecimal("100.5"), MustDecimal("1")}, []string{"100:2", "99:1"}, []string{"100.5:1", "101:4", "102:3"}, false},
+		{BookChange{Ask, MustDecimal("103"), MustDecimal("1")}, []string{"100:2", "99:1"}, []string{"101:4", "102:3", "103:1"}, false},
+		{BookChange{Ask, MustDecimal("102"), MustDecimal("0")}, []string{"100:2", "99:1"}, []string{"101:4"}, false},
+		{BookChange{Ask, MustDecimal("105"), MustDecimal("0")}, []string{"100:2", "99:1"}, []string{"101:4", "102:3"}, false},
+		{BookChange{Side(0), MustDecimal("1"), MustDecimal("1")}, nil, nil, true},
+		{BookChange{Bid, MustDecimal("1"), MustDecimal("-1")}, nil, nil, true},
+	}
+	for _, testCase := range cases {
+		ob := newTestBook()
+		err := ob.Apply(time.Unix(2, 0), testCase.change)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.bids, levelStrings(ob.Top(Bid, 0)))
+		assert.Equal(t, testCase.asks, levelStrings(ob.Top(Ask, 0)))
+		assert.Equal(t, time.Unix(2, 0), ob.Timestamp())
+	}
+
+	t.Run("rejected batch leaves book unchanged", func(t *testing.T) {
+		ob := newTestBook()
+		for _, bad := range []BookChange{
+			{Bid, MustDecimal("1"), MustDecimal("-1")},
+			{Side(0), MustDecimal("1"), MustDecimal("1")},
+		} {
+			err := ob.Apply(time.Unix(2, 0),
+				BookChange{Bid, MustDecimal("99.5"), MustDecimal("1")},
+				BookChange{Ask, MustDecimal("101"), MustDecimal("0")},
+				bad,
+			)
+			assert.Error(t, err)
+			assert.Equal(t, []string{"100:2", "99:1"}, levelStrings(ob.Top(Bid, 0)))
+			assert.Equal(t, []string{"101:4", "102:3"}, levelStrings(ob.Top(Ask, 0)))
+			assert.Equal(t, time.Unix(1, 0), ob.Timestamp())
+		}
+	})
+}
+
+func TestOrderBook_Top(t *testing.T) {
+	ob := newTestBook()
+	assert.Equal(t, []string{"100:2"}, levelStrings(ob.Top(Bid, 1)))
+	assert.Equal(t, []string{"101:4", "102:3"}, levelStrings(ob.Top(Ask, 10)))
+
+	top := ob.Top(Bid, 1)
+	top[0].Size = MustDecimal("10")
+	assert.Equal(t, []string{"100:2"}, levelStrings(ob.Top(Bid, 1)))
+}
+
+func TestOrderBook_Depth(t *testing.T) {
+	ob := newTestBook()
+	assert.Equal(t, "2", ob.Depth(Bid, MustDecimal("100")).String())
+	assert.Equal(t, "3", ob.Depth(Bid, MustDecimal("99")).String())
+	assert.Equal(t, "0", ob.Depth(Bid, MustDecimal("101")).String())
+	assert.Equal(t, "4", ob.Depth(Ask, MustDecimal("101.5")).String())
+	assert.Equal(t, "7", ob.Depth(Ask, MustDecimal("200")).String())
+}
+
+func TestOrderBook_BestBidAsk(t *testing.T) {
+	ob := newTestBook()
+	bid, err := ob.BestBid()
+	assert.NoError(t, err)
+	assert.Equal(t, "100", bid.String())
+	ask, err := ob.BestAsk()
+	assert.NoError(t, err)
+	assert.Equal(t, "101", ask.String())
+
+	tick, err := WrapTicker(ob)
+	assert.NoError(t, err)
+	assert.Equal(t, "100", tick.Bid.String())
+	assert.Equal(t, "101", tick.Ask.String())
+
+	ob.Reset(time.Unix(0, 0), nil, nil)
+	_, err = ob.Best(Bid)
+	assert.Error(t, err)
+}
+
+func TestOrderBook_MidSpread(t *testing.T) {
+	ob := newTestBook()
+	mid, err := ob.Mid()
+	assert.NoError(t, err)
+	assert.True(t, MustDecimal("100.5").Equal(mid))
+	spread, err := ob.Spread()
+	assert.NoError(t, err)
+	assert.Equal(t, "1", spread.String())
+
+	ob.Reset(time.Unix(0, 0), []Level{lv("1", "1")}, nil)
+	_, err = ob.Mid()
+	assert.Error(t, err)
+	_, err = ob.Spread()
+	assert.Error(t, err)
+}
@@ -1,6 +1,9 @@
 package crypto
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // Represents default delimiter for Pair
 const PairDefaultDelimiter = '-'
@@ -44,3 +47,41 @@ func (p *Pair) String(delimiter ...rune) string {
 	}
 	return fmt.Sprintf("%s%c%s", p.primary.Id(), d, p.secondary.Id())
 }
+
+// Parses Pair out of string with default delimiter, e.g. "BTC-USD"
+// Returns error if string isn't split into two currencies
+func ParsePair(s string, delimiter ...rune) (p Pair, err error) {
+	d := PairDefaultDelimiter
+	if len(delimiter) > 0 {
+		d = delimiter[0]
+	}
+	currencies := strings.Split(s, string(d))
+	if len(currencies) != 2 {
+		return p, fmt.Errorf("failed to split pair %s by delimiter: %c", s, d)
+	}
+	return NewPair(currencies[0], currencies[1])
+}
+
+// Returns pairs which are in next but not in prev and pairs which are in prev but not in next
+// Used by Exchangers to subscribe and unsubscribe pairs on update
+func DiffPairs(prev []Pair, next []Pair) (added []Pair, removed []Pair) {
+	contains := func(pairs []Pair, pair Pair) bool {
+		for _, p := range pairs {
+			if p == pair {
+				return true
+			}
+		}
+		return false
+	}
+	for _, pair := range next {
+		if !contains(prev, pair) {
+			added = append(added, pair)
+		}
+	}
+	for _, pair := range prev {
+		if !contains(next, pair) {
+			removed = append(removed, pair)
+		}
+	}
+	return added, removed
+}
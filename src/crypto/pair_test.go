@@ -67,3 +67,41 @@ func TestPair_String(t *testing.T) {
 		assert.Equal(t, testCase.expected, str)
 	}
 }
+
+func TestParsePair(t *testing.T) {
+	cases := []struct {
+		actual     string
+		delimiters []rune
+		expected   string
+		hasError   bool
+	}{
+		{"btc-usd", nil, "BTC-USD", false},
+		{"ETH/BTC", []rune{'/'}, "ETH-BTC", false},
+		{"ETH/BTC", nil, "", true},
+		{"BTC-USD-EUR", nil, "", true},
+		{"BTC-", nil, "", true},
+	}
+	for _, testCase := range cases {
+		pair, err := ParsePair(testCase.actual, testCase.delimiters...)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, pair.String())
+	}
+}
+
+func TestDiffPairs(t *testing.T) {
+	btc_usd, _ := NewPair("btc", "usd")
+	eth_usd, _ := NewPair("eth", "usd")
+	eth_btc, _ := NewPair("eth", "btc")
+
+	added, removed := DiffPairs([]Pair{btc_usd, eth_usd}, []Pair{eth_usd, eth_btc})
+	assert.Equal(t, []Pair{eth_btc}, added)
+	assert.Equal(t, []Pair{btc_usd}, removed)
+
+	added, removed = DiffPairs([]Pair{btc_usd}, []Pair{btc_usd})
+	assert.Empty(t, added)
+	assert.Empty(t, removed)
+}
@@ -3,11 +3,30 @@ package crypto
 import "time"
 
 // Common struct for Tick exchange
+// T is time reported by exchange, Received is time the tick has been received from exchange, zero if unknown
+// Other fields are metadata reported by some exchanges, zero if exchange doesn't report them
 type Tick struct {
-	T   time.Time
-	P   Pair
-	Bid float64
-	Ask float64
+	T        time.Time
+	P        Pair
+	Bid      Decimal
+	Ask      Decimal
+	Received time.Time
+
+	// name of exchange the tick is fetched from, e.g. coinbase
+	ExchangeId string
+	// sequence number of exchange message
+	Sequence int64
+	// id, price and size of the last trade
+	TradeId int64
+	Price   Decimal
+	Size    Decimal
+	// volume of the last 24 hours
+	Volume24h Decimal
+	// sizes of best bid and best ask
+	BidSize Decimal
+	AskSize Decimal
+	// message of exchange the tick is parsed of, kept if exchanger is asked to
+	Raw []byte
 }
 
 // Returns pair in crypto.Pair
@@ -20,19 +39,41 @@ func (t Tick) Timestamp() time.Time {
 	return t.T
 }
 
-// Returns BestBid in float64
-func (t Tick) BestBid() (float64, error) {
+// Returns time the tick has been received from exchange
+func (t Tick) ReceiveTime() time.Time {
+	return t.Received
+}
+
+// Returns name of exchange the tick is fetched from, empty if unknown
+func (t Tick) Exchange() string {
+	return t.ExchangeId
+}
+
+// Returns BestBid in Decimal
+func (t Tick) BestBid() (Decimal, error) {
 	return t.Bid, nil
 }
 
-// Returns BestAsk in float64
-func (t Tick) BestAsk() (float64, error) {
+// Returns BestAsk in Decimal
+func (t Tick) BestAsk() (Decimal, error) {
 	return t.Ask, nil
 }
 
-// Wraps Ticker object to crypto.Tick object
+// Returns time ticker has been received from exchange if it's known, e.g. ticker has ReceiveTime() method
+func receiveTime(ticker interface{}) time.Time {
+	if r, ok := ticker.(interface{ ReceiveTime() time.Time }); ok {
+		return r.ReceiveTime()
+	}
+	return time.Time{}
+}
+
+// Wraps Ticker object to crypto.Tick object, Tick is returned as is with its metadata
 func WrapTicker(ticker Ticker) (tick Tick, err error) {
+	if t, ok := ticker.(Tick); ok {
+		return t, nil
+	}
 	tick.T = ticker.Timestamp()
+	tick.Received = receiveTime(ticker)
 	tick.P, err = ticker.Pair()
 	if err != nil {
 		return tick, err
@@ -47,3 +88,24 @@ func WrapTicker(ticker Ticker) (tick Tick, err error) {
 	}
 	return tick, nil
 }
+
+// Wraps FloatTicker object to crypto.Tick object, float64 prices are converted to Decimal
+func WrapFloatTicker(ticker FloatTicker) (tick Tick, err error) {
+	tick.T = ticker.Timestamp()
+	tick.Received = receiveTime(ticker)
+	tick.P, err = ticker.Pair()
+	if err != nil {
+		return tick, err
+	}
+	bid, err := ticker.BestBid()
+	if err != nil {
+		return tick, err
+	}
+	ask, err := ticker.BestAsk()
+	if err != nil {
+		return tick, err
+	}
+	tick.Bid = NewDecimalFromFloat(bid)
+	tick.Ask = NewDecimalFromFloat(ask)
+	return tick, nil
+}
@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"strconv"
 	"testing"
@@ -19,12 +20,12 @@ func (tick fTick) Pair() (Pair, error) {
 	return NewPair(tick.primary, tick.secondary)
 }
 
-func (tick fTick) BestBid() (float64, error) {
-	return strconv.ParseFloat(tick.bestBid, 64)
+func (tick fTick) BestBid() (Decimal, error) {
+	return NewDecimal(tick.bestBid)
 }
 
-func (tick fTick) BestAsk() (float64, error) {
-	return strconv.ParseFloat(tick.bestAsk, 64)
+func (tick fTick) BestAsk() (Decimal, error) {
+	return NewDecimal(tick.bestAsk)
 }
 func (tick fTick) Timestamp() time.Time {
 	return time.Unix(tick.timestamp, 0)
@@ -38,7 +39,7 @@ func TestWrapTicker(t *testing.T) {
 	}{
 		{
 			fakeTick: fTick{"btc", "usd", "1", "10", 1},
-			want:     Tick{P: Pair{primary: Currency{id: "BTC"}, secondary: Currency{id: "USD"}}, Bid: 1.0, Ask: 10.0, T: time.Unix(1, 0)},
+			want:     Tick{P: Pair{primary: Currency{id: "BTC"}, secondary: Currency{id: "USD"}}, Bid: MustDecimal("1"), Ask: MustDecimal("10"), T: time.Unix(1, 0)},
 			hasError: false,
 		},
 		{
@@ -72,6 +73,65 @@ func TestWrapTicker(t *testing.T) {
 		assert.Equal(t, testCase.want, tick)
 	}
 
+	// receive time and metadata of wrapped Tick are kept
+	want := Tick{T: time.Unix(1, 0), P: btcUsd(), Bid: MustDecimal("1"), Ask: MustDecimal("2"), Received: time.Unix(2, 0),
+		ExchangeId: "coinbase", Sequence: 42, TradeId: 7, Price: MustDecimal("1.5"), Raw: []byte(`{"type":"ticker"}`)}
+	tick, err := WrapTicker(want)
+	assert.NoError(t, err)
+	assert.Equal(t, want, tick)
+}
+
+// Returns BTC-USD pair
+func btcUsd() Pair {
+	return Pair{primary: Currency{id: "BTC"}, secondary: Currency{id: "USD"}}
+}
+
+// Former float64 based ticker
+type fFloatTick struct {
+	fTick
+}
+
+func (tick fFloatTick) BestBid() (float64, error) {
+	return strconv.ParseFloat(tick.bestBid, 64)
+}
+
+func (tick fFloatTick) BestAsk() (float64, error) {
+	return strconv.ParseFloat(tick.bestAsk, 64)
+}
+
+func TestWrapFloatTicker(t *testing.T) {
+	cases := []struct {
+		fakeTick fFloatTick
+		want     Tick
+		hasError bool
+	}{
+		{
+			fakeTick: fFloatTick{fTick{"btc", "usd", "0.00001234", "10", 1}},
+			want:     Tick{P: Pair{primary: Currency{id: "BTC"}, secondary: Currency{id: "USD"}}, Bid: MustDecimal("0.00001234"), Ask: MustDecimal("10"), T: time.Unix(1, 0)},
+			hasError: false,
+		},
+		{
+			fakeTick: fFloatTick{fTick{"", "usd", "1", "10", 0}},
+			hasError: true,
+		},
+		{
+			fakeTick: fFloatTick{fTick{"btc", "usd", "WRONG", "10", 1}},
+			hasError: true,
+		},
+		{
+			fakeTick: fFloatTick{fTick{"btc", "usd", "1", "WRONG", 1}},
+			hasError: true,
+		},
+	}
+	for _, testCase := range cases {
+		tick, err := WrapFloatTicker(testCase.fakeTick)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprint(testCase.want), fmt.Sprint(tick))
+	}
 }
 
 func TestTick_Pair(t *testing.T) {
@@ -93,8 +153,21 @@ func TestTick_Timestamp(t *testing.T) {
 	assert.Equal(t, expectedTimestamp, gotTimestamp)
 }
 
+func TestTick_ReceiveTime(t *testing.T) {
+	expectedReceived := time.Now()
+	tick := Tick{
+		Received: expectedReceived,
+	}
+	assert.Equal(t, expectedReceived, tick.ReceiveTime())
+}
+
+func TestTick_Exchange(t *testing.T) {
+	assert.Equal(t, "", Tick{}.Exchange())
+	assert.Equal(t, "coinbase", Tick{ExchangeId: "coinbase"}.Exchange())
+}
+
 func TestTick_BestAsk(t *testing.T) {
-	expectedAsk := 123.2
+	expectedAsk := MustDecimal("123.2")
 	tick := Tick{
 		Ask: expectedAsk,
 	}
@@ -104,7 +177,7 @@ func TestTick_BestAsk(t *testing.T) {
 }
 
 func TestTick_BestBid(t *testing.T) {
-	expectedBid := 123.2
+	expectedBid := MustDecimal("123.2")
 	tick := Tick{
 		Bid: expectedBid,
 	}
@@ -4,6 +4,15 @@ import "time"
 
 // Ticker interface is used to provide information from different Exchanges
 type Ticker interface {
+	Pair() (Pair, error)
+	BestBid() (Decimal, error)
+	BestAsk() (Decimal, error)
+	Timestamp() time.Time
+}
+
+// FloatTicker is the former float64 based Ticker interface
+// Deprecated: implement Ticker, FloatTicker is kept as migration path and can be wrapped by WrapFloatTicker
+type FloatTicker interface {
 	Pair() (Pair, error)
 	BestBid() (float64, error)
 	BestAsk() (float64, error)
@@ -0,0 +1,29 @@
+package crypto
+
+import "time"
+
+// Trade is a common struct for executed trade on exchange
+// Side is side of maker order: Bid if maker was buying, Ask if selling
+type Trade struct {
+	T            time.Time
+	P            Pair
+	Id           string
+	Price        Decimal
+	Size         Decimal
+	Side         Side
+	MakerOrderId string
+	TakerOrderId string
+
+	// name of exchange the trade is fetched from, e.g. coinbase
+	ExchangeId string
+}
+
+// Returns name of exchange the trade is fetched from, empty if unknown
+func (t Trade) Exchange() string {
+	return t.ExchangeId
+}
+
+// Returns quote volume of Trade (price * size)
+func (t Trade) Volume() Decimal {
+	return t.Price.Mul(t.Size)
+}
@@ -0,0 +1,28 @@
+package crypto
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTrade_Volume(t *testing.T) {
+	cases := []struct {
+		price    string
+		size     string
+		expected string
+	}{
+		{"100", "0.5", "50.0"},
+		{"100", "0", "0"},
+		{"0.25", "4", "1.00"},
+		{"0.00001234", "10000", "0.12340000"},
+	}
+	for _, testCase := range cases {
+		trade := Trade{Price: MustDecimal(testCase.price), Size: MustDecimal(testCase.size)}
+		assert.Equal(t, testCase.expected, trade.Volume().String())
+	}
+}
+
+func TestTrade_Exchange(t *testing.T) {
+	assert.Equal(t, "", Trade{}.Exchange())
+	assert.Equal(t, "bitstamp", Trade{ExchangeId: "bitstamp"}.Exchange())
+}
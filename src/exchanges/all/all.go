@@ -0,0 +1,14 @@
+// Package all registers every exchange adapter of crypto-fetcher in exchanges registry
+// Import it for side effects:
+//
+//	import _ "github.com/Sn0w1eo/crypto-fetcher/src/exchanges/all"
+package all
+
+import (
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/exchanges/binance"
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/exchanges/bitfinex"
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/exchanges/bitstamp"
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/exchanges/coinbase"
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/exchanges/gemini"
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/exchanges/kraken"
+)
@@ -0,0 +1,475 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/gorilla/websocket"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Name of exchange, ticks are marked by it
+const exchangeName = "binance"
+
+// Default URL of Binance combined streams
+const BinanceWS_URL = "wss://stream.binance.com:9443/stream"
+
+// Default URL of Binance REST API, used for symbol metadata
+const BinanceAPI_URL = "https://api.binance.com"
+
+// Binance drops every connection after 24 hours, connection is replaced in advance
+const DefaultConnLifetime = 23*time.Hour + 30*time.Minute
+
+// Timeout of exchange info request
+const apiTimeout = 10 * time.Second
+
+// BinanceWS is used for WebSocket Protocol. Streams best bid and ask of pairs by bookTicker
+type BinanceWS struct {
+	tick chan crypto.Tick
+
+	pairs exchanges.Pairs
+
+	// symbol metadata, loaded on Dial if not set
+	symbols *Symbols
+	apiURL  string
+
+	conn *websocket.Conn
+	url  string
+
+	// connection supports one concurrent writer only, guards conn replacement too
+	writeMu sync.Mutex
+	// id of the last subscription request
+	requestId int64
+
+	// connection is replaced after lifetime to avoid forced disconnect
+	lifetime time.Duration
+
+	// reconnect policy and chan of reconnect events for caller
+	policy reconnect.Policy
+	events reconnect.Events
+
+	// stop signal, Stop may be invoked before Serve
+	stopper lifecycle.Stopper
+
+	logger *log.Logger
+}
+
+// Registers binance for WebSocket protocol
+func init() {
+	exchanges.Register(exchangeName, exchanges.WebSocket, func() exchanges.Exchanger {
+		return NewWS()
+	}, exchanges.TickerChannel)
+}
+
+// Creates new Binance Exchanger for WebSocket protocol
+func NewWS() *BinanceWS {
+	b := new(BinanceWS)
+	b.url = BinanceWS_URL
+	b.apiURL = BinanceAPI_URL
+	b.lifetime = DefaultConnLifetime
+	b.policy = reconnect.DefaultPolicy
+	return b
+}
+
+// Sets URL of combined streams, BinanceWS_URL is used by default
+func (b *BinanceWS) SetURL(url string) {
+	b.url = url
+}
+
+// Sets base URL of REST API which provides symbol metadata, BinanceAPI_URL is used by default
+func (b *BinanceWS) SetAPIURL(url string) {
+	b.apiURL = strings.TrimSuffix(url, "/")
+}
+
+// Sets symbol metadata, exchange info isn't requested on Dial then
+func (b *BinanceWS) SetSymbols(symbols *Symbols) {
+	b.symbols = symbols
+}
+
+// Sets time after which connection is replaced by a new one
+// Returns error if lifetime isn't positive
+func (b *BinanceWS) SetConnLifetime(lifetime time.Duration) error {
+	if lifetime <= 0 {
+		return fmt.Errorf("connection lifetime should be positive: %s", lifetime)
+	}
+	b.lifetime = lifetime
+	return nil
+}
+
+// Sets reconnect.Policy which is used when connection is lost
+// Returns error if policy isn't valid
+func (b *BinanceWS) SetReconnectPolicy(policy reconnect.Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	b.policy = policy
+	return nil
+}
+
+// Returns chan of reconnect.Event
+// Events are dropped if nobody reads the chan
+func (b *BinanceWS) Events() <-chan reconnect.Event {
+	return b.events.Chan()
+}
+
+// Sends event to events chan without blocking and logs it
+func (b *BinanceWS) emit(event reconnect.Event) {
+	b.log(b.events.Emit(event))
+}
+
+// Simple log function
+func (b *BinanceWS) log(v interface{}) {
+	if b.logger != nil {
+		b.logger.Println(v)
+	}
+}
+
+// Sets logger as io.Writer interface
+func (b *BinanceWS) SetLogger(w io.Writer) {
+	b.logger = log.New(w, "", log.Ldate|log.Ltime)
+}
+
+// Sets slice of crypto.Pair, will be used for subscribe later on
+func (b *BinanceWS) SetPairs(pairs ...crypto.Pair) error {
+	return b.pairs.Set(pairs...)
+}
+
+// Returns chan of crypto.Tick built out of bookTicker stream
+func (b *BinanceWS) Ticker() <-chan crypto.Tick {
+	if b.tick == nil {
+		b.tick = make(chan crypto.Tick, 1)
+	}
+	return b.tick
+}
+
+// Closes tick chan if it has been requested
+func (b *BinanceWS) closeChannels() {
+	if b.tick != nil {
+		close(b.tick)
+		b.tick = nil
+	}
+}
+
+// Stops Exchanger, Serve returns lifecycle.StopError with UserStop reason
+// Safe to invoke several times and before Serve. Logs reason of the first stop
+func (b *BinanceWS) Stop(reason interface{}) {
+	if b.stopper.Stop(lifecycle.UserStop, reason, nil) && reason != nil {
+		b.log(reason)
+	}
+}
+
+// Requests exchange info and returns symbol metadata
+func (b *BinanceWS) fetchSymbols(ctx context.Context) (*Symbols, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.apiURL+"/api/v3/exchangeInfo", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Timeout: apiTimeout}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status of exchange info: %s", resp.Status)
+	}
+	return parseExchangeInfo(resp.Body)
+}
+
+// Loads symbol metadata if needed and dials to predefined URL
+// Returns error is Dial to server failed
+func (b *BinanceWS) Dial() error {
+	return b.DialContext(context.Background())
+}
+
+// Loads symbol metadata if needed and dials to predefined URL, ctx limits time of both
+// Returns error is Dial to server failed or Exchanger has been stopped
+func (b *BinanceWS) DialContext(ctx context.Context) error {
+	if b.symbols == nil {
+		symbols, err := b.fetchSymbols(ctx)
+		if err != nil {
+			b.log(err)
+			return err
+		}
+		b.symbols = symbols
+	}
+	conn, err := b.dial(ctx)
+	if err != nil {
+		return err
+	}
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	// ServeContext closes connection on stop under writeMu, don't leak the one dialed after it
+	if b.stopper.Stopped() {
+		_ = conn.Close()
+		return fmt.Errorf("exchanger has been stopped")
+	}
+	b.conn = conn
+	return nil
+}
+
+// Dials new connection without replacing current one
+func (b *BinanceWS) dial(ctx context.Context) (*websocket.Conn, error) {
+	if b.url == "" {
+		b.url = BinanceWS_URL
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, b.url, nil)
+	if err != nil {
+		b.log(err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Returns current connection
+func (b *BinanceWS) currentConn() *websocket.Conn {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	return b.conn
+}
+
+// Closes connection if it's established
+func (b *BinanceWS) closeConn() {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	if b.conn != nil {
+		_ = b.conn.Close()
+	}
+}
+
+// Returns stream names of pairs
+// Returns error if some pair isn't listed
+func (b *BinanceWS) streams(pairs []crypto.Pair) ([]string, error) {
+	if b.symbols == nil {
+		return nil, fmt.Errorf("symbols aren't loaded, Dial() should be invoked first")
+	}
+	streams := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		symbol, err := b.symbols.Symbol(pair)
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, streamName(symbol))
+	}
+	return streams, nil
+}
+
+// Binance subscription request format
+type subscribeRequest struct {
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+	Id     int64    `json:"id"`
+}
+
+// Sends SUBSCRIBE or UNSUBSCRIBE request of pairs over conn
+// Important: caller should hold writeMu if conn is shared
+func (b *BinanceWS) send(conn *websocket.Conn, method string, pairs []crypto.Pair) error {
+	streams, err := b.streams(pairs)
+	if err != nil {
+		return err
+	}
+	r := subscribeRequest{
+		Method: method,
+		Params: streams,
+		Id:     atomic.AddInt64(&b.requestId, 1),
+	}
+	if err = conn.WriteJSON(r); err != nil {
+		b.log(fmt.Errorf("WriteJSON failed: %s. message: %v", err.Error(), r))
+	}
+	return err
+}
+
+// Subscribes current pairs over current connection
+func (b *BinanceWS) subscribe() error {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	if b.conn == nil {
+		return fmt.Errorf("connection isn't established")
+	}
+	return b.send(b.conn, "SUBSCRIBE", b.pairs.Get())
+}
+
+// Replaces pairs without dropping connection
+// Sends UNSUBSCRIBE for removed pairs and SUBSCRIBE for added ones if connection is established
+func (b *BinanceWS) UpdatePairs(pairs ...crypto.Pair) error {
+	if b.symbols != nil {
+		if _, err := b.streams(pairs); err != nil {
+			return err
+		}
+	}
+	prev := b.pairs.Get()
+	if err := b.SetPairs(pairs...); err != nil {
+		return err
+	}
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	if b.conn == nil {
+		return nil
+	}
+	added, removed := crypto.DiffPairs(prev, pairs)
+	if len(removed) > 0 {
+		if err := b.send(b.conn, "UNSUBSCRIBE", removed); err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		return b.send(b.conn, "SUBSCRIBE", added)
+	}
+	return nil
+}
+
+// Replaces connection by a new subscribed one before Binance drops it
+// Current connection is kept if new one failed, it's restored by reconnect later on
+func (b *BinanceWS) rotate() {
+	conn, err := b.dial(context.Background())
+	if err != nil {
+		return
+	}
+	if err = b.send(conn, "SUBSCRIBE", b.pairs.Get()); err != nil {
+		_ = conn.Close()
+		return
+	}
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	if b.stopper.Stopped() {
+		_ = conn.Close()
+		return
+	}
+	old := b.conn
+	b.conn = conn
+	if old != nil {
+		_ = old.Close()
+	}
+	b.log("connection replaced after " + b.lifetime.String())
+}
+
+// Redials and resubscribes according to reconnect.Policy
+// Returns false if stop has been requested or policy doesn't allow more attempts
+func (b *BinanceWS) reconnect(reason error) bool {
+	return reconnect.Loop{
+		Policy:    b.policy,
+		Dial:      b.Dial,
+		Subscribe: b.subscribe,
+		Close:     b.closeConn,
+		Emit:      b.emit,
+	}.Run(b.stopper.Done(), reason)
+}
+
+// Reader is invoked by ServeContext method
+// Reader starts read message out of connection and sends ticks to tick chan
+// Returns when stopper is stopped
+// Replaced connection is switched silently, on connection lost tries to reconnect
+// Stops with lifecycle.RemoteClose if reconnect failed, lifecycle.ProtocolError if Binance sent error
+func (b *BinanceWS) reader(stopper *lifecycle.Stopper) {
+	for !stopper.Stopped() {
+		conn := b.currentConn()
+		_, msg, err := conn.ReadMessage()
+		received := time.Now().UTC()
+		if err != nil {
+			if stopper.Stopped() || b.currentConn() != conn {
+				continue
+			}
+			if !b.reconnect(err) {
+				stopper.Stop(lifecycle.RemoteClose, "connection closed", err)
+			}
+			continue
+		}
+		m, err := parseMessage(msg)
+		if err != nil {
+			var apiErr *apiError
+			if errors.As(err, &apiErr) {
+				stopper.Stop(lifecycle.ProtocolError, nil, err)
+			}
+			b.log(err)
+			continue
+		}
+		if !strings.HasSuffix(m.Stream, "@"+bookTickerStreamName) {
+			// subscription responses and unknown streams
+			continue
+		}
+		tick, err := parseBookTicker(m.Data, b.symbols, received)
+		if err != nil {
+			b.log(err)
+			continue
+		}
+		tick.Received = received
+		select {
+		case b.tick <- tick:
+		case <-stopper.Done():
+		}
+	}
+}
+
+// Returns error if some of required fields hasn't been initialized
+func (b *BinanceWS) isValidSetup() error {
+	if len(b.pairs.Get()) == 0 {
+		return fmt.Errorf("pairs aren't set")
+	}
+	if b.tick == nil {
+		return fmt.Errorf("channels aren't set")
+	}
+	if b.currentConn() == nil {
+		return fmt.Errorf("Dial() should be invoked before Serve()")
+	}
+	return nil
+}
+
+// Serve subscribes pairs and starts reader. And waits for stop to finish
+// Returns error if setup isn't valid or Exchanger has been stopped not by Stop()
+func (b *BinanceWS) Serve() error {
+	err := b.ServeContext(context.Background())
+	if lifecycle.ReasonOf(err) == lifecycle.UserStop {
+		return nil
+	}
+	return err
+}
+
+// ServeContext subscribes pairs and starts reader. And waits for stop or ctx to finish
+// Connection is replaced every lifetime. Closes connection and tick chan on return
+// Returns error if setup isn't valid, otherwise *lifecycle.StopError describing why Exchanger has stopped
+func (b *BinanceWS) ServeContext(ctx context.Context) error {
+	err := b.isValidSetup()
+	if err != nil {
+		b.log(err)
+		b.closeChannels()
+		return err
+	}
+
+	err = b.subscribe()
+	if err != nil {
+		b.closeChannels()
+		return err
+	}
+
+	stopper := &b.stopper
+	go stopper.Watch(ctx)
+	finished := make(chan struct{})
+	go func() {
+		b.reader(stopper)
+		close(finished)
+	}()
+
+	rotation := time.NewTicker(b.lifetime)
+	defer rotation.Stop()
+	for !stopper.Stopped() {
+		select {
+		case <-rotation.C:
+			b.rotate()
+		case <-stopper.Done():
+		}
+	}
+	// unblocks reader waiting for message
+	b.closeConn()
+	<-finished
+	b.closeChannels()
+	return stopper.Err()
+}
@@ -0,0 +1,336 @@
+package binance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Starts local REST server which responds with exchange info fixture
+func newAPIServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/exchangeInfo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(exchangeInfoFixture))
+	})
+	return httptest.NewServer(mux)
+}
+
+// Starts local websocket server which invokes handler on each new connection
+func newWSServer(t *testing.T, handler func(conn *websocket.Conn, n int)) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	var n int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		handler(conn, int(atomic.AddInt32(&n, 1)))
+	}))
+}
+
+// Returns bookTicker message of ETHBTC with bid n
+func bookTickerMsg(n int) []byte {
+	return []byte(fmt.Sprintf(`{"stream":"ethbtc@bookTicker","data":{"u":%d,"s":"ETHBTC","b":"%d","B":"1","a":"100","A":"1"}}`, n, n))
+}
+
+// Reads subscription request, acknowledges it and sends bookTicker of connection number
+// Keeps connection open until client goes away
+func streaming(subscribed chan<- subscribeRequest) func(conn *websocket.Conn, n int) {
+	return func(conn *websocket.Conn, n int) {
+		r := subscribeRequest{}
+		if err := conn.ReadJSON(&r); err != nil {
+			return
+		}
+		if subscribed != nil {
+			subscribed <- r
+		}
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"result":null,"id":%d}`, r.Id)))
+		_ = conn.WriteMessage(websocket.TextMessage, bookTickerMsg(n))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Creates BinanceWS connected to local servers
+func newTestWS(t *testing.T, api, ws *httptest.Server, pairs ...crypto.Pair) *BinanceWS {
+	b := NewWS()
+	b.SetAPIURL(api.URL)
+	b.SetURL("ws" + strings.TrimPrefix(ws.URL, "http"))
+	assert.NoError(t, b.SetPairs(pairs...))
+	return b
+}
+
+// Waits for Serve result and checks tick chan is closed
+func wait(t *testing.T, ticks <-chan crypto.Tick, served <-chan error) error {
+	select {
+	case err := <-served:
+		for range ticks {
+		}
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve hasn't returned")
+		return nil
+	}
+}
+
+// Waits for tick and returns it
+func nextTick(t *testing.T, ticks <-chan crypto.Tick) crypto.Tick {
+	select {
+	case tick, ok := <-ticks:
+		assert.True(t, ok)
+		return tick
+	case <-time.After(5 * time.Second):
+		t.Fatal("tick hasn't been received")
+		return crypto.Tick{}
+	}
+}
+
+func TestNewWS(t *testing.T) {
+	b := NewWS()
+	assert.Equal(t, BinanceWS_URL, b.url)
+	assert.Equal(t, BinanceAPI_URL, b.apiURL)
+	assert.Equal(t, DefaultConnLifetime, b.lifetime)
+	assert.Equal(t, reconnect.DefaultPolicy, b.policy)
+
+	assert.Error(t, b.SetConnLifetime(0))
+	assert.NoError(t, b.SetConnLifetime(time.Hour))
+	assert.Error(t, b.SetReconnectPolicy(reconnect.Policy{Jitter: 2}))
+	assert.Error(t, b.SetPairs())
+}
+
+func TestBinanceWS_Dial(t *testing.T) {
+	eth_btc, _ := crypto.NewPair("eth", "btc")
+	api := newAPIServer()
+	defer api.Close()
+	ws := newWSServer(t, streaming(nil))
+	defer ws.Close()
+
+	b := newTestWS(t, api, ws, eth_btc)
+	assert.NoError(t, b.Dial())
+	assert.Equal(t, 2, b.symbols.Len())
+
+	b = newTestWS(t, api, ws, eth_btc)
+	b.SetAPIURL(api.URL + "/wrong")
+	assert.Error(t, b.Dial())
+
+	b = newTestWS(t, api, ws, eth_btc)
+	b.SetSymbols(NewSymbols(map[string]crypto.Pair{"ETHBTC": eth_btc}))
+	b.SetAPIURL(api.URL + "/wrong")
+	assert.NoError(t, b.Dial())
+}
+
+func TestBinanceWS_ServeContext(t *testing.T) {
+	eth_btc, _ := crypto.NewPair("eth", "btc")
+	btc_usdt, _ := crypto.NewPair("btc", "usdt")
+	api := newAPIServer()
+	defer api.Close()
+
+	t.Run("closes tick chan if subscribe failed", func(t *testing.T) {
+		b := NewWS()
+		assert.NoError(t, b.SetPairs(eth_btc))
+		ticks := b.Ticker()
+		assert.Error(t, b.ServeContext(context.Background()))
+		_, ok := <-ticks
+		assert.False(t, ok)
+	})
+
+	t.Run("subscribes bookTicker and streams ticks until context cancel", func(t *testing.T) {
+		subscribed := make(chan subscribeRequest, 1)
+		ws := newWSServer(t, streaming(subscribed))
+		defer ws.Close()
+
+		b := newTestWS(t, api, ws, eth_btc, btc_usdt)
+		ticks := b.Ticker()
+		ctx, cancel := context.WithCancel(context.Background())
+		assert.NoError(t, b.DialContext(ctx))
+		served := make(chan error, 1)
+		go func() {
+			served <- b.ServeContext(ctx)
+		}()
+
+		r := <-subscribed
+		assert.Equal(t, "SUBSCRIBE", r.Method)
+		assert.Equal(t, []string{"ethbtc@bookTicker", "btcusdt@bookTicker"}, r.Params)
+		tick := nextTick(t, ticks)
+		assert.Equal(t, eth_btc, tick.P)
+		assert.Equal(t, "1", tick.Bid.String())
+		assert.Equal(t, "100", tick.Ask.String())
+
+		cancel()
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.ContextDone, lifecycle.ReasonOf(err))
+		b.Stop("late stop")
+	})
+
+	t.Run("replaces connection before forced disconnect", func(t *testing.T) {
+		ws := newWSServer(t, streaming(nil))
+		defer ws.Close()
+
+		b := newTestWS(t, api, ws, eth_btc)
+		assert.NoError(t, b.SetConnLifetime(50*time.Millisecond))
+		events := b.Events()
+		ticks := b.Ticker()
+		assert.NoError(t, b.Dial())
+		served := make(chan error, 1)
+		go func() {
+			served <- b.Serve()
+		}()
+
+		// every connection sends bookTicker with bid of its number
+		for i := 1; i <= 3; i++ {
+			assert.Equal(t, fmt.Sprint(i), nextTick(t, ticks).Bid.String())
+		}
+		b.Stop("user stopped")
+		b.Stop("user stopped again")
+		assert.NoError(t, wait(t, ticks, served))
+		assert.Empty(t, events)
+	})
+
+	t.Run("reconnects after remote close and gives up", func(t *testing.T) {
+		// accepts two connections only, every connection is closed after bookTicker
+		upgrader := websocket.Upgrader{}
+		var n int32
+		ws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&n, 1)
+			if n > 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			_ = conn.WriteMessage(websocket.TextMessage, bookTickerMsg(int(n)))
+			_ = conn.Close()
+		}))
+		defer ws.Close()
+
+		b := newTestWS(t, api, ws, eth_btc)
+		assert.NoError(t, b.SetReconnectPolicy(reconnect.Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxAttempts: 1}))
+		ticks := b.Ticker()
+		assert.NoError(t, b.Dial())
+		served := make(chan error, 1)
+		go func() {
+			served <- b.Serve()
+		}()
+
+		assert.Equal(t, "1", nextTick(t, ticks).Bid.String())
+		assert.Equal(t, "2", nextTick(t, ticks).Bid.String())
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.RemoteClose, lifecycle.ReasonOf(err))
+	})
+
+	t.Run("error response stops with protocol error", func(t *testing.T) {
+		ws := newWSServer(t, func(conn *websocket.Conn, n int) {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"code":2,"msg":"Invalid request"}`))
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		})
+		defer ws.Close()
+
+		b := newTestWS(t, api, ws, eth_btc)
+		ticks := b.Ticker()
+		assert.NoError(t, b.Dial())
+		served := make(chan error, 1)
+		go func() {
+			served <- b.Serve()
+		}()
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.ProtocolError, lifecycle.ReasonOf(err))
+		var apiErr *apiError
+		assert.True(t, errors.As(err, &apiErr))
+	})
+
+	t.Run("Serve returns error on invalid setup", func(t *testing.T) {
+		ws := newWSServer(t, streaming(nil))
+		defer ws.Close()
+
+		b := NewWS()
+		assert.Error(t, b.Serve())
+		b = newTestWS(t, api, ws, eth_btc)
+		assert.Error(t, b.Serve())
+		b.Ticker()
+		assert.Error(t, b.Serve())
+
+		// pair isn't listed
+		bcc_btc, _ := crypto.NewPair("bcc", "btc")
+		b = newTestWS(t, api, ws, bcc_btc)
+		b.Ticker()
+		assert.NoError(t, b.Dial())
+		assert.Error(t, b.Serve())
+	})
+}
+
+func TestBinanceWS_UpdatePairs(t *testing.T) {
+	eth_btc, _ := crypto.NewPair("eth", "btc")
+	btc_usdt, _ := crypto.NewPair("btc", "usdt")
+	bcc_btc, _ := crypto.NewPair("bcc", "btc")
+	api := newAPIServer()
+	defer api.Close()
+
+	t.Run("replaces pairs if connection isn't established", func(t *testing.T) {
+		b := NewWS()
+		assert.NoError(t, b.UpdatePairs(bcc_btc))
+		assert.Equal(t, []crypto.Pair{bcc_btc}, b.pairs.Get())
+		assert.Error(t, b.UpdatePairs())
+	})
+
+	t.Run("unsubscribes removed pairs and subscribes added ones", func(t *testing.T) {
+		received := make(chan subscribeRequest, 3)
+		ws := newWSServer(t, func(conn *websocket.Conn, n int) {
+			for {
+				r := subscribeRequest{}
+				if err := conn.ReadJSON(&r); err != nil {
+					return
+				}
+				received <- r
+			}
+		})
+		defer ws.Close()
+
+		b := newTestWS(t, api, ws, eth_btc)
+		assert.NoError(t, b.Dial())
+		assert.NoError(t, b.subscribe())
+		assert.Error(t, b.UpdatePairs(bcc_btc))
+		assert.NoError(t, b.UpdatePairs(btc_usdt))
+
+		expected := []subscribeRequest{
+			{Method: "SUBSCRIBE", Params: []string{"ethbtc@bookTicker"}, Id: 1},
+			{Method: "UNSUBSCRIBE", Params: []string{"ethbtc@bookTicker"}, Id: 2},
+			{Method: "SUBSCRIBE", Params: []string{"btcusdt@bookTicker"}, Id: 3},
+		}
+		for _, e := range expected {
+			select {
+			case r := <-received:
+				assert.Equal(t, e, r)
+			case <-time.After(5 * time.Second):
+				t.Fatal("message hasn't been received")
+			}
+		}
+		assert.Equal(t, []crypto.Pair{btc_usdt}, b.pairs.Get())
+	})
+}
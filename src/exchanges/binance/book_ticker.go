@@ -0,0 +1,87 @@
+package binance
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"strings"
+	"time"
+)
+
+// Stream name of best bid and ask updates according to Binance API
+const bookTickerStreamName = "bookTicker"
+
+// Combined stream message and subscription response format provided by Binance API
+// Either Stream and Data or Id and Result are set, Code and Msg or Error are set on failure
+type combinedMessage struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+	Id     *int64          `json:"id"`
+	Code   int             `json:"code"`
+	Msg    string          `json:"msg"`
+	Error  *apiError       `json:"error"`
+}
+
+// Error format of Binance websocket API
+type apiError struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("error received: code %d, %s", e.Code, e.Msg)
+}
+
+// Binance bookTicker payload
+type bookTicker struct {
+	UpdateId int64  `json:"u"`
+	Symbol   string `json:"s"`
+	Bid      string `json:"b"`
+	BidSize  string `json:"B"`
+	Ask      string `json:"a"`
+	AskSize  string `json:"A"`
+}
+
+// Returns stream name of symbol, e.g. ethbtc@bookTicker
+func streamName(symbol string) string {
+	return strings.ToLower(symbol) + "@" + bookTickerStreamName
+}
+
+// Parses combined stream message
+// Returns *apiError if Binance sent error response
+func parseMessage(msg []byte) (m combinedMessage, err error) {
+	if err = json.Unmarshal(msg, &m); err != nil {
+		return m, fmt.Errorf("wrong message format, unable to decode: %s", err)
+	}
+	if m.Error != nil {
+		return m, m.Error
+	}
+	if m.Msg != "" {
+		return m, &apiError{Code: m.Code, Msg: m.Msg}
+	}
+	return m, nil
+}
+
+// Parses bookTicker payload and converts it to crypto.Tick
+// Binance doesn't send time of bookTicker, receive time t is used
+func parseBookTicker(data []byte, symbols *Symbols, t time.Time) (tick crypto.Tick, err error) {
+	bt := bookTicker{}
+	if err = json.Unmarshal(data, &bt); err != nil {
+		return tick, fmt.Errorf("wrong bookTicker format, unable to decode: %s", err)
+	}
+	tick.P, err = symbols.Pair(bt.Symbol)
+	if err != nil {
+		return tick, err
+	}
+	tick.Bid, err = crypto.NewDecimal(bt.Bid)
+	if err != nil {
+		return tick, fmt.Errorf("bad bid of %s: %s", bt.Symbol, err)
+	}
+	tick.Ask, err = crypto.NewDecimal(bt.Ask)
+	if err != nil {
+		return tick, fmt.Errorf("bad ask of %s: %s", bt.Symbol, err)
+	}
+	tick.T = t
+	tick.ExchangeId = exchangeName
+	return tick, nil
+}
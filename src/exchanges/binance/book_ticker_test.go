@@ -0,0 +1,64 @@
+package binance
+
+import (
+	"errors"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_streamName(t *testing.T) {
+	assert.Equal(t, "ethbtc@bookTicker", streamName("ETHBTC"))
+}
+
+func Test_parseMessage(t *testing.T) {
+	m, err := parseMessage([]byte(`{"stream":"ethbtc@bookTicker","data":{"u":1}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "ethbtc@bookTicker", m.Stream)
+	assert.Equal(t, `{"u":1}`, string(m.Data))
+
+	m, err = parseMessage([]byte(`{"result":null,"id":1}`))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), *m.Id)
+
+	var apiErr *apiError
+	_, err = parseMessage([]byte(`{"code":2,"msg":"Invalid request: unknown variant"}`))
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, 2, apiErr.Code)
+
+	_, err = parseMessage([]byte(`{"error":{"code":1,"msg":"Invalid value type"},"id":2}`))
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "Invalid value type", apiErr.Msg)
+
+	_, err = parseMessage([]byte(`not json`))
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &apiErr))
+}
+
+func Test_parseBookTicker(t *testing.T) {
+	eth_btc, _ := crypto.NewPair("eth", "btc")
+	symbols := NewSymbols(map[string]crypto.Pair{"ETHBTC": eth_btc})
+	now := time.Unix(100, 0).UTC()
+
+	cases := []struct {
+		data     string
+		bid, ask string
+		hasError bool
+	}{
+		{`{"u":400900217,"s":"ETHBTC","b":"0.03151000","B":"31.21000000","a":"0.03152000","A":"40.66000000"}`, "0.03151000", "0.03152000", false},
+		{`{"u":1,"s":"BNBUSDT","b":"1","B":"1","a":"2","A":"1"}`, "", "", true},
+		{`{"u":1,"s":"ETHBTC","b":"bad","B":"1","a":"2","A":"1"}`, "", "", true},
+		{`{"u":1,"s":"ETHBTC","b":"1","B":"1","a":"","A":"1"}`, "", "", true},
+		{`[]`, "", "", true},
+	}
+	for _, testCase := range cases {
+		tick, err := parseBookTicker([]byte(testCase.data), symbols, now)
+		if testCase.hasError {
+			assert.Error(t, err, testCase.data)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, crypto.Tick{T: now, P: eth_btc, Bid: crypto.MustDecimal(testCase.bid), Ask: crypto.MustDecimal(testCase.ask), ExchangeId: "binance"}, tick)
+	}
+}
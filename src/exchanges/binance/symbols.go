@@ -0,0 +1,91 @@
+package binance
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"io"
+	"strings"
+)
+
+// Status of symbol which is open for trading
+const symbolStatusTrading = "TRADING"
+
+// Binance exchangeInfo response format, only fields required for symbol mapping
+type exchangeInfo struct {
+	Symbols []struct {
+		Symbol     string `json:"symbol"`
+		Status     string `json:"status"`
+		BaseAsset  string `json:"baseAsset"`
+		QuoteAsset string `json:"quoteAsset"`
+	} `json:"symbols"`
+}
+
+// Symbols maps Binance symbols without delimiter (e.g. ETHBTC) to crypto.Pair and back
+// Binance symbols can't be split by delimiter, so exchange metadata is required
+type Symbols struct {
+	pairs   map[string]crypto.Pair
+	symbols map[string]string
+}
+
+// Creates Symbols out of pairs by symbol
+func NewSymbols(pairs map[string]crypto.Pair) *Symbols {
+	s := &Symbols{
+		pairs:   make(map[string]crypto.Pair, len(pairs)),
+		symbols: make(map[string]string, len(pairs)),
+	}
+	for symbol, pair := range pairs {
+		symbol = strings.ToUpper(symbol)
+		s.pairs[symbol] = pair
+		s.symbols[pair.String()] = symbol
+	}
+	return s
+}
+
+// Parses exchangeInfo response, symbols which aren't trading are skipped
+func parseExchangeInfo(r io.Reader) (*Symbols, error) {
+	info := exchangeInfo{}
+	if err := json.NewDecoder(r).Decode(&info); err != nil {
+		return nil, fmt.Errorf("wrong exchange info format, unable to decode: %s", err)
+	}
+	pairs := make(map[string]crypto.Pair, len(info.Symbols))
+	for _, s := range info.Symbols {
+		if s.Status != symbolStatusTrading {
+			continue
+		}
+		pair, err := crypto.NewPair(s.BaseAsset, s.QuoteAsset)
+		if err != nil {
+			continue
+		}
+		pairs[s.Symbol] = pair
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("exchange info has no trading symbols")
+	}
+	return NewSymbols(pairs), nil
+}
+
+// Returns crypto.Pair of symbol, case insensitive
+// Returns error if symbol is unknown
+func (s *Symbols) Pair(symbol string) (crypto.Pair, error) {
+	pair, ok := s.pairs[strings.ToUpper(symbol)]
+	if !ok {
+		return pair, fmt.Errorf("unknown symbol: %s", symbol)
+	}
+	return pair, nil
+}
+
+// Returns Binance symbol of pair, e.g. ETHBTC
+// Returns error if pair isn't listed
+func (s *Symbols) Symbol(pair crypto.Pair) (string, error) {
+	symbol, ok := s.symbols[pair.String()]
+	if !ok {
+		return "", fmt.Errorf("pair isn't listed on binance: %s", pair.String())
+	}
+	return symbol, nil
+}
+
+// Returns number of known symbols
+func (s *Symbols) Len() int {
+	return len(s.pairs)
+}
@@ -0,0 +1,52 @@
+package binance
+
+import (
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const exchangeInfoFixture = `{"timezone":"UTC","symbols":[
+	{"symbol":"ETHBTC","status":"TRADING","baseAsset":"ETH","quoteAsset":"BTC"},
+	{"symbol":"BTCUSDT","status":"TRADING","baseAsset":"BTC","quoteAsset":"USDT"},
+	{"symbol":"BCCBTC","status":"BREAK","baseAsset":"BCC","quoteAsset":"BTC"}
+]}`
+
+func Test_parseExchangeInfo(t *testing.T) {
+	eth_btc, _ := crypto.NewPair("eth", "btc")
+	btc_usdt, _ := crypto.NewPair("btc", "usdt")
+	bcc_btc, _ := crypto.NewPair("bcc", "btc")
+
+	symbols, err := parseExchangeInfo(strings.NewReader(exchangeInfoFixture))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, symbols.Len())
+
+	pair, err := symbols.Pair("ETHBTC")
+	assert.NoError(t, err)
+	assert.Equal(t, eth_btc, pair)
+	pair, err = symbols.Pair("btcusdt")
+	assert.NoError(t, err)
+	assert.Equal(t, btc_usdt, pair)
+	_, err = symbols.Pair("BCCBTC")
+	assert.Error(t, err)
+
+	symbol, err := symbols.Symbol(eth_btc)
+	assert.NoError(t, err)
+	assert.Equal(t, "ETHBTC", symbol)
+	_, err = symbols.Symbol(bcc_btc)
+	assert.Error(t, err)
+
+	_, err = parseExchangeInfo(strings.NewReader(`{"symbols":[]}`))
+	assert.Error(t, err)
+	_, err = parseExchangeInfo(strings.NewReader(`not json`))
+	assert.Error(t, err)
+}
+
+func TestNewSymbols(t *testing.T) {
+	eth_btc, _ := crypto.NewPair("eth", "btc")
+	symbols := NewSymbols(map[string]crypto.Pair{"ethbtc": eth_btc})
+	symbol, err := symbols.Symbol(eth_btc)
+	assert.NoError(t, err)
+	assert.Equal(t, "ETHBTC", symbol)
+}
@@ -0,0 +1,458 @@
+package bitfinex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/gorilla/websocket"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Name of exchange, ticks are marked by it
+const exchangeName = "bitfinex"
+
+// Default URL of Bitfinex public WS API
+const BitfinexWS_URL = "wss://api-pub.bitfinex.com/ws/2"
+
+// Bitfinex sends heartbeat every 15 seconds, connection is considered dead after timeout
+const DefaultHeartbeatTimeout = 30 * time.Second
+
+// BitfinexWS is used for WebSocket Protocol. Streams best bid and ask of pairs by ticker channel
+type BitfinexWS struct {
+	tick chan crypto.Tick
+
+	pairs exchanges.Pairs
+
+	// channel id to pair routing table, filled by subscribed events, reset on reconnect
+	routes   map[int64]crypto.Pair
+	routesMu sync.Mutex
+
+	// unix nanos of the last received message
+	lastSeen         int64
+	heartbeatTimeout time.Duration
+
+	conn *websocket.Conn
+	url  string
+
+	// connection supports one concurrent writer only, guards conn replacement too
+	writeMu sync.Mutex
+
+	// reconnect policy and chan of reconnect events for caller
+	policy reconnect.Policy
+	events reconnect.Events
+
+	// stop signal, Stop may be invoked before Serve
+	stopper lifecycle.Stopper
+
+	logger *log.Logger
+}
+
+// Registers bitfinex for WebSocket protocol
+func init() {
+	exchanges.Register(exchangeName, exchanges.WebSocket, func() exchanges.Exchanger {
+		return NewWS()
+	}, exchanges.TickerChannel)
+}
+
+// Creates new Bitfinex Exchanger for WebSocket protocol
+func NewWS() *BitfinexWS {
+	b := new(BitfinexWS)
+	b.url = BitfinexWS_URL
+	b.heartbeatTimeout = DefaultHeartbeatTimeout
+	b.policy = reconnect.DefaultPolicy
+	return b
+}
+
+// Sets URL of websocket server, BitfinexWS_URL is used by default
+func (b *BitfinexWS) SetURL(url string) {
+	b.url = url
+}
+
+// Sets time of silence after which connection is dropped and reconnected
+// Returns error if timeout isn't positive
+func (b *BitfinexWS) SetHeartbeatTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return fmt.Errorf("heartbeat timeout should be positive: %s", timeout)
+	}
+	b.heartbeatTimeout = timeout
+	return nil
+}
+
+// Sets reconnect.Policy which is used when connection is lost
+// Returns error if policy isn't valid
+func (b *BitfinexWS) SetReconnectPolicy(policy reconnect.Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	b.policy = policy
+	return nil
+}
+
+// Returns chan of reconnect.Event
+// Events are dropped if nobody reads the chan
+func (b *BitfinexWS) Events() <-chan reconnect.Event {
+	return b.events.Chan()
+}
+
+// Sends event to events chan without blocking and logs it
+func (b *BitfinexWS) emit(event reconnect.Event) {
+	b.log(b.events.Emit(event))
+}
+
+// Simple log function
+func (b *BitfinexWS) log(v interface{}) {
+	if b.logger != nil {
+		b.logger.Println(v)
+	}
+}
+
+// Sets logger as io.Writer interface
+func (b *BitfinexWS) SetLogger(w io.Writer) {
+	b.logger = log.New(w, "", log.Ldate|log.Ltime)
+}
+
+// Sets slice of crypto.Pair, will be used for subscribe later on
+func (b *BitfinexWS) SetPairs(pairs ...crypto.Pair) error {
+	return b.pairs.Set(pairs...)
+}
+
+// Returns chan of crypto.Tick
+func (b *BitfinexWS) Ticker() <-chan crypto.Tick {
+	if b.tick == nil {
+		b.tick = make(chan crypto.Tick, 1)
+	}
+	return b.tick
+}
+
+// Closes tick chan if it has been requested
+func (b *BitfinexWS) closeChannels() {
+	if b.tick != nil {
+		close(b.tick)
+		b.tick = nil
+	}
+}
+
+// Adds route of channel id to pair
+func (b *BitfinexWS) addRoute(chanId int64, pair crypto.Pair) {
+	b.routesMu.Lock()
+	defer b.routesMu.Unlock()
+	if b.routes == nil {
+		b.routes = make(map[int64]crypto.Pair)
+	}
+	b.routes[chanId] = pair
+}
+
+// Returns pair of channel id
+func (b *BitfinexWS) route(chanId int64) (crypto.Pair, bool) {
+	b.routesMu.Lock()
+	defer b.routesMu.Unlock()
+	pair, ok := b.routes[chanId]
+	return pair, ok
+}
+
+// Removes routes of pairs and returns their channel ids
+func (b *BitfinexWS) removeRoutes(pairs []crypto.Pair) (chanIds []int64) {
+	b.routesMu.Lock()
+	defer b.routesMu.Unlock()
+	for chanId, routed := range b.routes {
+		for _, pair := range pairs {
+			if routed == pair {
+				chanIds = append(chanIds, chanId)
+				delete(b.routes, chanId)
+			}
+		}
+	}
+	return chanIds
+}
+
+// Removes all routes, channel ids aren't valid after reconnect
+func (b *BitfinexWS) resetRoutes() {
+	b.routesMu.Lock()
+	defer b.routesMu.Unlock()
+	b.routes = nil
+}
+
+// Marks connection as alive
+func (b *BitfinexWS) touch() {
+	atomic.StoreInt64(&b.lastSeen, time.Now().UnixNano())
+}
+
+// Returns time since the last received message
+func (b *BitfinexWS) silence() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&b.lastSeen)))
+}
+
+// Stops Exchanger, Serve returns lifecycle.StopError with UserStop reason
+// Safe to invoke several times and before Serve. Logs reason of the first stop
+func (b *BitfinexWS) Stop(reason interface{}) {
+	if b.stopper.Stop(lifecycle.UserStop, reason, nil) && reason != nil {
+		b.log(reason)
+	}
+}
+
+// Dials to predefined URL
+// Returns error is Dial to server failed
+func (b *BitfinexWS) Dial() error {
+	return b.DialContext(context.Background())
+}
+
+// Dials to predefined URL, ctx limits time of handshake
+// Returns error is Dial to server failed or Exchanger has been stopped
+func (b *BitfinexWS) DialContext(ctx context.Context) error {
+	if b.url == "" {
+		b.url = BitfinexWS_URL
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, b.url, nil)
+	if err != nil {
+		b.log(err)
+		return err
+	}
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	// ServeContext closes connection on stop under writeMu, don't leak the one dialed after it
+	if b.stopper.Stopped() {
+		_ = conn.Close()
+		return fmt.Errorf("exchanger has been stopped")
+	}
+	b.conn = conn
+	b.touch()
+	return nil
+}
+
+// Closes connection if it's established
+func (b *BitfinexWS) closeConn() {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	if b.conn != nil {
+		_ = b.conn.Close()
+	}
+}
+
+// Sends requests over connection
+func (b *BitfinexWS) send(requests ...bitfinexSubscribe) error {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	if b.conn == nil {
+		return fmt.Errorf("connection isn't established")
+	}
+	for _, r := range requests {
+		if err := b.conn.WriteJSON(r); err != nil {
+			b.log(fmt.Errorf("WriteJSON failed: %s. message: %v", err.Error(), r))
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns subscribe requests of ticker channel of pairs
+func subscribeRequests(pairs []crypto.Pair) []bitfinexSubscribe {
+	requests := make([]bitfinexSubscribe, 0, len(pairs))
+	for _, pair := range pairs {
+		requests = append(requests, bitfinexSubscribe{Event: "subscribe", Channel: tickerChannelName, Symbol: symbol(pair)})
+	}
+	return requests
+}
+
+// Subscribes current pairs, channel ids are routed on subscribed events
+func (b *BitfinexWS) subscribe() error {
+	b.resetRoutes()
+	return b.send(subscribeRequests(b.pairs.Get())...)
+}
+
+// Replaces pairs without dropping connection
+// Unsubscribes channels of removed pairs and subscribes added ones if connection is established
+func (b *BitfinexWS) UpdatePairs(pairs ...crypto.Pair) error {
+	prev := b.pairs.Get()
+	if err := b.SetPairs(pairs...); err != nil {
+		return err
+	}
+	b.writeMu.Lock()
+	connected := b.conn != nil
+	b.writeMu.Unlock()
+	if !connected {
+		return nil
+	}
+	added, removed := crypto.DiffPairs(prev, pairs)
+	var requests []bitfinexSubscribe
+	for _, chanId := range b.removeRoutes(removed) {
+		requests = append(requests, bitfinexSubscribe{Event: "unsubscribe", ChanId: chanId})
+	}
+	requests = append(requests, subscribeRequests(added)...)
+	return b.send(requests...)
+}
+
+// Redials and resubscribes according to reconnect.Policy
+// Returns false if stop has been requested or policy doesn't allow more attempts
+func (b *BitfinexWS) reconnect(reason error) bool {
+	return reconnect.Loop{
+		Policy:    b.policy,
+		Dial:      b.Dial,
+		Subscribe: b.subscribe,
+		Close:     b.closeConn,
+		Emit:      b.emit,
+	}.Run(b.stopper.Done(), reason)
+}
+
+// Drops connection if nothing has been received during heartbeat timeout, reader reconnects then
+// Returns when stopper is stopped
+func (b *BitfinexWS) watchHeartbeat(stopper *lifecycle.Stopper) {
+	check := time.NewTicker(b.heartbeatTimeout / 4)
+	defer check.Stop()
+	for {
+		select {
+		case <-stopper.Done():
+			return
+		case <-check.C:
+			if b.silence() > b.heartbeatTimeout {
+				b.log(fmt.Errorf("no heartbeat in %s, dropping connection", b.heartbeatTimeout))
+				// next check waits for reconnected connection
+				b.touch()
+				b.closeConn()
+			}
+		}
+	}
+}
+
+// Handles event message, returns error if Bitfinex asked for reconnect
+func (b *BitfinexWS) handleEvent(event *bitfinexEvent) error {
+	switch event.Event {
+	case "subscribed":
+		pair, err := parseSymbol(event.Symbol)
+		if err != nil {
+			b.log(err)
+			return nil
+		}
+		b.addRoute(event.ChanId, pair)
+	case "info":
+		if event.Code == infoCodeReconnect {
+			return fmt.Errorf("reconnect requested: %s", event.Msg)
+		}
+		if event.Code != 0 {
+			b.log(fmt.Sprintf("info received: code %d, %s", event.Code, event.Msg))
+		}
+	}
+	return nil
+}
+
+// Reader is invoked by ServeContext method
+// Reader starts read message out of connection and routes ticker values to tick chan by channel id
+// Returns when stopper is stopped
+// On connection lost or reconnect request tries to reconnect, stops with lifecycle.RemoteClose if reconnect failed
+// Stops with lifecycle.ProtocolError if Bitfinex sent error, other unparsed messages are logged and skipped
+func (b *BitfinexWS) reader(stopper *lifecycle.Stopper) {
+	for !stopper.Stopped() {
+		_, msg, err := b.conn.ReadMessage()
+		received := time.Now().UTC()
+		if err == nil {
+			b.touch()
+			var event *bitfinexEvent
+			var data *channelMessage
+			event, data, err = parseMessage(msg)
+			switch {
+			case err != nil:
+				// malformed or unexpected message doesn't drop connection
+				var evErr *eventError
+				if errors.As(err, &evErr) {
+					stopper.Stop(lifecycle.ProtocolError, nil, err)
+				}
+				b.log(err)
+				continue
+			case event != nil:
+				err = b.handleEvent(event)
+			case !data.Heartbeat:
+				b.handleTicker(data, received, stopper)
+			}
+			if err == nil || stopper.Stopped() {
+				continue
+			}
+		}
+		if stopper.Stopped() {
+			return
+		}
+		if !b.reconnect(err) {
+			stopper.Stop(lifecycle.RemoteClose, "connection closed", err)
+		}
+	}
+}
+
+// Sends tick of ticker values routed by channel id
+func (b *BitfinexWS) handleTicker(data *channelMessage, received time.Time, stopper *lifecycle.Stopper) {
+	pair, ok := b.route(data.ChanId)
+	if !ok {
+		b.log(fmt.Errorf("message of unknown channel: %d", data.ChanId))
+		return
+	}
+	tick, err := parseTicker(data.Values, pair, received)
+	if err != nil {
+		b.log(err)
+		return
+	}
+	tick.Received = received
+	select {
+	case b.tick <- tick:
+	case <-stopper.Done():
+	}
+}
+
+// Returns error if some of required fields hasn't been initialized
+func (b *BitfinexWS) isValidSetup() error {
+	if len(b.pairs.Get()) == 0 {
+		return fmt.Errorf("pairs aren't set")
+	}
+	if b.tick == nil {
+		return fmt.Errorf("channels aren't set")
+	}
+	return nil
+}
+
+// Serve subscribes pairs and starts reader. And waits for stop to finish
+// Returns error if setup isn't valid or Exchanger has been stopped not by Stop()
+func (b *BitfinexWS) Serve() error {
+	err := b.ServeContext(context.Background())
+	if lifecycle.ReasonOf(err) == lifecycle.UserStop {
+		return nil
+	}
+	return err
+}
+
+// ServeContext subscribes pairs and starts reader and heartbeat watcher. And waits for stop or ctx to finish
+// Closes connection and tick chan on return
+// Returns error if setup isn't valid, otherwise *lifecycle.StopError describing why Exchanger has stopped
+func (b *BitfinexWS) ServeContext(ctx context.Context) error {
+	err := b.isValidSetup()
+	if err != nil {
+		b.log(err)
+		b.closeChannels()
+		return err
+	}
+
+	err = b.subscribe()
+	if err != nil {
+		b.closeChannels()
+		return err
+	}
+
+	stopper := &b.stopper
+	go stopper.Watch(ctx)
+	go b.watchHeartbeat(stopper)
+	finished := make(chan struct{})
+	go func() {
+		b.reader(stopper)
+		close(finished)
+	}()
+
+	<-stopper.Done()
+	// unblocks reader waiting for message
+	b.closeConn()
+	<-finished
+	b.closeChannels()
+	return stopper.Err()
+}
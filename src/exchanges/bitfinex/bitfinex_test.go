@@ -0,0 +1,288 @@
+package bitfinex
+
+import (
+	"context"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Starts local websocket server which invokes handler on each new connection
+func newWSServer(t *testing.T, handler func(conn *websocket.Conn, n int)) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	var n int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		handler(conn, int(atomic.AddInt32(&n, 1)))
+	}))
+}
+
+// Reads count subscriptions and confirms every one with channel id 100*n+i
+// Sends messages with %d replaced by channel id of the first subscription and waits until client goes away
+func subscribing(count int, messages ...string) func(conn *websocket.Conn, n int) {
+	return func(conn *websocket.Conn, n int) {
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"event":"info","version":2,"platform":{"status":1}}`))
+		for i := 0; i < count; i++ {
+			s := bitfinexSubscribe{}
+			if err := conn.ReadJSON(&s); err != nil {
+				return
+			}
+			msg := fmt.Sprintf(`{"event":"subscribed","channel":"ticker","chanId":%d,"symbol":"%s"}`, 100*n+i, s.Symbol)
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		}
+		for _, msg := range messages {
+			if strings.Contains(msg, "%d") {
+				msg = fmt.Sprintf(msg, 100*n)
+			}
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Creates BitfinexWS connected to local server and serves it in goroutine
+func serve(t *testing.T, ctx context.Context, server *httptest.Server, pairs ...crypto.Pair) (*BitfinexWS, <-chan crypto.Tick, <-chan error) {
+	b := NewWS()
+	b.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.NoError(t, b.SetPairs(pairs...))
+	assert.NoError(t, b.SetReconnectPolicy(reconnect.Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}))
+	ticks := b.Ticker()
+	assert.NoError(t, b.DialContext(ctx))
+	served := make(chan error, 1)
+	go func() {
+		served <- b.ServeContext(ctx)
+	}()
+	return b, ticks, served
+}
+
+// Waits for Serve result and checks tick chan is closed
+func wait(t *testing.T, ticks <-chan crypto.Tick, served <-chan error) error {
+	select {
+	case err := <-served:
+		for range ticks {
+		}
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve hasn't returned")
+		return nil
+	}
+}
+
+// Waits for tick and returns it
+func nextTick(t *testing.T, ticks <-chan crypto.Tick) crypto.Tick {
+	select {
+	case tick, ok := <-ticks:
+		assert.True(t, ok)
+		return tick
+	case <-time.After(5 * time.Second):
+		t.Fatal("tick hasn't been received")
+		return crypto.Tick{}
+	}
+}
+
+func TestNewWS(t *testing.T) {
+	b := NewWS()
+	assert.Equal(t, BitfinexWS_URL, b.url)
+	assert.Equal(t, DefaultHeartbeatTimeout, b.heartbeatTimeout)
+	assert.Equal(t, reconnect.DefaultPolicy, b.policy)
+
+	assert.Error(t, b.SetHeartbeatTimeout(0))
+	assert.NoError(t, b.SetHeartbeatTimeout(time.Second))
+	assert.Error(t, b.SetReconnectPolicy(reconnect.Policy{Jitter: 2}))
+	assert.Error(t, b.SetPairs())
+}
+
+func TestBitfinexWS_ServeContext(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	doge_usd, _ := crypto.NewPair("doge", "usd")
+
+	t.Run("closes tick chan if subscribe failed", func(t *testing.T) {
+		b := NewWS()
+		assert.NoError(t, b.SetPairs(btc_usd))
+		ticks := b.Ticker()
+		assert.Error(t, b.ServeContext(context.Background()))
+		_, ok := <-ticks
+		assert.False(t, ok)
+	})
+
+	t.Run("routes ticker of channel id to pair until context cancel", func(t *testing.T) {
+		server := newWSServer(t, subscribing(2, `[%d,"hb"]`, `[101,[2,1,3,1,0,0,2,1,3,2]]`, `[999,[2,1,3,1,0,0,2,1,3,2]]`, `[%d,[7616.5,1,7617.5,1,0,0,7617,1,8000,7000]]`))
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		b, ticks, served := serve(t, ctx, server, btc_usd, doge_usd)
+		tick := nextTick(t, ticks)
+		assert.Equal(t, doge_usd, tick.P)
+		assert.Equal(t, "2", tick.Bid.String())
+		tick = nextTick(t, ticks)
+		assert.Equal(t, btc_usd, tick.P)
+		assert.Equal(t, "7617.5", tick.Ask.String())
+
+		cancel()
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.ContextDone, lifecycle.ReasonOf(err))
+		b.Stop("late stop")
+	})
+
+	t.Run("reconnects on info request and routes new channel ids", func(t *testing.T) {
+		server := newWSServer(t, func(conn *websocket.Conn, n int) {
+			if n == 1 {
+				subscribing(1, `{"event":"info","code":20051,"msg":"Stopping. Please try to reconnect"}`)(conn, n)
+				return
+			}
+			subscribing(1, `[%d,[1,1,2,1]]`)(conn, n)
+		})
+		defer server.Close()
+
+		b := NewWS()
+		b.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		assert.NoError(t, b.SetPairs(btc_usd))
+		assert.NoError(t, b.SetReconnectPolicy(reconnect.Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}))
+		events := b.Events()
+		ticks := b.Ticker()
+		assert.NoError(t, b.Dial())
+		served := make(chan error, 1)
+		go func() {
+			served <- b.Serve()
+		}()
+
+		assert.Equal(t, btc_usd, nextTick(t, ticks).P)
+		_, ok := b.route(100)
+		assert.False(t, ok)
+		b.Stop(nil)
+		b.Stop(nil)
+		assert.NoError(t, wait(t, ticks, served))
+		assert.Equal(t, reconnect.Disconnected, (<-events).Type)
+	})
+
+	t.Run("silent connection is dropped and reconnected", func(t *testing.T) {
+		server := newWSServer(t, func(conn *websocket.Conn, n int) {
+			if n == 1 {
+				subscribing(1)(conn, n)
+				return
+			}
+			subscribing(1, `[%d,[1,1,2,1]]`)(conn, n)
+		})
+		defer server.Close()
+
+		b := NewWS()
+		b.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		assert.NoError(t, b.SetPairs(btc_usd))
+		assert.NoError(t, b.SetHeartbeatTimeout(100*time.Millisecond))
+		assert.NoError(t, b.SetReconnectPolicy(reconnect.Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}))
+		ticks := b.Ticker()
+		assert.NoError(t, b.Dial())
+		served := make(chan error, 1)
+		go func() {
+			served <- b.Serve()
+		}()
+
+		assert.Equal(t, btc_usd, nextTick(t, ticks).P)
+		b.Stop(nil)
+		assert.NoError(t, wait(t, ticks, served))
+	})
+
+	t.Run("malformed messages are skipped without reconnect", func(t *testing.T) {
+		var connections int32
+		server := newWSServer(t, func(conn *websocket.Conn, n int) {
+			atomic.AddInt32(&connections, 1)
+			subscribing(1, `[%d,"te"]`, `{"event":`, `[%d,[1,"x",2,1]]`, `[%d,[1,1,2,1]]`)(conn, n)
+		})
+		defer server.Close()
+
+		b := NewWS()
+		b.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		assert.NoError(t, b.SetPairs(btc_usd))
+		events := b.Events()
+		ticks := b.Ticker()
+		assert.NoError(t, b.Dial())
+		served := make(chan error, 1)
+		go func() {
+			served <- b.Serve()
+		}()
+
+		assert.Equal(t, "1", nextTick(t, ticks).Bid.String())
+		b.Stop(nil)
+		assert.NoError(t, wait(t, ticks, served))
+		assert.Empty(t, events)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&connections))
+	})
+
+	t.Run("error event stops with protocol error", func(t *testing.T) {
+		server := newWSServer(t, subscribing(0, `{"event":"error","msg":"subscribe: invalid","code":10300}`))
+		defer server.Close()
+
+		_, ticks, served := serve(t, context.Background(), server, btc_usd)
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.ProtocolError, lifecycle.ReasonOf(err))
+	})
+
+	t.Run("Serve returns error on invalid setup", func(t *testing.T) {
+		b := NewWS()
+		assert.Error(t, b.Serve())
+		assert.NoError(t, b.SetPairs(btc_usd))
+		assert.Error(t, b.Serve())
+		b.Ticker()
+		assert.Error(t, b.Serve())
+	})
+}
+
+func TestBitfinexWS_UpdatePairs(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	eth_usd, _ := crypto.NewPair("eth", "usd")
+
+	b := NewWS()
+	assert.NoError(t, b.UpdatePairs(btc_usd))
+	assert.Error(t, b.UpdatePairs())
+
+	received := make(chan bitfinexSubscribe, 3)
+	server := newWSServer(t, func(conn *websocket.Conn, n int) {
+		for {
+			s := bitfinexSubscribe{}
+			if err := conn.ReadJSON(&s); err != nil {
+				return
+			}
+			received <- s
+		}
+	})
+	defer server.Close()
+
+	b.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.NoError(t, b.Dial())
+	assert.NoError(t, b.subscribe())
+	b.addRoute(42, btc_usd)
+	assert.NoError(t, b.UpdatePairs(eth_usd))
+
+	expected := []bitfinexSubscribe{
+		{Event: "subscribe", Channel: tickerChannelName, Symbol: "tBTCUSD"},
+		{Event: "unsubscribe", ChanId: 42},
+		{Event: "subscribe", Channel: tickerChannelName, Symbol: "tETHUSD"},
+	}
+	for _, e := range expected {
+		select {
+		case s := <-received:
+			assert.Equal(t, e, s)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message hasn't been received")
+		}
+	}
+	_, ok := b.route(42)
+	assert.False(t, ok)
+}
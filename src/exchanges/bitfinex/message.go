@@ -0,0 +1,154 @@
+package bitfinex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"strings"
+	"time"
+)
+
+// Channel name of best bid and ask according to Bitfinex WS API
+const tickerChannelName = "ticker"
+
+// Heartbeat payload sent every 15 seconds to idle channels
+const heartbeat = "hb"
+
+// Info event code asking to reconnect, e.g. on server restart
+const infoCodeReconnect = 20051
+
+// Bitfinex currency ids which differ from common ones
+var aliases = crypto.NewAliases(map[string]string{
+	"UST": "USDT",
+	"DSH": "DASH",
+	"IOT": "IOTA",
+	"QTM": "QTUM",
+})
+
+// Event message format provided by Bitfinex WS API, e.g. subscribed, info or error
+type bitfinexEvent struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	ChanId  int64  `json:"chanId"`
+	Symbol  string `json:"symbol"`
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+}
+
+// Subscription request format
+type bitfinexSubscribe struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel,omitempty"`
+	Symbol  string `json:"symbol,omitempty"`
+	ChanId  int64  `json:"chanId,omitempty"`
+}
+
+// eventError is returned by parseMessage if Bitfinex sent error event
+type eventError struct {
+	Code int
+	Msg  string
+}
+
+func (e *eventError) Error() string {
+	return fmt.Sprintf("error received: code %d, %s", e.Code, e.Msg)
+}
+
+// Channel message, Bitfinex sends it as array: [chanId, payload]
+// Payload is either array of values or "hb"
+type channelMessage struct {
+	ChanId    int64
+	Heartbeat bool
+	Values    []json.Number
+}
+
+// Returns Bitfinex trading symbol of pair, e.g. tBTCUSD or tDOGE:USD
+func symbol(pair crypto.Pair) string {
+	primary, _ := aliases.Currency(pair.Primary())
+	secondary, _ := aliases.Currency(pair.Secondary())
+	p, s := aliases.Id(primary), aliases.Id(secondary)
+	if len(p) == 3 && len(s) == 3 {
+		return "t" + p + s
+	}
+	return "t" + p + ":" + s
+}
+
+// Parses Bitfinex trading symbol, e.g. tBTCUSD or tDOGE:USD
+func parseSymbol(s string) (crypto.Pair, error) {
+	if !strings.HasPrefix(s, "t") {
+		return crypto.Pair{}, fmt.Errorf("not a trading symbol: %s", s)
+	}
+	s = s[1:]
+	if !strings.Contains(s, ":") {
+		if len(s) != 6 {
+			return crypto.Pair{}, fmt.Errorf("unable to split symbol: t%s", s)
+		}
+		s = s[:3] + ":" + s[3:]
+	}
+	return aliases.ParsePair(s, ':')
+}
+
+// Parses message of Bitfinex WS API, either event or channelMessage is returned
+// Returns *eventError if Bitfinex sent error event
+func parseMessage(msg []byte) (event *bitfinexEvent, data *channelMessage, err error) {
+	msg = bytes.TrimSpace(msg)
+	if len(msg) == 0 {
+		return nil, nil, fmt.Errorf("message is empty")
+	}
+	if msg[0] == '{' {
+		event = &bitfinexEvent{}
+		if err = json.Unmarshal(msg, event); err != nil {
+			return nil, nil, fmt.Errorf("wrong event format, unable to decode: %s", err)
+		}
+		if event.Event == "" {
+			return nil, nil, fmt.Errorf("event is empty")
+		}
+		if event.Event == "error" {
+			return event, nil, &eventError{Code: event.Code, Msg: event.Msg}
+		}
+		return event, nil, nil
+	}
+	var fields []json.RawMessage
+	if err = json.Unmarshal(msg, &fields); err != nil {
+		return nil, nil, fmt.Errorf("wrong channel message format, unable to decode: %s", err)
+	}
+	if len(fields) < 2 {
+		return nil, nil, fmt.Errorf("channel message has %d fields, at least 2 expected", len(fields))
+	}
+	data = &channelMessage{}
+	if err = json.Unmarshal(fields[0], &data.ChanId); err != nil {
+		return nil, nil, fmt.Errorf("wrong channel id: %s", err)
+	}
+	var hb string
+	if json.Unmarshal(fields[1], &hb) == nil {
+		if hb != heartbeat {
+			return nil, nil, fmt.Errorf("unknown payload of channel %d: %s", data.ChanId, hb)
+		}
+		data.Heartbeat = true
+		return nil, data, nil
+	}
+	d := json.NewDecoder(bytes.NewReader(fields[1]))
+	d.UseNumber()
+	if err = d.Decode(&data.Values); err != nil {
+		return nil, nil, fmt.Errorf("wrong payload of channel %d: %s", data.ChanId, err)
+	}
+	return nil, data, nil
+}
+
+// Converts ticker values to crypto.Tick
+// Ticker is [BID, BID_SIZE, ASK, ASK_SIZE, DAILY_CHANGE, ...], Bitfinex doesn't send time, receive time t is used
+func parseTicker(values []json.Number, pair crypto.Pair, t time.Time) (tick crypto.Tick, err error) {
+	if len(values) < 4 {
+		return tick, fmt.Errorf("ticker of %s has %d values, at least 4 expected", pair.String(), len(values))
+	}
+	if tick.Bid, err = crypto.NewDecimal(values[0].String()); err != nil {
+		return tick, fmt.Errorf("bad bid of %s: %s", pair.String(), err)
+	}
+	if tick.Ask, err = crypto.NewDecimal(values[2].String()); err != nil {
+		return tick, fmt.Errorf("bad ask of %s: %s", pair.String(), err)
+	}
+	tick.T = t
+	tick.P = pair
+	tick.ExchangeId = exchangeName
+	return tick, nil
+}
@@ -0,0 +1,112 @@
+package bitfinex
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const tickerFixture = `[17082,[7616.5,31.89055171,7617.5,43.358853472,-550.8,-0.0674,7617.1,8314.71200815,8257.8,7500]]`
+
+func Test_symbol(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	doge_usd, _ := crypto.NewPair("doge", "usd")
+	btc_usdt, _ := crypto.NewPair("btc", "usdt")
+	assert.Equal(t, "tBTCUSD", symbol(btc_usd))
+	assert.Equal(t, "tDOGE:USD", symbol(doge_usd))
+	assert.Equal(t, "tBTCUST", symbol(btc_usdt))
+}
+
+func Test_parseSymbol(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	doge_usd, _ := crypto.NewPair("doge", "usd")
+	btc_usdt, _ := crypto.NewPair("btc", "usdt")
+
+	cases := []struct {
+		s        string
+		expected crypto.Pair
+		hasError bool
+	}{
+		{"tBTCUSD", btc_usd, false},
+		{"tDOGE:USD", doge_usd, false},
+		{"tBTCUST", btc_usdt, false},
+		{"fUSD", crypto.Pair{}, true},
+		{"tBTCUSDT", crypto.Pair{}, true},
+		{"tBTC:U", crypto.Pair{}, true},
+	}
+	for _, testCase := range cases {
+		pair, err := parseSymbol(testCase.s)
+		if testCase.hasError {
+			assert.Error(t, err, testCase.s)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, pair)
+	}
+}
+
+func Test_parseMessage(t *testing.T) {
+	t.Run("events", func(t *testing.T) {
+		event, data, err := parseMessage([]byte(`{"event":"subscribed","channel":"ticker","chanId":17082,"symbol":"tBTCUSD","pair":"BTCUSD"}`))
+		assert.NoError(t, err)
+		assert.Nil(t, data)
+		assert.Equal(t, bitfinexEvent{Event: "subscribed", Channel: tickerChannelName, ChanId: 17082, Symbol: "tBTCUSD"}, *event)
+
+		event, _, err = parseMessage([]byte(`{"event":"info","code":20051,"msg":"Stopping. Please try to reconnect"}`))
+		assert.NoError(t, err)
+		assert.Equal(t, infoCodeReconnect, event.Code)
+
+		var evErr *eventError
+		_, _, err = parseMessage([]byte(`{"event":"error","msg":"subscribe: dup","code":10301}`))
+		assert.True(t, errors.As(err, &evErr))
+		assert.Equal(t, 10301, evErr.Code)
+
+		_, _, err = parseMessage([]byte(`{"version":2}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("channel messages", func(t *testing.T) {
+		_, data, err := parseMessage([]byte(`[17082,"hb"]`))
+		assert.NoError(t, err)
+		assert.Equal(t, &channelMessage{ChanId: 17082, Heartbeat: true}, data)
+
+		_, data, err = parseMessage([]byte(tickerFixture))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(17082), data.ChanId)
+		assert.False(t, data.Heartbeat)
+		assert.Len(t, data.Values, 10)
+		assert.Equal(t, json.Number("31.89055171"), data.Values[1])
+
+		cases := []string{``, `[17082]`, `["x",[1]]`, `[17082,"cs"]`, `[17082,{}]`, `not json`}
+		for _, msg := range cases {
+			_, _, err = parseMessage([]byte(msg))
+			assert.Error(t, err, msg)
+		}
+	})
+}
+
+func Test_parseTicker(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	now := time.Unix(100, 0).UTC()
+
+	_, data, _ := parseMessage([]byte(tickerFixture))
+	tick, err := parseTicker(data.Values, btc_usd, now)
+	assert.NoError(t, err)
+	assert.Equal(t, crypto.Tick{T: now, P: btc_usd, Bid: crypto.MustDecimal("7616.5"), Ask: crypto.MustDecimal("7617.5"), ExchangeId: "bitfinex"}, tick)
+
+	_, data, _ = parseMessage([]byte(`[1,[1.5e-7,1,2.5e-7,1]]`))
+	tick, err = parseTicker(data.Values, btc_usd, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "0.00000015", tick.Bid.String())
+
+	cases := []string{`[1,[1,1,2]]`, `[1,[null,1,2,1]]`, `[1,[1,1,null,1]]`}
+	for _, msg := range cases {
+		_, data, err = parseMessage([]byte(msg))
+		assert.NoError(t, err)
+		_, err = parseTicker(data.Values, btc_usd, now)
+		assert.Error(t, err, msg)
+	}
+}
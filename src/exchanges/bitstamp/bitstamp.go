@@ -0,0 +1,440 @@
+package bitstamp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/gorilla/websocket"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Name of exchange, ticks are marked by it
+const exchangeName = "bitstamp"
+
+// Default URL of Bitstamp WS API
+const BitstampWS_URL = "wss://ws.bitstamp.net"
+
+// BitstampWS is used for WebSocket Protocol
+// Ticks are derived from top of order_book channel, trades are streamed by live_trades channel
+type BitstampWS struct {
+	tick  chan crypto.Tick
+	trade chan crypto.Trade
+
+	pairs exchanges.Pairs
+	// channel prefixes which are subscribed for every pair
+	channels []string
+
+	// last tick by pair, tick is sent only if top of book has changed
+	last map[crypto.Pair]crypto.Tick
+
+	conn *websocket.Conn
+	url  string
+
+	// connection supports one concurrent writer only, guards conn replacement too
+	writeMu sync.Mutex
+
+	// reconnect policy and chan of reconnect events for caller
+	policy reconnect.Policy
+	events reconnect.Events
+
+	// stop signal, Stop may be invoked before Serve
+	stopper lifecycle.Stopper
+
+	logger *log.Logger
+}
+
+// Registers bitstamp for WebSocket protocol
+func init() {
+	exchanges.Register(exchangeName, exchanges.WebSocket, func() exchanges.Exchanger {
+		return NewWS()
+	}, exchanges.TickerChannel, exchanges.TradesChannel)
+}
+
+// Creates new Bitstamp Exchanger for WebSocket protocol
+func NewWS() *BitstampWS {
+	b := new(BitstampWS)
+	b.url = BitstampWS_URL
+	b.policy = reconnect.DefaultPolicy
+	return b
+}
+
+// Sets URL of websocket server, BitstampWS_URL is used by default
+func (b *BitstampWS) SetURL(url string) {
+	b.url = url
+}
+
+// Sets reconnect.Policy which is used when connection is lost
+// Returns error if policy isn't valid
+func (b *BitstampWS) SetReconnectPolicy(policy reconnect.Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	b.policy = policy
+	return nil
+}
+
+// Returns chan of reconnect.Event
+// Events are dropped if nobody reads the chan
+func (b *BitstampWS) Events() <-chan reconnect.Event {
+	return b.events.Chan()
+}
+
+// Sends event to events chan without blocking and logs it
+func (b *BitstampWS) emit(event reconnect.Event) {
+	b.log(b.events.Emit(event))
+}
+
+// Simple log function
+func (b *BitstampWS) log(v interface{}) {
+	if b.logger != nil {
+		b.logger.Println(v)
+	}
+}
+
+// Sets logger as io.Writer interface
+func (b *BitstampWS) SetLogger(w io.Writer) {
+	b.logger = log.New(w, "", log.Ldate|log.Ltime)
+}
+
+// Sets slice of crypto.Pair, will be used for subscribe later on
+func (b *BitstampWS) SetPairs(pairs ...crypto.Pair) error {
+	return b.pairs.Set(pairs...)
+}
+
+// Returns pair of channel, e.g. BTC-EUR of order_book_btceur
+func (b *BitstampWS) channelPair(channel, prefix string) (crypto.Pair, error) {
+	s := strings.TrimPrefix(channel, prefix)
+	for _, pair := range b.pairs.Get() {
+		if symbol(pair) == s {
+			return pair, nil
+		}
+	}
+	return crypto.Pair{}, fmt.Errorf("channel of unknown pair: %s", channel)
+}
+
+// Returns chan of crypto.Tick, appends order_book channel for subscribe
+// Tick is sent when best bid or ask has changed
+func (b *BitstampWS) Ticker() <-chan crypto.Tick {
+	if b.tick != nil {
+		return b.tick
+	}
+	b.channels = append(b.channels, orderBookChannelPrefix)
+	b.tick = make(chan crypto.Tick, 1)
+	return b.tick
+}
+
+// Returns chan of crypto.Trade, appends live_trades channel for subscribe
+func (b *BitstampWS) Trades() <-chan crypto.Trade {
+	if b.trade != nil {
+		return b.trade
+	}
+	b.channels = append(b.channels, liveTradesChannelPrefix)
+	b.trade = make(chan crypto.Trade, 1)
+	return b.trade
+}
+
+// Closes all dedicated chans which have been requested
+func (b *BitstampWS) closeChannels() {
+	if b.tick != nil {
+		close(b.tick)
+		b.tick = nil
+	}
+	if b.trade != nil {
+		close(b.trade)
+		b.trade = nil
+	}
+}
+
+// Stops Exchanger, Serve returns lifecycle.StopError with UserStop reason
+// Safe to invoke several times and before Serve. Logs reason of the first stop
+func (b *BitstampWS) Stop(reason interface{}) {
+	if b.stopper.Stop(lifecycle.UserStop, reason, nil) && reason != nil {
+		b.log(reason)
+	}
+}
+
+// Dials to predefined URL
+// Returns error is Dial to server failed
+func (b *BitstampWS) Dial() error {
+	return b.DialContext(context.Background())
+}
+
+// Dials to predefined URL, ctx limits time of handshake
+// Returns error is Dial to server failed or Exchanger has been stopped
+func (b *BitstampWS) DialContext(ctx context.Context) error {
+	conn, err := b.dial(ctx)
+	if err != nil {
+		return err
+	}
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	// ServeContext closes connection on stop under writeMu, don't leak the one dialed after it
+	if b.stopper.Stopped() {
+		_ = conn.Close()
+		return fmt.Errorf("exchanger has been stopped")
+	}
+	b.conn = conn
+	return nil
+}
+
+// Dials new connection without replacing current one
+func (b *BitstampWS) dial(ctx context.Context) (*websocket.Conn, error) {
+	if b.url == "" {
+		b.url = BitstampWS_URL
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, b.url, nil)
+	if err != nil {
+		b.log(err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Returns current connection
+func (b *BitstampWS) currentConn() *websocket.Conn {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	return b.conn
+}
+
+// Closes connection if it's established
+func (b *BitstampWS) closeConn() {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	if b.conn != nil {
+		_ = b.conn.Close()
+	}
+}
+
+// Sends subscribe or unsubscribe event of every channel of pairs over conn
+// Important: caller should hold writeMu if conn is shared
+func (b *BitstampWS) send(conn *websocket.Conn, event string, pairs []crypto.Pair) error {
+	for _, pair := range pairs {
+		for _, prefix := range b.channels {
+			s := bitstampSubscribe{Event: event, Data: bitstampSubscribeData{Channel: prefix + symbol(pair)}}
+			if err := conn.WriteJSON(s); err != nil {
+				b.log(fmt.Errorf("WriteJSON failed: %s. message: %v", err.Error(), s))
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Subscribes current pairs over current connection
+func (b *BitstampWS) subscribe() error {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	if b.conn == nil {
+		return fmt.Errorf("connection isn't established")
+	}
+	return b.send(b.conn, subscribeEvent, b.pairs.Get())
+}
+
+// Replaces pairs without dropping connection
+// Unsubscribes removed pairs and subscribes added ones if connection is established
+func (b *BitstampWS) UpdatePairs(pairs ...crypto.Pair) error {
+	prev := b.pairs.Get()
+	if err := b.SetPairs(pairs...); err != nil {
+		return err
+	}
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	if b.conn == nil {
+		return nil
+	}
+	added, removed := crypto.DiffPairs(prev, pairs)
+	if len(removed) > 0 {
+		if err := b.send(b.conn, unsubscribeEvent, removed); err != nil {
+			return err
+		}
+	}
+	return b.send(b.conn, subscribeEvent, added)
+}
+
+// Replaces connection by a new subscribed one, invoked on bts:request_reconnect
+// Current connection is closed if new one failed, it's restored by reconnect then
+func (b *BitstampWS) replaceConn() {
+	conn, err := b.dial(context.Background())
+	if err == nil {
+		if err = b.send(conn, subscribeEvent, b.pairs.Get()); err != nil {
+			_ = conn.Close()
+		}
+	}
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	if err != nil || b.stopper.Stopped() {
+		if conn != nil {
+			_ = conn.Close()
+		}
+		_ = b.conn.Close()
+		return
+	}
+	old := b.conn
+	b.conn = conn
+	_ = old.Close()
+	b.log("connection replaced on reconnect request")
+}
+
+// Redials and resubscribes according to reconnect.Policy
+// Returns false if stop has been requested or policy doesn't allow more attempts
+func (b *BitstampWS) reconnect(reason error) bool {
+	return reconnect.Loop{
+		Policy:    b.policy,
+		Dial:      b.Dial,
+		Subscribe: b.subscribe,
+		Close:     b.closeConn,
+		Emit:      b.emit,
+	}.Run(b.stopper.Done(), reason)
+}
+
+// Reader is invoked by ServeContext method
+// Reader starts read message out of connection and sends ticks and trades to dedicated chans
+// Returns when stopper is stopped
+// Replaces connection on bts:request_reconnect, on connection lost tries to reconnect
+// Stops with lifecycle.RemoteClose if reconnect failed, lifecycle.ProtocolError if Bitstamp sent error
+func (b *BitstampWS) reader(stopper *lifecycle.Stopper) {
+	for !stopper.Stopped() {
+		conn := b.currentConn()
+		_, msg, err := conn.ReadMessage()
+		received := time.Now().UTC()
+		if err != nil {
+			if stopper.Stopped() || b.currentConn() != conn {
+				continue
+			}
+			if !b.reconnect(err) {
+				stopper.Stop(lifecycle.RemoteClose, "connection closed", err)
+			}
+			continue
+		}
+		m, err := parseMessage(msg)
+		if err != nil {
+			var errMsg *errorMessage
+			if errors.As(err, &errMsg) {
+				stopper.Stop(lifecycle.ProtocolError, nil, err)
+			}
+			b.log(err)
+			continue
+		}
+		switch {
+		case m.Event == requestReconnectEvent:
+			b.replaceConn()
+		case m.Event == dataEvent && strings.HasPrefix(m.Channel, orderBookChannelPrefix):
+			b.handleOrderBook(m, received, stopper)
+		case m.Event == tradeEvent && strings.HasPrefix(m.Channel, liveTradesChannelPrefix):
+			b.handleTrade(m, stopper)
+		}
+	}
+}
+
+// Sends tick of order book message if top of book has changed
+func (b *BitstampWS) handleOrderBook(m bitstampMessage, received time.Time, stopper *lifecycle.Stopper) {
+	if b.tick == nil {
+		return
+	}
+	pair, err := b.channelPair(m.Channel, orderBookChannelPrefix)
+	if err != nil {
+		b.log(err)
+		return
+	}
+	tick, err := parseOrderBook(m.Data, pair)
+	if err != nil {
+		b.log(err)
+		return
+	}
+	tick.Received = received
+	if last, ok := b.last[pair]; ok && last.Bid.Equal(tick.Bid) && last.Ask.Equal(tick.Ask) {
+		return
+	}
+	if b.last == nil {
+		b.last = make(map[crypto.Pair]crypto.Tick)
+	}
+	b.last[pair] = tick
+	select {
+	case b.tick <- tick:
+	case <-stopper.Done():
+	}
+}
+
+// Sends trade of live_trades message
+func (b *BitstampWS) handleTrade(m bitstampMessage, stopper *lifecycle.Stopper) {
+	if b.trade == nil {
+		return
+	}
+	pair, err := b.channelPair(m.Channel, liveTradesChannelPrefix)
+	if err != nil {
+		b.log(err)
+		return
+	}
+	trade, err := parseTrade(m.Data, pair)
+	if err != nil {
+		b.log(err)
+		return
+	}
+	select {
+	case b.trade <- trade:
+	case <-stopper.Done():
+	}
+}
+
+// Returns error if some of required fields hasn't been initialized
+func (b *BitstampWS) isValidSetup() error {
+	if len(b.pairs.Get()) == 0 {
+		return fmt.Errorf("pairs aren't set")
+	}
+	if len(b.channels) == 0 {
+		return fmt.Errorf("channels aren't set")
+	}
+	return nil
+}
+
+// Serve subscribes pairs and starts reader. And waits for stop to finish
+// Returns error if setup isn't valid or Exchanger has been stopped not by Stop()
+func (b *BitstampWS) Serve() error {
+	err := b.ServeContext(context.Background())
+	if lifecycle.ReasonOf(err) == lifecycle.UserStop {
+		return nil
+	}
+	return err
+}
+
+// ServeContext subscribes pairs and starts reader. And waits for stop or ctx to finish
+// Closes connection and dedicated chans on return
+// Returns error if setup isn't valid, otherwise *lifecycle.StopError describing why Exchanger has stopped
+func (b *BitstampWS) ServeContext(ctx context.Context) error {
+	err := b.isValidSetup()
+	if err != nil {
+		b.log(err)
+		b.closeChannels()
+		return err
+	}
+
+	err = b.subscribe()
+	if err != nil {
+		b.closeChannels()
+		return err
+	}
+
+	stopper := &b.stopper
+	go stopper.Watch(ctx)
+	finished := make(chan struct{})
+	go func() {
+		b.reader(stopper)
+		close(finished)
+	}()
+
+	<-stopper.Done()
+	// unblocks reader waiting for message
+	b.closeConn()
+	<-finished
+	b.closeChannels()
+	return stopper.Err()
+}
@@ -0,0 +1,233 @@
+package bitstamp
+
+import (
+	"context"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Starts local websocket server which invokes handler on each new connection
+func newWSServer(t *testing.T, handler func(conn *websocket.Conn, n int)) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	var n int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		handler(conn, int(atomic.AddInt32(&n, 1)))
+	}))
+}
+
+// Reads count subscriptions, replies with messages and keeps connection open until client goes away
+func replying(subscribed chan<- bitstampSubscribe, count int, messages ...string) func(conn *websocket.Conn, n int) {
+	return func(conn *websocket.Conn, n int) {
+		for i := 0; i < count; i++ {
+			s := bitstampSubscribe{}
+			if err := conn.ReadJSON(&s); err != nil {
+				return
+			}
+			if subscribed != nil {
+				subscribed <- s
+			}
+		}
+		for _, msg := range messages {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Waits for Serve result and checks tick chan is closed
+func wait(t *testing.T, ticks <-chan crypto.Tick, served <-chan error) error {
+	select {
+	case err := <-served:
+		for range ticks {
+		}
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve hasn't returned")
+		return nil
+	}
+}
+
+func TestNewWS(t *testing.T) {
+	b := NewWS()
+	assert.Equal(t, BitstampWS_URL, b.url)
+	assert.Equal(t, reconnect.DefaultPolicy, b.policy)
+	assert.Error(t, b.SetReconnectPolicy(reconnect.Policy{Jitter: 2}))
+	assert.Error(t, b.SetPairs())
+
+	ticks := b.Ticker()
+	assert.Equal(t, ticks, b.Ticker())
+	trades := b.Trades()
+	assert.Equal(t, trades, b.Trades())
+	assert.Equal(t, []string{orderBookChannelPrefix, liveTradesChannelPrefix}, b.channels)
+}
+
+func TestBitstampWS_ServeContext(t *testing.T) {
+	btc_eur, _ := crypto.NewPair("btc", "eur")
+
+	t.Run("closes chans if subscribe failed", func(t *testing.T) {
+		b := NewWS()
+		assert.NoError(t, b.SetPairs(btc_eur))
+		ticks := b.Ticker()
+		trades := b.Trades()
+		assert.Error(t, b.ServeContext(context.Background()))
+		_, ok := <-ticks
+		assert.False(t, ok)
+		_, ok = <-trades
+		assert.False(t, ok)
+	})
+
+	t.Run("subscribes channels and streams ticks and trades until context cancel", func(t *testing.T) {
+		subscribed := make(chan bitstampSubscribe, 2)
+		// second order book has the same top, so it doesn't produce tick
+		server := newWSServer(t, replying(subscribed, 2, subscribedFixture, orderBookFixture, orderBookFixture, liveTradeFixture))
+		defer server.Close()
+
+		b := NewWS()
+		b.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		assert.NoError(t, b.SetPairs(btc_eur))
+		ticks := b.Ticker()
+		trades := b.Trades()
+		ctx, cancel := context.WithCancel(context.Background())
+		assert.NoError(t, b.DialContext(ctx))
+		served := make(chan error, 1)
+		go func() {
+			served <- b.ServeContext(ctx)
+		}()
+
+		assert.Equal(t, bitstampSubscribe{Event: subscribeEvent, Data: bitstampSubscribeData{Channel: "order_book_btceur"}}, <-subscribed)
+		assert.Equal(t, bitstampSubscribe{Event: subscribeEvent, Data: bitstampSubscribeData{Channel: "live_trades_btceur"}}, <-subscribed)
+		select {
+		case tick := <-ticks:
+			assert.Equal(t, btc_eur, tick.P)
+			assert.Equal(t, "33410", tick.Bid.String())
+		case <-time.After(5 * time.Second):
+			t.Fatal("tick hasn't been received")
+		}
+		select {
+		case trade := <-trades:
+			assert.Equal(t, "219400001", trade.Id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("trade hasn't been received")
+		}
+		assert.Empty(t, ticks)
+
+		cancel()
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.ContextDone, lifecycle.ReasonOf(err))
+		for range trades {
+		}
+		b.Stop("late stop")
+	})
+
+	t.Run("replaces connection on bts:request_reconnect", func(t *testing.T) {
+		subscribed := make(chan bitstampSubscribe, 2)
+		server := newWSServer(t, func(conn *websocket.Conn, n int) {
+			if n == 1 {
+				replying(subscribed, 1, reconnectFixture)(conn, n)
+				return
+			}
+			replying(subscribed, 1, orderBookFixture)(conn, n)
+		})
+		defer server.Close()
+
+		b := NewWS()
+		b.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		assert.NoError(t, b.SetPairs(btc_eur))
+		events := b.Events()
+		ticks := b.Ticker()
+		assert.NoError(t, b.Dial())
+		served := make(chan error, 1)
+		go func() {
+			served <- b.Serve()
+		}()
+
+		<-subscribed
+		<-subscribed
+		select {
+		case <-ticks:
+		case <-time.After(5 * time.Second):
+			t.Fatal("tick hasn't been received over new connection")
+		}
+		b.Stop("user stopped")
+		b.Stop("user stopped again")
+		assert.NoError(t, wait(t, ticks, served))
+		assert.Empty(t, events)
+	})
+
+	t.Run("error message stops with protocol error", func(t *testing.T) {
+		server := newWSServer(t, replying(nil, 1, `{"event":"bts:error","channel":"","data":{"code":null,"message":"Bad subscription string."}}`))
+		defer server.Close()
+
+		b := NewWS()
+		b.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		assert.NoError(t, b.SetPairs(btc_eur))
+		ticks := b.Ticker()
+		assert.NoError(t, b.Dial())
+		served := make(chan error, 1)
+		go func() {
+			served <- b.Serve()
+		}()
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.ProtocolError, lifecycle.ReasonOf(err))
+	})
+
+	t.Run("Serve returns error on invalid setup", func(t *testing.T) {
+		b := NewWS()
+		assert.Error(t, b.Serve())
+		assert.NoError(t, b.SetPairs(btc_eur))
+		assert.Error(t, b.Serve())
+		b.Ticker()
+		assert.Error(t, b.Serve())
+	})
+}
+
+func TestBitstampWS_UpdatePairs(t *testing.T) {
+	btc_eur, _ := crypto.NewPair("btc", "eur")
+	eth_eur, _ := crypto.NewPair("eth", "eur")
+
+	b := NewWS()
+	assert.NoError(t, b.UpdatePairs(btc_eur))
+	assert.Error(t, b.UpdatePairs())
+
+	received := make(chan bitstampSubscribe, 3)
+	server := newWSServer(t, replying(received, 3))
+	defer server.Close()
+
+	b.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+	b.Ticker()
+	assert.NoError(t, b.Dial())
+	assert.NoError(t, b.subscribe())
+	assert.NoError(t, b.UpdatePairs(eth_eur))
+
+	expected := []bitstampSubscribe{
+		{Event: subscribeEvent, Data: bitstampSubscribeData{Channel: "order_book_btceur"}},
+		{Event: unsubscribeEvent, Data: bitstampSubscribeData{Channel: "order_book_btceur"}},
+		{Event: subscribeEvent, Data: bitstampSubscribeData{Channel: "order_book_etheur"}},
+	}
+	for _, e := range expected {
+		select {
+		case s := <-received:
+			assert.Equal(t, e, s)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message hasn't been received")
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package bitstamp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Channel prefixes according to Bitstamp WS API, pair symbol is appended, e.g. order_book_btceur
+const (
+	orderBookChannelPrefix  = "order_book_"
+	liveTradesChannelPrefix = "live_trades_"
+)
+
+// Events according to Bitstamp WS API
+const (
+	dataEvent             = "data"
+	tradeEvent            = "trade"
+	subscribeEvent        = "bts:subscribe"
+	unsubscribeEvent      = "bts:unsubscribe"
+	requestReconnectEvent = "bts:request_reconnect"
+	errorEvent            = "bts:error"
+)
+
+// Base message format provided by Bitstamp WS API
+type bitstampMessage struct {
+	Event   string          `json:"event"`
+	Channel string          `json:"channel"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Subscription request format
+type bitstampSubscribe struct {
+	Event string                `json:"event"`
+	Data  bitstampSubscribeData `json:"data"`
+}
+
+type bitstampSubscribeData struct {
+	Channel string `json:"channel"`
+}
+
+// errorMessage is returned by parseMessage if Bitstamp sent bts:error
+type errorMessage struct {
+	Code    *int   `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *errorMessage) Error() string {
+	return fmt.Sprintf("error received: %s", e.Message)
+}
+
+// Bitstamp order_book payload, top 100 levels of both sides, best first
+type orderBook struct {
+	MicroTimestamp string      `json:"microtimestamp"`
+	Bids           [][2]string `json:"bids"`
+	Asks           [][2]string `json:"asks"`
+}
+
+// Bitstamp live_trades payload
+// Type is 0 for buy and 1 for sell, side of taker order
+type liveTrade struct {
+	Id             int64  `json:"id"`
+	MicroTimestamp string `json:"microtimestamp"`
+	Amount         string `json:"amount_str"`
+	Price          string `json:"price_str"`
+	Type           int    `json:"type"`
+	BuyOrderId     int64  `json:"buy_order_id"`
+	SellOrderId    int64  `json:"sell_order_id"`
+}
+
+// Returns Bitstamp symbol of pair, e.g. btceur
+func symbol(pair crypto.Pair) string {
+	return strings.ToLower(pair.Primary() + pair.Secondary())
+}
+
+// Parses message of Bitstamp WS API
+// Returns *errorMessage if Bitstamp sent bts:error
+func parseMessage(msg []byte) (m bitstampMessage, err error) {
+	if err = json.Unmarshal(msg, &m); err != nil {
+		return m, fmt.Errorf("wrong message format, unable to decode: %s", err)
+	}
+	if m.Event == "" {
+		return m, fmt.Errorf("message event is empty")
+	}
+	if m.Event == errorEvent {
+		e := &errorMessage{}
+		if err = json.Unmarshal(m.Data, e); err != nil {
+			return m, fmt.Errorf("wrong error format, unable to decode: %s", err)
+		}
+		return m, e
+	}
+	return m, nil
+}
+
+// Parses order_book payload and returns best bid and ask as crypto.Tick
+func parseOrderBook(data []byte, pair crypto.Pair) (tick crypto.Tick, err error) {
+	ob := orderBook{}
+	if err = json.Unmarshal(data, &ob); err != nil {
+		return tick, fmt.Errorf("wrong order book format of %s, unable to decode: %s", pair.String(), err)
+	}
+	if len(ob.Bids) == 0 || len(ob.Asks) == 0 {
+		return tick, fmt.Errorf("order book of %s has empty side", pair.String())
+	}
+	tick.P = pair
+	tick.ExchangeId = exchangeName
+	if tick.T, err = parseMicroTimestamp(ob.MicroTimestamp); err != nil {
+		return tick, err
+	}
+	if tick.Bid, err = crypto.NewDecimal(ob.Bids[0][0]); err != nil {
+		return tick, fmt.Errorf("bad bid of %s: %s", pair.String(), err)
+	}
+	if tick.Ask, err = crypto.NewDecimal(ob.Asks[0][0]); err != nil {
+		return tick, fmt.Errorf("bad ask of %s: %s", pair.String(), err)
+	}
+	return tick, nil
+}
+
+// Parses live_trades payload and converts it to crypto.Trade
+func parseTrade(data []byte, pair crypto.Pair) (trade crypto.Trade, err error) {
+	lt := liveTrade{}
+	if err = json.Unmarshal(data, &lt); err != nil {
+		return trade, fmt.Errorf("wrong trade format of %s, unable to decode: %s", pair.String(), err)
+	}
+	trade.P = pair
+	trade.ExchangeId = exchangeName
+	trade.Id = strconv.FormatInt(lt.Id, 10)
+	if trade.T, err = parseMicroTimestamp(lt.MicroTimestamp); err != nil {
+		return trade, err
+	}
+	if trade.Price, err = crypto.NewDecimal(lt.Price); err != nil {
+		return trade, fmt.Errorf("bad price of trade %s: %s", trade.Id, err)
+	}
+	if trade.Size, err = crypto.NewDecimal(lt.Amount); err != nil {
+		return trade, fmt.Errorf("bad amount of trade %s: %s", trade.Id, err)
+	}
+	buy, sell := strconv.FormatInt(lt.BuyOrderId, 10), strconv.FormatInt(lt.SellOrderId, 10)
+	switch lt.Type {
+	case 0:
+		// taker bought from resting sell order
+		trade.Side, trade.MakerOrderId, trade.TakerOrderId = crypto.Ask, sell, buy
+	case 1:
+		trade.Side, trade.MakerOrderId, trade.TakerOrderId = crypto.Bid, buy, sell
+	default:
+		return trade, fmt.Errorf("unknown type of trade %s: %d", trade.Id, lt.Type)
+	}
+	return trade, nil
+}
+
+// Parses unix time in microseconds, e.g. 1643643584684047
+func parseMicroTimestamp(s string) (time.Time, error) {
+	us, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad microtimestamp: %s", s)
+	}
+	return time.Unix(0, us*int64(time.Microsecond)).UTC(), nil
+}
@@ -0,0 +1,116 @@
+package bitstamp
+
+import (
+	"errors"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const (
+	orderBookFixture  = `{"data":{"timestamp":"1643643584","microtimestamp":"1643643584684047","bids":[["33410","0.10000000"],["33409","0.20000000"]],"asks":[["33420","0.05000000"],["33421","1.00000000"]]},"channel":"order_book_btceur","event":"data"}`
+	liveTradeFixture  = `{"data":{"id":219400001,"timestamp":"1643643585","amount":0.0125,"amount_str":"0.01250000","price":33415,"price_str":"33415","type":0,"microtimestamp":"1643643585000123","buy_order_id":1451870000,"sell_order_id":1451869999},"channel":"live_trades_btceur","event":"trade"}`
+	reconnectFixture  = `{"event":"bts:request_reconnect","channel":"","data":""}`
+	subscribedFixture = `{"event":"bts:subscription_succeeded","channel":"order_book_btceur","data":{}}`
+)
+
+func Test_symbol(t *testing.T) {
+	btc_eur, _ := crypto.NewPair("btc", "eur")
+	assert.Equal(t, "btceur", symbol(btc_eur))
+}
+
+func Test_parseMessage(t *testing.T) {
+	cases := []struct {
+		msg      string
+		event    string
+		channel  string
+		hasError bool
+	}{
+		{orderBookFixture, dataEvent, "order_book_btceur", false},
+		{liveTradeFixture, tradeEvent, "live_trades_btceur", false},
+		{reconnectFixture, requestReconnectEvent, "", false},
+		{subscribedFixture, "bts:subscription_succeeded", "order_book_btceur", false},
+		{`{"channel":"order_book_btceur"}`, "", "", true},
+		{`not json`, "", "", true},
+		{`{"event":"bts:error","channel":"","data":"x"}`, "", "", true},
+	}
+	for _, testCase := range cases {
+		m, err := parseMessage([]byte(testCase.msg))
+		if testCase.hasError {
+			assert.Error(t, err, testCase.msg)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.event, m.Event)
+		assert.Equal(t, testCase.channel, m.Channel)
+	}
+
+	var errMsg *errorMessage
+	_, err := parseMessage([]byte(`{"event":"bts:error","channel":"","data":{"code":null,"message":"Bad subscription string."}}`))
+	assert.True(t, errors.As(err, &errMsg))
+	assert.Equal(t, "Bad subscription string.", errMsg.Message)
+}
+
+func Test_parseOrderBook(t *testing.T) {
+	btc_eur, _ := crypto.NewPair("btc", "eur")
+	m, _ := parseMessage([]byte(orderBookFixture))
+	tick, err := parseOrderBook(m.Data, btc_eur)
+	assert.NoError(t, err)
+	assert.Equal(t, crypto.Tick{
+		T:          time.Unix(1643643584, 684047000).UTC(),
+		P:          btc_eur,
+		Bid:        crypto.MustDecimal("33410"),
+		Ask:        crypto.MustDecimal("33420"),
+		ExchangeId: "bitstamp",
+	}, tick)
+
+	cases := []string{
+		`{"microtimestamp":"1","bids":[],"asks":[["1","1"]]}`,
+		`{"microtimestamp":"1","bids":[["1","1"]],"asks":[]}`,
+		`{"microtimestamp":"x","bids":[["1","1"]],"asks":[["1","1"]]}`,
+		`{"microtimestamp":"1","bids":[["x","1"]],"asks":[["1","1"]]}`,
+		`{"microtimestamp":"1","bids":[["1","1"]],"asks":[["","1"]]}`,
+		`[]`,
+	}
+	for _, data := range cases {
+		_, err = parseOrderBook([]byte(data), btc_eur)
+		assert.Error(t, err, data)
+	}
+}
+
+func Test_parseTrade(t *testing.T) {
+	btc_eur, _ := crypto.NewPair("btc", "eur")
+	m, _ := parseMessage([]byte(liveTradeFixture))
+	trade, err := parseTrade(m.Data, btc_eur)
+	assert.NoError(t, err)
+	assert.Equal(t, crypto.Trade{
+		T:            time.Unix(1643643585, 123000).UTC(),
+		P:            btc_eur,
+		Id:           "219400001",
+		Price:        crypto.MustDecimal("33415"),
+		Size:         crypto.MustDecimal("0.01250000"),
+		Side:         crypto.Ask,
+		MakerOrderId: "1451869999",
+		TakerOrderId: "1451870000",
+		ExchangeId:   "bitstamp",
+	}, trade)
+
+	trade, err = parseTrade([]byte(`{"id":1,"microtimestamp":"1","amount_str":"1","price_str":"1","type":1,"buy_order_id":10,"sell_order_id":20}`), btc_eur)
+	assert.NoError(t, err)
+	assert.Equal(t, crypto.Bid, trade.Side)
+	assert.Equal(t, "10", trade.MakerOrderId)
+	assert.Equal(t, "20", trade.TakerOrderId)
+
+	cases := []string{
+		`{"id":1,"microtimestamp":"1","amount_str":"1","price_str":"1","type":2}`,
+		`{"id":1,"microtimestamp":"x","amount_str":"1","price_str":"1","type":0}`,
+		`{"id":1,"microtimestamp":"1","amount_str":"1","price_str":"x","type":0}`,
+		`{"id":1,"microtimestamp":"1","amount_str":"","price_str":"1","type":0}`,
+		`[]`,
+	}
+	for _, data := range cases {
+		_, err = parseTrade([]byte(data), btc_eur)
+		assert.Error(t, err, data)
+	}
+}
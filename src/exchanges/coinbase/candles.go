@@ -0,0 +1,175 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Max count of candles returned by one request according to Coinbase API
+const candlesPerRequest = 300
+
+// Count of retries if request is rate limited
+const rateLimitRetries = 5
+
+// Default delay between candles requests, Coinbase public API allows 3 requests per second
+const DefaultRequestDelay = 350 * time.Millisecond
+
+// Granularities supported by Coinbase API
+var granularities = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+// CandleWriter is a destination of backfilled candles, e.g. storage.Storage
+type CandleWriter interface {
+	WriteCandle(candle crypto.Candle) error
+}
+
+// CandleResumer can be implemented by CandleWriter to resume backfill after the last stored candle
+// Returns zero time if there are no candles of pair and interval
+type CandleResumer interface {
+	LastCandle(pair crypto.Pair, interval time.Duration) (time.Time, error)
+}
+
+// Returns error if granularity isn't supported by Coinbase API
+func validGranularity(granularity time.Duration) error {
+	for _, g := range granularities {
+		if g == granularity {
+			return nil
+		}
+	}
+	return fmt.Errorf("granularity is not supported: %s", granularity)
+}
+
+// Returns candles out of Coinbase's [time, low, high, open, close, volume] format sorted by time
+func parseCandles(msg []byte, pair crypto.Pair, granularity time.Duration) ([]crypto.Candle, error) {
+	var raw [][6]json.Number
+	if err := json.Unmarshal(msg, &raw); err != nil {
+		return nil, fmt.Errorf("wrong candles format, unable to unmarshall: %s", string(msg))
+	}
+	candles := make([]crypto.Candle, 0, len(raw))
+	for _, r := range raw {
+		ts, err := r[0].Int64()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert candle's time to int64: %s", r[0])
+		}
+		var values [5]crypto.Decimal
+		for i := range values {
+			values[i], err = crypto.NewDecimal(r[i+1].String())
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert candle's value to decimal: %s", r[i+1])
+			}
+		}
+		candles = append(candles, crypto.Candle{
+			T:        time.Unix(ts, 0).UTC(),
+			P:        pair,
+			Interval: granularity,
+			Low:      values[0],
+			High:     values[1],
+			Open:     values[2],
+			Close:    values[3],
+			Volume:   values[4],
+		})
+	}
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].T.Before(candles[j].T)
+	})
+	return candles, nil
+}
+
+// Requests candles of pair in range [start, end]
+// Retries request if it has been rate limited
+func (cbr *CoinbaseREST) fetchCandles(pair crypto.Pair, start time.Time, end time.Time, granularity time.Duration) ([]crypto.Candle, error) {
+	productId := pair.String(PairDelimiter)
+	url := fmt.Sprintf("%s/products/%s/candles?start=%s&end=%s&granularity=%d", cbr.url, productId,
+		start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339), int(granularity.Seconds()))
+	for retry := 0; ; retry++ {
+		resp, err := cbr.client.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && retry < rateLimitRetries {
+			resp.Body.Close()
+			cbr.log(fmt.Sprintf("candles of %s are rate limited, retry %d", productId, retry+1))
+			time.Sleep(cbr.requestDelay * time.Duration(retry+2))
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status of %s candles: %s", productId, resp.Status)
+		}
+		var msg json.RawMessage
+		err = json.NewDecoder(resp.Body).Decode(&msg)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("wrong candles format of %s, unable to decode: %s", productId, err)
+		}
+		return parseCandles(msg, pair, granularity)
+	}
+}
+
+// Sets delay between candles requests to respect rate limits. DefaultRequestDelay is used by default
+func (cbr *CoinbaseREST) SetRequestDelay(delay time.Duration) error {
+	if delay < 0 {
+		return fmt.Errorf("request delay should not be negative: %s", delay)
+	}
+	cbr.requestDelay = delay
+	return nil
+}
+
+// Backfill pages through candles of pair in range [from, to) and writes them to w
+// If w implements CandleResumer backfill starts after the last stored candle
+// Returns count of written candles
+func (cbr *CoinbaseREST) Backfill(pair crypto.Pair, from time.Time, to time.Time, granularity time.Duration, w CandleWriter) (n int, err error) {
+	if err = validGranularity(granularity); err != nil {
+		return 0, err
+	}
+	if cbr.client == nil {
+		if err = cbr.Dial(); err != nil {
+			return 0, err
+		}
+	}
+	if resumer, ok := w.(CandleResumer); ok {
+		last, err := resumer.LastCandle(pair, granularity)
+		if err != nil {
+			return 0, err
+		}
+		if !last.IsZero() && !last.Before(from) {
+			from = last.Add(granularity)
+		}
+	}
+	from = from.Truncate(granularity)
+
+	window := granularity * candlesPerRequest
+	for start := from; start.Before(to); start = start.Add(window) {
+		end := start.Add(window)
+		if end.After(to) {
+			end = to
+		}
+		if start != from {
+			time.Sleep(cbr.requestDelay)
+		}
+		candles, err := cbr.fetchCandles(pair, start, end, granularity)
+		if err != nil {
+			return n, err
+		}
+		for _, candle := range candles {
+			if candle.T.Before(start) || !candle.T.Before(end) {
+				continue
+			}
+			if err = w.WriteCandle(candle); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
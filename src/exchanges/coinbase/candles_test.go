@@ -0,0 +1,151 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Collects written candles, resumes after last if it's set
+type fCandleWriter struct {
+	candles []crypto.Candle
+	last    time.Time
+}
+
+func (w *fCandleWriter) WriteCandle(candle crypto.Candle) error {
+	w.candles = append(w.candles, candle)
+	return nil
+}
+
+func (w *fCandleWriter) LastCandle(pair crypto.Pair, interval time.Duration) (time.Time, error) {
+	return w.last, nil
+}
+
+// Starts local REST server which responds with every minute candle in requested range, newest first
+// First request of every range is rate limited
+func newCandlesServer(t *testing.T, requests *int) *httptest.Server {
+	limited := map[string]bool{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if !limited[r.URL.RawQuery] {
+			limited[r.URL.RawQuery] = true
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		start, err := time.Parse(time.RFC3339, r.URL.Query().Get("start"))
+		assert.NoError(t, err)
+		end, err := time.Parse(time.RFC3339, r.URL.Query().Get("end"))
+		assert.NoError(t, err)
+		granularity, err := strconv.Atoi(r.URL.Query().Get("granularity"))
+		assert.NoError(t, err)
+		var candles [][6]float64
+		for ts := end.Unix(); ts >= start.Unix(); ts -= int64(granularity) {
+			candles = append(candles, [6]float64{float64(ts), 1, 4, 2, 3, 10})
+		}
+		_ = json.NewEncoder(w).Encode(candles)
+	}))
+}
+
+func Test_validGranularity(t *testing.T) {
+	assert.NoError(t, validGranularity(time.Minute))
+	assert.NoError(t, validGranularity(24*time.Hour))
+	assert.Error(t, validGranularity(2*time.Minute))
+}
+
+func Test_parseCandles(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	cases := []struct {
+		msg      []byte
+		expected []crypto.Candle
+		hasError bool
+	}{
+		{
+			msg: []byte(`[[120, 1, 4, 2, 3, 10], [60, 1.5, 2.5, 2, 2, 0.5]]`),
+			expected: []crypto.Candle{
+				{T: time.Unix(60, 0).UTC(), P: btc_usd, Interval: time.Minute, Open: crypto.MustDecimal("2"), High: crypto.MustDecimal("2.5"), Low: crypto.MustDecimal("1.5"), Close: crypto.MustDecimal("2"), Volume: crypto.MustDecimal("0.5")},
+				{T: time.Unix(120, 0).UTC(), P: btc_usd, Interval: time.Minute, Open: crypto.MustDecimal("2"), High: crypto.MustDecimal("4"), Low: crypto.MustDecimal("1"), Close: crypto.MustDecimal("3"), Volume: crypto.MustDecimal("10")},
+			},
+		},
+		{msg: []byte(`[]`), expected: []crypto.Candle{}},
+		{msg: []byte(`{"message":"NotFound"}`), hasError: true},
+		{msg: []byte(`[["X", 1, 4, 2, 3, 10]]`), hasError: true},
+		{msg: []byte(`[[1.5, 1, 4, 2, 3, 10]]`), hasError: true},
+	}
+	for _, testCase := range cases {
+		candles, err := parseCandles(testCase.msg, btc_usd, time.Minute)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, candles)
+	}
+}
+
+func TestCoinbaseREST_SetRequestDelay(t *testing.T) {
+	cbr := NewREST()
+	assert.Equal(t, DefaultRequestDelay, cbr.requestDelay)
+	assert.Error(t, cbr.SetRequestDelay(-time.Second))
+	assert.NoError(t, cbr.SetRequestDelay(0))
+	assert.Equal(t, time.Duration(0), cbr.requestDelay)
+}
+
+func TestCoinbaseREST_Backfill(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	from := time.Unix(0, 0).UTC()
+	to := from.Add(700 * time.Minute)
+
+	t.Run("pages through range respecting bucket limit", func(t *testing.T) {
+		requests := 0
+		server := newCandlesServer(t, &requests)
+		defer server.Close()
+
+		cbr := NewREST()
+		cbr.SetURL(server.URL)
+		assert.NoError(t, cbr.SetRequestDelay(time.Millisecond))
+		w := &fCandleWriter{}
+		n, err := cbr.Backfill(btc_usd, from, to, time.Minute, w)
+		assert.NoError(t, err)
+		assert.Equal(t, 700, n)
+		assert.Equal(t, 6, requests)
+		for i, candle := range w.candles {
+			assert.Equal(t, from.Add(time.Duration(i)*time.Minute), candle.T)
+		}
+	})
+
+	t.Run("resumes after the last stored candle", func(t *testing.T) {
+		requests := 0
+		server := newCandlesServer(t, &requests)
+		defer server.Close()
+
+		cbr := NewREST()
+		cbr.SetURL(server.URL)
+		assert.NoError(t, cbr.SetRequestDelay(time.Millisecond))
+		w := &fCandleWriter{last: to.Add(-11 * time.Minute)}
+		n, err := cbr.Backfill(btc_usd, from, to, time.Minute, w)
+		assert.NoError(t, err)
+		assert.Equal(t, 10, n)
+		assert.Equal(t, to.Add(-10*time.Minute), w.candles[0].T)
+	})
+
+	t.Run("returns error on wrong granularity or failed request", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"NotFound"}`)
+		}))
+		defer server.Close()
+
+		cbr := NewREST()
+		cbr.SetURL(server.URL)
+		_, err := cbr.Backfill(btc_usd, from, to, 2*time.Minute, &fCandleWriter{})
+		assert.Error(t, err)
+		_, err = cbr.Backfill(btc_usd, from, to, time.Minute, &fCandleWriter{})
+		assert.Error(t, err)
+	})
+}
@@ -4,10 +4,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
 	"io"
 	"log"
 )
 
+// Name of exchange, ticks are marked by it
+const exchangeName = "coinbase"
+
 // Delimiter according to Coinbase API
 const PairDelimiter = '-'
 
@@ -16,12 +21,22 @@ const tickerChannelName = "ticker"
 
 // Coinbase is a base object for all other Protocol
 type Coinbase struct {
-	tick chan crypto.Tick
+	tick  chan crypto.Tick
+	book  chan crypto.BookUpdate
+	trade chan crypto.Trade
+
+	// order books by product id, maintained by level2 channel
+	books map[string]*crypto.OrderBook
 
-	pairs    []crypto.Pair
+	pairs    exchanges.Pairs
 	channels []string
+	// message of exchange is kept in ticks
+	raw bool
 
 	logger *log.Logger
+
+	// stop signal, Stop may be invoked before Serve
+	stopper lifecycle.Stopper
 }
 
 // Base message exchange format provided by Coinbase API
@@ -40,7 +55,7 @@ type coinbaseSubscribe struct {
 
 // Returns error if some of required fields hasn't been initialized
 func (cb *Coinbase) isValidSetup() error {
-	if len(cb.pairs) == 0 {
+	if len(cb.pairs.Get()) == 0 {
 		return fmt.Errorf("pairs aren't set")
 	}
 	if len(cb.channels) == 0 {
@@ -56,6 +71,19 @@ func (cb *Coinbase) log(v interface{}) {
 	}
 }
 
+// Stops Exchanger, Serve returns lifecycle.StopError with UserStop reason
+// Safe to invoke several times and before Serve. Logs reason of the first stop
+func (cb *Coinbase) Stop(reason interface{}) {
+	if cb.stopper.Stop(lifecycle.UserStop, reason, nil) && reason != nil {
+		cb.log(reason)
+	}
+}
+
+// Keeps message of exchange in Raw of ticks, it's off by default. Must be invoked before Serve
+func (cb *Coinbase) SetRawPayload(on bool) {
+	cb.raw = on
+}
+
 // Sets logger as io.Writer interface
 func (cb *Coinbase) SetLogger(w io.Writer) {
 	cb.logger = log.New(w, "", log.Ldate|log.Ltime)
@@ -63,12 +91,7 @@ func (cb *Coinbase) SetLogger(w io.Writer) {
 
 // Sets slice of crypto.Pair, will be used for subscribe later on
 func (cb *Coinbase) SetPairs(pairs ...crypto.Pair) error {
-	if len(pairs) == 0 {
-		return fmt.Errorf("at least one pair should be set")
-	}
-	cb.pairs = make([]crypto.Pair, len(pairs))
-	copy(cb.pairs, pairs)
-	return nil
+	return cb.pairs.Set(pairs...)
 }
 
 // Returns chan of crypto.Tick
@@ -82,7 +105,57 @@ func (cb *Coinbase) Ticker() <-chan crypto.Tick {
 	return cb.tick
 }
 
+// Returns chan of crypto.BookUpdate
+// Order books are maintained per pair out of level2 channel
+// Chan will be closed on connection lost or after Stop() method
+func (cb *Coinbase) OrderBook() <-chan crypto.BookUpdate {
+	if cb.book != nil {
+		return cb.book
+	}
+	cb.channels = append(cb.channels, level2ChannelName)
+	cb.book = make(chan crypto.BookUpdate, 1)
+	return cb.book
+}
+
+// Returns chan of crypto.Trade out of matches channel
+// Chan will be closed on connection lost or after Stop() method
+func (cb *Coinbase) Trades() <-chan crypto.Trade {
+	if cb.trade != nil {
+		return cb.trade
+	}
+	cb.channels = append(cb.channels, matchesChannelName)
+	cb.trade = make(chan crypto.Trade, 1)
+	return cb.trade
+}
+
+// Closes all dedicated chans which have been requested
+func (cb *Coinbase) closeChannels() {
+	if cb.tick != nil {
+		close(cb.tick)
+		cb.tick = nil
+	}
+	if cb.book != nil {
+		close(cb.book)
+		cb.book = nil
+	}
+	if cb.trade != nil {
+		close(cb.trade)
+		cb.trade = nil
+	}
+}
+
+// serverError is returned by parseMessageType if Coinbase server sent error message
+type serverError struct {
+	Message string
+	Reason  string
+}
+
+func (e *serverError) Error() string {
+	return fmt.Sprintf("error received: %s, reason: %s", e.Message, e.Reason)
+}
+
 // Returns type of message from Coinbase server
+// Returns *serverError if message is an error sent by server
 func parseMessageType(msg []byte) (string, error) {
 	cbMsg := coinbaseMessage{}
 	err := json.Unmarshal(msg, &cbMsg)
@@ -90,7 +163,7 @@ func parseMessageType(msg []byte) (string, error) {
 		return "", fmt.Errorf("message type is empty")
 	}
 	if cbMsg.Type == "error" {
-		return "", fmt.Errorf("error received: %s, reason: %s", cbMsg.Message, cbMsg.Reason)
+		return "", &serverError{Message: cbMsg.Message, Reason: cbMsg.Reason}
 	}
 	return cbMsg.Type, err
 }
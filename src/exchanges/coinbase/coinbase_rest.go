@@ -0,0 +1,259 @@
+package coinbase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Default URL for Coinbase REST API
+const CoinbaseREST_URL = "https://api.pro.coinbase.com"
+
+// Default poll interval of REST protocol
+const DefaultPollInterval = 5 * time.Second
+
+// CoinbaseREST is used for REST Protocol. Polls ticker of every pair on interval
+type CoinbaseREST struct {
+	Coinbase
+	client   *http.Client
+	url      string
+	interval time.Duration
+
+	// delay between paged requests, e.g. candles
+	requestDelay time.Duration
+}
+
+// Coinbase REST ticker response format
+type restTicker struct {
+	Time    time.Time `json:"time"`
+	Bid     string    `json:"bid"`
+	Ask     string    `json:"ask"`
+	TradeId int64     `json:"trade_id"`
+	Price   string    `json:"price"`
+	Size    string    `json:"size"`
+	Volume  string    `json:"volume"`
+}
+
+// Registers coinbase for REST protocol
+func init() {
+	exchanges.Register(exchangeName, exchanges.REST, func() exchanges.Exchanger {
+		return NewREST()
+	}, exchanges.TickerChannel, exchanges.CandlesChannel)
+}
+
+// Creates new Coinbase Exchanger for REST protocol
+func NewREST() *CoinbaseREST {
+	c := new(CoinbaseREST)
+	c.url = CoinbaseREST_URL
+	c.interval = DefaultPollInterval
+	c.requestDelay = DefaultRequestDelay
+	return c
+}
+
+// Sets base URL of REST API, CoinbaseREST_URL is used by default
+func (cbr *CoinbaseREST) SetURL(url string) {
+	cbr.url = strings.TrimSuffix(url, "/")
+}
+
+// Sets interval between polls. Returns error if interval isn't positive
+func (cbr *CoinbaseREST) SetInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("poll interval should be positive: %s", interval)
+	}
+	cbr.interval = interval
+	return nil
+}
+
+// Checks base URL and prepares http client
+// Returns error if URL isn't valid
+func (cbr *CoinbaseREST) Dial() error {
+	return cbr.DialContext(context.Background())
+}
+
+// Same as Dial, there is no connection to establish, so ctx is only checked for being done
+func (cbr *CoinbaseREST) DialContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	u, err := url.Parse(cbr.url)
+	if err != nil {
+		cbr.log(err)
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		err = fmt.Errorf("unsupported URL scheme: %s", cbr.url)
+		cbr.log(err)
+		return err
+	}
+	cbr.client = &http.Client{Timeout: cbr.interval}
+	return nil
+}
+
+// Requests ticker of pair and returns it as crypto.Tick
+// Request is cancelled when ctx is done
+func (cbr *CoinbaseREST) fetchTick(ctx context.Context, pair crypto.Pair) (tick crypto.Tick, err error) {
+	productId := pair.String(PairDelimiter)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/products/%s/ticker", cbr.url, productId), nil)
+	if err != nil {
+		return tick, err
+	}
+	resp, err := cbr.client.Do(req)
+	if err != nil {
+		return tick, err
+	}
+	received := time.Now().UTC()
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return tick, fmt.Errorf("unexpected status of %s ticker: %s", productId, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return tick, err
+	}
+	rt := restTicker{}
+	err = json.Unmarshal(body, &rt)
+	if err != nil {
+		return tick, fmt.Errorf("wrong ticker format of %s, unable to decode: %s", productId, err)
+	}
+	t := Tick{Time: rt.Time, ProductId: productId, Bid: rt.Bid, Ask: rt.Ask, TradeId: rt.TradeId, Price: rt.Price, LastSize: rt.Size, Volume24h: rt.Volume}
+	if tick, err = t.wrap(); err != nil {
+		return tick, err
+	}
+	tick.Received = received
+	if cbr.raw {
+		tick.Raw = body
+	}
+	return tick, nil
+}
+
+// Coinbase REST product response format
+type restProduct struct {
+	Id            string `json:"id"`
+	BaseCurrency  string `json:"base_currency"`
+	QuoteCurrency string `json:"quote_currency"`
+}
+
+// Returns all pairs available on Coinbase
+func (cbr *CoinbaseREST) Products() ([]crypto.Pair, error) {
+	if cbr.client == nil {
+		if err := cbr.Dial(); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := cbr.client.Get(cbr.url + "/products")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status of products: %s", resp.Status)
+	}
+	var products []restProduct
+	if err = json.NewDecoder(resp.Body).Decode(&products); err != nil {
+		return nil, fmt.Errorf("wrong products format, unable to decode: %s", err)
+	}
+	pairs := make([]crypto.Pair, 0, len(products))
+	for _, product := range products {
+		pair, err := crypto.NewPair(product.BaseCurrency, product.QuoteCurrency)
+		if err != nil {
+			cbr.log(fmt.Errorf("skip product %s: %s", product.Id, err))
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, nil
+}
+
+// Replaces pairs, next poll requests new pairs only
+func (cbr *CoinbaseREST) UpdatePairs(pairs ...crypto.Pair) error {
+	return cbr.SetPairs(pairs...)
+}
+
+// Polls ticker of every pair and sends it to tick chan
+// Returns as soon as ctx is done
+func (cbr *CoinbaseREST) poll(ctx context.Context) {
+	for _, pair := range cbr.pairs.Get() {
+		tick, err := cbr.fetchTick(ctx, pair)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			cbr.log(err)
+			continue
+		}
+		select {
+		case cbr.tick <- tick:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Returns error if setup isn't valid or channel isn't supported by REST
+func (cbr *CoinbaseREST) isValidSetup() error {
+	if err := cbr.Coinbase.isValidSetup(); err != nil {
+		return err
+	}
+	for _, channel := range cbr.channels {
+		if channel != tickerChannelName {
+			return fmt.Errorf("channel is not supported by REST protocol: %s", channel)
+		}
+	}
+	if cbr.client == nil {
+		return fmt.Errorf("Dial() should be invoked before Serve()")
+	}
+	return nil
+}
+
+// Serve polls tickers on interval until Stop
+// Returns error if setup isn't valid
+func (cbr *CoinbaseREST) Serve() error {
+	err := cbr.ServeContext(context.Background())
+	if lifecycle.ReasonOf(err) == lifecycle.UserStop {
+		return nil
+	}
+	return err
+}
+
+// ServeContext polls tickers on interval until Stop or ctx is done. Closes dedicated chans on return
+// Returns error if setup isn't valid, otherwise *lifecycle.StopError describing why Exchanger has stopped
+func (cbr *CoinbaseREST) ServeContext(ctx context.Context) error {
+	err := cbr.isValidSetup()
+	if err != nil {
+		cbr.log(err)
+		cbr.closeChannels()
+		return err
+	}
+
+	stopper := &cbr.stopper
+	go stopper.Watch(ctx)
+	// cancels requests in flight on Stop as well
+	pollCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-stopper.Done()
+		cancel()
+	}()
+
+	ticker := time.NewTicker(cbr.interval)
+	defer ticker.Stop()
+
+	cbr.poll(pollCtx)
+	for {
+		select {
+		case <-stopper.Done():
+			cbr.closeChannels()
+			return stopper.Err()
+		case <-ticker.C:
+			cbr.poll(pollCtx)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package coinbase
+
+import (
+	"context"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Starts local REST server which responds with ticker of BTC-USD only
+func newRESTServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/products/BTC-USD/ticker", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"trade_id":1,"price":"2","size":"1","bid":"1.5","ask":"2.5","volume":"10","time":"1970-01-01T00:00:01Z"}`)
+	})
+	mux.HandleFunc("/products", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"id":"BTC-USD","base_currency":"BTC","quote_currency":"USD"},{"id":"X-USD","base_currency":"X","quote_currency":"USD"}]`)
+	})
+	mux.HandleFunc("/products/ETH-USD/ticker", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"bid":1}`)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestNewREST(t *testing.T) {
+	cbr := NewREST()
+	assert.Equal(t, CoinbaseREST_URL, cbr.url)
+	assert.Equal(t, DefaultPollInterval, cbr.interval)
+}
+
+func TestCoinbaseREST_SetURL(t *testing.T) {
+	cbr := NewREST()
+	cbr.SetURL("http://127.0.0.1/")
+	assert.Equal(t, "http://127.0.0.1", cbr.url)
+}
+
+func TestCoinbaseREST_SetInterval(t *testing.T) {
+	cbr := NewREST()
+	assert.Error(t, cbr.SetInterval(0))
+	assert.NoError(t, cbr.SetInterval(time.Second))
+	assert.Equal(t, time.Second, cbr.interval)
+}
+
+func TestCoinbaseREST_Dial(t *testing.T) {
+	cases := []struct {
+		url      string
+		hasError bool
+	}{
+		{CoinbaseREST_URL, false},
+		{"http://127.0.0.1:8080", false},
+		{"ws://127.0.0.1", true},
+		{"://", true},
+	}
+	for _, testCase := range cases {
+		cbr := NewREST()
+		cbr.SetURL(testCase.url)
+		err := cbr.Dial()
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.NotNil(t, cbr.client)
+	}
+}
+
+func TestCoinbaseREST_fetchTick(t *testing.T) {
+	server := newRESTServer()
+	defer server.Close()
+
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	eth_usd, _ := crypto.NewPair("eth", "usd")
+	xrp_usd, _ := crypto.NewPair("xrp", "usd")
+	cases := []struct {
+		pair         crypto.Pair
+		expectedTick crypto.Tick
+		hasError     bool
+	}{
+		{btc_usd, crypto.Tick{T: time.Unix(1, 0).UTC(), P: btc_usd, Bid: crypto.MustDecimal("1.5"), Ask: crypto.MustDecimal("2.5"),
+			ExchangeId: "coinbase", TradeId: 1, Price: crypto.MustDecimal("2"), Size: crypto.MustDecimal("1"), Volume24h: crypto.MustDecimal("10")}, false},
+		{eth_usd, crypto.Tick{}, true},
+		{xrp_usd, crypto.Tick{}, true},
+	}
+	cbr := NewREST()
+	cbr.SetURL(server.URL)
+	assert.NoError(t, cbr.Dial())
+	for _, testCase := range cases {
+		tick, err := cbr.fetchTick(context.Background(), testCase.pair)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.False(t, tick.Received.IsZero())
+		tick.Received = time.Time{}
+		assert.Equal(t, testCase.expectedTick, tick)
+	}
+
+	// response is kept as raw payload
+	cbr.SetRawPayload(true)
+	tick, err := cbr.fetchTick(context.Background(), btc_usd)
+	assert.NoError(t, err)
+	assert.Contains(t, string(tick.Raw), `"trade_id":1`)
+}
+
+func TestCoinbaseREST_Products(t *testing.T) {
+	server := newRESTServer()
+	defer server.Close()
+
+	cbr := NewREST()
+	cbr.SetURL(server.URL)
+	pairs, err := cbr.Products()
+	assert.NoError(t, err)
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	assert.Equal(t, []crypto.Pair{btc_usd}, pairs)
+
+	cbr.SetURL(server.URL + "/wrong")
+	_, err = cbr.Products()
+	assert.Error(t, err)
+}
+
+func TestCoinbaseREST_Serve(t *testing.T) {
+	t.Run("Serve returns error on invalid setup", func(t *testing.T) {
+		btc_usd, _ := crypto.NewPair("btc", "usd")
+		cbr := NewREST()
+		assert.Error(t, cbr.Serve())
+
+		assert.NoError(t, cbr.SetPairs(btc_usd))
+		cbr.Ticker()
+		assert.Error(t, cbr.Serve())
+
+		assert.NoError(t, cbr.Dial())
+		cbr.OrderBook()
+		assert.Error(t, cbr.Serve())
+	})
+
+	t.Run("Serve closes chans on invalid setup", func(t *testing.T) {
+		btc_usd, _ := crypto.NewPair("btc", "usd")
+		cbr := NewREST()
+		assert.NoError(t, cbr.SetPairs(btc_usd))
+		ticks := cbr.Ticker()
+		trades := cbr.Trades()
+		assert.NoError(t, cbr.Dial())
+		assert.Error(t, cbr.Serve())
+
+		_, ok := <-ticks
+		assert.False(t, ok)
+		_, ok = <-trades
+		assert.False(t, ok)
+	})
+
+	t.Run("Serve polls tickers until Stop", func(t *testing.T) {
+		server := newRESTServer()
+		defer server.Close()
+
+		btc_usd, _ := crypto.NewPair("btc", "usd")
+		eth_usd, _ := crypto.NewPair("eth", "usd")
+		cbr := NewREST()
+		cbr.SetURL(server.URL)
+		assert.NoError(t, cbr.SetInterval(10*time.Millisecond))
+		assert.NoError(t, cbr.SetPairs(btc_usd, eth_usd))
+		ticks := cbr.Ticker()
+		assert.NoError(t, cbr.Dial())
+
+		served := make(chan error)
+		go func() {
+			served <- cbr.Serve()
+		}()
+		for i := 0; i < 3; i++ {
+			tick := <-ticks
+			assert.Equal(t, btc_usd, tick.P)
+		}
+		cbr.Stop(nil)
+		cbr.Stop(nil)
+		for range ticks {
+		}
+		assert.NoError(t, <-served)
+	})
+
+	t.Run("ServeContext returns on context cancel", func(t *testing.T) {
+		server := newRESTServer()
+		defer server.Close()
+
+		btc_usd, _ := crypto.NewPair("btc", "usd")
+		cbr := NewREST()
+		cbr.SetURL(server.URL)
+		assert.NoError(t, cbr.SetInterval(10*time.Millisecond))
+		assert.NoError(t, cbr.SetPairs(btc_usd))
+		ticks := cbr.Ticker()
+		ctx, cancel := context.WithCancel(context.Background())
+		assert.NoError(t, cbr.DialContext(ctx))
+
+		served := make(chan error)
+		go func() {
+			served <- cbr.ServeContext(ctx)
+		}()
+		<-ticks
+		cancel()
+		for range ticks {
+		}
+		err := <-served
+		assert.Equal(t, lifecycle.ContextDone, lifecycle.ReasonOf(err))
+		assert.Error(t, cbr.DialContext(ctx))
+	})
+}
+
+func TestCoinbaseREST_UpdatePairs(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	cbr := NewREST()
+	assert.NoError(t, cbr.UpdatePairs(btc_usd))
+	assert.Equal(t, []crypto.Pair{btc_usd}, cbr.pairs.Get())
+	assert.Error(t, cbr.UpdatePairs())
+}
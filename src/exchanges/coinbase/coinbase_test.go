@@ -1,6 +1,7 @@
 package coinbase
 
 import (
+	"errors"
 	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
 	"github.com/stretchr/testify/assert"
 	"os"
@@ -31,7 +32,7 @@ func TestCoinbase_SetPairs(t *testing.T) {
 			assert.Error(t, err)
 			continue
 		}
-		assert.Equal(t, testCase.len, len(c.pairs))
+		assert.Equal(t, testCase.len, len(c.pairs.Get()))
 	}
 }
 
@@ -64,6 +65,64 @@ func TestCoinbase_Ticker(t *testing.T) {
 	})
 }
 
+func TestCoinbase_OrderBook(t *testing.T) {
+	t.Run("OrderBook is singleton", func(t *testing.T) {
+		expected := make(chan crypto.BookUpdate, 1)
+		c := Coinbase{
+			book:     expected,
+			channels: []string{},
+		}
+		assert.EqualValues(t, expected, c.OrderBook())
+		assert.EqualValues(t, []string{}, c.channels)
+	})
+
+	t.Run("OrderBook appends level2 channel for subscribe", func(t *testing.T) {
+		c := Coinbase{}
+		c.Ticker()
+		c.OrderBook()
+		assert.Equal(t, []string{tickerChannelName, level2ChannelName}, c.channels)
+		assert.Equal(t, 1, cap(c.book))
+	})
+}
+
+func TestCoinbase_Trades(t *testing.T) {
+	t.Run("Trades is singleton", func(t *testing.T) {
+		expected := make(chan crypto.Trade, 1)
+		c := Coinbase{
+			trade:    expected,
+			channels: []string{},
+		}
+		assert.EqualValues(t, expected, c.Trades())
+		assert.EqualValues(t, []string{}, c.channels)
+	})
+
+	t.Run("Trades appends matches channel for subscribe", func(t *testing.T) {
+		c := Coinbase{}
+		c.Trades()
+		assert.Equal(t, []string{matchesChannelName}, c.channels)
+		assert.Equal(t, 1, cap(c.trade))
+	})
+}
+
+func TestCoinbase_closeChannels(t *testing.T) {
+	c := Coinbase{}
+	c.closeChannels()
+
+	tick := c.Ticker()
+	book := c.OrderBook()
+	trade := c.Trades()
+	c.closeChannels()
+	_, ok := <-tick
+	assert.False(t, ok)
+	_, ok = <-book
+	assert.False(t, ok)
+	_, ok = <-trade
+	assert.False(t, ok)
+	assert.Nil(t, c.tick)
+	assert.Nil(t, c.book)
+	assert.Nil(t, c.trade)
+}
+
 func Test_isValidSetup(t *testing.T) {
 	cases := []struct {
 		pairs    []crypto.Pair
@@ -78,7 +137,7 @@ func Test_isValidSetup(t *testing.T) {
 	}
 	for _, testCase := range cases {
 		c := Coinbase{}
-		c.pairs = testCase.pairs
+		_ = c.pairs.Set(testCase.pairs...)
 		c.channels = testCase.channels
 		err := c.isValidSetup()
 		if testCase.hasError {
@@ -108,4 +167,9 @@ func Test_parseMessageType(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, testCase.expectedMessage.Type, actualMessageType)
 	}
+
+	_, err := parseMessageType([]byte(`{"type":"error","message":"Failed to subscribe","reason":"BTC-XXX is not a valid product"}`))
+	var srvErr *serverError
+	assert.True(t, errors.As(err, &srvErr))
+	assert.Equal(t, "BTC-XXX is not a valid product", srvErr.Reason)
 }
@@ -1,8 +1,16 @@
 package coinbase
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
 	"github.com/gorilla/websocket"
+	"sync"
+	"time"
 )
 
 // Default URL for Coibase Websocket connection
@@ -12,9 +20,21 @@ const CoinbaseWS_URL = "wss://ws-feed.pro.coinbase.com"
 type CoinbaseWS struct {
 	Coinbase
 	conn *websocket.Conn
+	url  string
 
-	// finish chan
-	done chan bool
+	// connection supports one concurrent writer only, guards conn replacement too
+	writeMu sync.Mutex
+
+	// reconnect policy and chan of reconnect events for caller
+	policy reconnect.Policy
+	events reconnect.Events
+}
+
+// Registers coinbase for WebSocket protocol
+func init() {
+	exchanges.Register(exchangeName, exchanges.WebSocket, func() exchanges.Exchanger {
+		return NewWS()
+	}, exchanges.TickerChannel, exchanges.TradesChannel, exchanges.Level2Channel)
 }
 
 // Creates new Coinbase Exchanger. Depends on the protocol
@@ -22,53 +42,164 @@ type CoinbaseWS struct {
 // error occurs if protocol has no implementation yet
 func NewWS() *CoinbaseWS {
 	c := new(CoinbaseWS)
+	c.url = CoinbaseWS_URL
+	c.policy = reconnect.DefaultPolicy
 	return c
 }
 
+// Sets URL of websocket server, CoinbaseWS_URL is used by default
+func (cbw *CoinbaseWS) SetURL(url string) {
+	cbw.url = url
+}
+
+// Sets reconnect.Policy which is used when connection is lost
+// Returns error if policy isn't valid
+func (cbw *CoinbaseWS) SetReconnectPolicy(policy reconnect.Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	cbw.policy = policy
+	return nil
+}
+
+// Returns chan of reconnect.Event
+// Events are dropped if nobody reads the chan
+func (cbw *CoinbaseWS) Events() <-chan reconnect.Event {
+	return cbw.events.Chan()
+}
+
+// Sends event to events chan without blocking and logs it
+func (cbw *CoinbaseWS) emit(event reconnect.Event) {
+	cbw.log(cbw.events.Emit(event))
+}
+
 // Dials to predefined URL in Protocol
 // Returns error is Dial to server failed
-func (cbw *CoinbaseWS) Dial() (err error) {
-	cbw.conn, _, err = websocket.DefaultDialer.Dial(CoinbaseWS_URL, nil)
+func (cbw *CoinbaseWS) Dial() error {
+	return cbw.DialContext(context.Background())
+}
+
+// Dials to predefined URL in Protocol, ctx limits time of handshake
+// Returns error is Dial to server failed or Exchanger has been stopped
+func (cbw *CoinbaseWS) DialContext(ctx context.Context) error {
+	if cbw.url == "" {
+		cbw.url = CoinbaseWS_URL
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, cbw.url, nil)
 	if err != nil {
 		cbw.log(err)
 		return err
 	}
+	cbw.writeMu.Lock()
+	defer cbw.writeMu.Unlock()
+	// ServeContext closes connection on stop under writeMu, don't leak the one dialed after it
+	if cbw.stopper.Stopped() {
+		_ = conn.Close()
+		return fmt.Errorf("exchanger has been stopped")
+	}
+	cbw.conn = conn
 	return nil
 }
 
-// Reader is invoked by Serve method
+// Closes connection if it's established
+func (cbw *CoinbaseWS) closeConn() {
+	cbw.writeMu.Lock()
+	defer cbw.writeMu.Unlock()
+	if cbw.conn != nil {
+		_ = cbw.conn.Close()
+	}
+}
+
+// Redials and resubscribes according to reconnect.Policy
+// Returns false if stop has been requested or policy doesn't allow more attempts
+func (cbw *CoinbaseWS) reconnect(reason error) bool {
+	return reconnect.Loop{
+		Policy:    cbw.policy,
+		Dial:      cbw.Dial,
+		Subscribe: cbw.subscribe,
+		Close:     cbw.closeConn,
+		Emit:      cbw.emit,
+	}.Run(cbw.stopper.Done(), reason)
+}
+
+// Reader is invoked by ServeContext method
 // Reader starts read message out of connection and sends it to dedicated chan (e.g. tick)
-// Returns on done
-// On connection closed invoke method Stop()
-// Closes dedicated chan on return
-func (cbw *CoinbaseWS) reader() {
-	for {
-		select {
-		case <-cbw.done:
-			_ = cbw.conn.Close()
-			close(cbw.tick)
-			cbw.tick = nil
-			return
-		default:
-			_, msg, err := cbw.conn.ReadMessage()
+// Returns when stopper is stopped
+// On connection lost tries to reconnect, stops with lifecycle.RemoteClose if reconnect failed
+// Stops with lifecycle.ProtocolError if Coinbase sent error message
+func (cbw *CoinbaseWS) reader(stopper *lifecycle.Stopper) {
+	for !stopper.Stopped() {
+		_, msg, err := cbw.conn.ReadMessage()
+		received := time.Now().UTC()
+		if err != nil {
+			if stopper.Stopped() {
+				return
+			}
+			if !cbw.reconnect(err) {
+				stopper.Stop(lifecycle.RemoteClose, "connection closed", err)
+			}
+			continue
+		}
+		msgType, err := parseMessageType(msg)
+		if err != nil {
+			var srvErr *serverError
+			if errors.As(err, &srvErr) {
+				stopper.Stop(lifecycle.ProtocolError, nil, err)
+			}
+			cbw.log(err)
+			continue
+		}
+		switch msgType {
+		case tickerChannelName:
+			tick, err := parseTick(msg)
 			if err != nil {
-				cbw.Stop("connection closed")
+				cbw.log(err)
 				continue
 			}
-			msgType, err := parseMessageType(msg)
+			tick.Received = received
+			if cbw.raw {
+				tick.Raw = msg
+			}
+			if cbw.tick != nil {
+				select {
+				case cbw.tick <- tick:
+				case <-stopper.Done():
+				}
+			}
+		case matchMessageType, lastMatchMessageType:
+			trade, err := parseTrade(msg)
 			if err != nil {
 				cbw.log(err)
 				continue
 			}
-			switch msgType {
-			case tickerChannelName:
-				tick, err := parseTick(msg)
-				if err != nil {
-					cbw.log(err)
-					continue
+			if cbw.trade != nil {
+				select {
+				case cbw.trade <- trade:
+				case <-stopper.Done():
 				}
-				if cbw.tick != nil {
-					cbw.tick <- tick
+			}
+		case snapshotMessageType:
+			update, err := cbw.applySnapshot(msg)
+			if err != nil {
+				cbw.log(err)
+				continue
+			}
+			if cbw.book != nil {
+				select {
+				case cbw.book <- update:
+				case <-stopper.Done():
+				}
+			}
+		case l2UpdateMessageType:
+			update, err := cbw.applyL2Update(msg)
+			if err != nil {
+				cbw.log(err)
+				continue
+			}
+			if cbw.book != nil {
+				select {
+				case cbw.book <- update:
+				case <-stopper.Done():
 				}
 			}
 		}
@@ -79,15 +210,25 @@ func (cbw *CoinbaseWS) reader() {
 // Important: connection should be established
 // Returns error on send fail
 func (cbw *CoinbaseWS) subscribe() error {
-	var pairs []string
-	for _, pair := range cbw.pairs {
-		pairs = append(pairs, pair.String(PairDelimiter))
+	return cbw.send("subscribe", cbw.pairs.Get())
+}
+
+// Sends subscribe or unsubscribe message of pairs for all channels
+func (cbw *CoinbaseWS) send(msgType string, pairs []crypto.Pair) error {
+	var productIds []string
+	for _, pair := range pairs {
+		productIds = append(productIds, pair.String(PairDelimiter))
 	}
 	s := coinbaseSubscribe{
-		Type:       "subscribe",
-		ProductIds: pairs,
+		Type:       msgType,
+		ProductIds: productIds,
 		Channels:   cbw.channels,
 	}
+	cbw.writeMu.Lock()
+	defer cbw.writeMu.Unlock()
+	if cbw.conn == nil {
+		return fmt.Errorf("connection isn't established")
+	}
 	err := cbw.conn.WriteJSON(s)
 	if err != nil {
 		cbw.log(fmt.Errorf("WriteJSON failed: %s. message: %v", err.Error(), s))
@@ -95,38 +236,70 @@ func (cbw *CoinbaseWS) subscribe() error {
 	return err
 }
 
-// Sends value to done chan. Logs reason of stop
-func (cbw *CoinbaseWS) Stop(reason interface{}) {
-	cbw.done <- true
-	if reason != nil {
-		cbw.log(reason)
+// Replaces pairs without dropping connection
+// Sends unsubscribe for removed pairs and subscribe for added ones if connection is established
+func (cbw *CoinbaseWS) UpdatePairs(pairs ...crypto.Pair) error {
+	prev := cbw.pairs.Get()
+	if err := cbw.SetPairs(pairs...); err != nil {
+		return err
 	}
+	cbw.writeMu.Lock()
+	connected := cbw.conn != nil
+	cbw.writeMu.Unlock()
+	if !connected {
+		return nil
+	}
+	added, removed := crypto.DiffPairs(prev, pairs)
+	if len(removed) > 0 {
+		if err := cbw.send("unsubscribe", removed); err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		return cbw.send("subscribe", added)
+	}
+	return nil
 }
 
-// Serve invokes subscribe method and starts reader. And waits for done chan to finish
-// Returns error if setup isn't valid
+// Serve invokes subscribe method and starts reader. And waits for stop to finish
+// Returns error if setup isn't valid or Exchanger has been stopped not by Stop()
 func (cbw *CoinbaseWS) Serve() error {
+	err := cbw.ServeContext(context.Background())
+	if lifecycle.ReasonOf(err) == lifecycle.UserStop {
+		return nil
+	}
+	return err
+}
+
+// ServeContext invokes subscribe method and starts reader. And waits for stop or ctx to finish
+// Closes connection and dedicated chans on return
+// Returns error if setup isn't valid, otherwise *lifecycle.StopError describing why Exchanger has stopped
+func (cbw *CoinbaseWS) ServeContext(ctx context.Context) error {
 	err := cbw.isValidSetup()
 	if err != nil {
 		cbw.log(err)
+		cbw.closeChannels()
 		return err
 	}
 
 	err = cbw.subscribe()
 	if err != nil {
+		cbw.closeChannels()
 		return err
 	}
 
-	cbw.done = make(chan bool, 1)
-	go cbw.reader()
+	stopper := &cbw.stopper
+	go stopper.Watch(ctx)
+	finished := make(chan struct{})
+	go func() {
+		cbw.reader(stopper)
+		close(finished)
+	}()
 
-	for {
-		select {
-		case _, ok := <-cbw.done:
-			if ok {
-				close(cbw.done)
-			}
-			return nil
-		}
-	}
+	<-stopper.Done()
+	// unblocks reader waiting for message
+	cbw.closeConn()
+	<-finished
+	cbw.closeChannels()
+	return stopper.Err()
 }
@@ -3,9 +3,21 @@ package coinbase
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestNewWS(t *testing.T) {
@@ -19,29 +31,283 @@ func TestCoinbaseWS_Dial(t *testing.T) {
 }
 
 func TestCoinbaseWS_Stop(t *testing.T) {
-	t.Run("Stop() sends true to done chan", func(t *testing.T) {
-		cbw := CoinbaseWS{
-			done: make(chan bool, 1),
-		}
+	t.Run("Stop() is idempotent and doesn't block before Serve", func(t *testing.T) {
+		cbw := CoinbaseWS{}
 		cbw.Stop(nil)
-		actual := <-cbw.done
-		close(cbw.done)
-		assert.Equal(t, true, actual)
+		cbw.Stop("second")
+		assert.True(t, cbw.stopper.Stopped())
+		assert.Equal(t, lifecycle.UserStop, cbw.stopper.Err().Reason)
 	})
 
-	t.Run("Stop() param will be logged", func(t *testing.T) {
+	t.Run("Stop() param of the first call will be logged", func(t *testing.T) {
 		b := bytes.Buffer{}
 		w := bufio.NewWriter(&b)
 		cbw := CoinbaseWS{
 			Coinbase: Coinbase{
 				logger: log.New(w, "", 0),
 			},
-			done: make(chan bool, 1),
 		}
 		expected := "user stopped"
 		cbw.Stop(expected)
+		cbw.Stop("stopped again")
 		w.Flush()
-		close(cbw.done)
 		assert.Equal(t, expected+"\n", b.String())
 	})
 }
+
+// Starts local websocket server which invokes handler on each new connection
+func newWSServer(t *testing.T, handler func(conn *websocket.Conn, n int)) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	var n int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		handler(conn, int(atomic.AddInt32(&n, 1)))
+	}))
+}
+
+func TestCoinbaseWS_SetReconnectPolicy(t *testing.T) {
+	cbw := NewWS()
+	assert.Equal(t, reconnect.DefaultPolicy, cbw.policy)
+	assert.Error(t, cbw.SetReconnectPolicy(reconnect.Policy{Jitter: 2}))
+	assert.Error(t, cbw.SetReconnectPolicy(reconnect.Policy{}))
+	assert.NoError(t, cbw.SetReconnectPolicy(reconnect.Policy{MaxAttempts: reconnect.Disabled}))
+	assert.Equal(t, reconnect.Disabled, cbw.policy.MaxAttempts)
+}
+
+func TestCoinbaseWS_reconnect(t *testing.T) {
+	t.Run("redials, resubscribes and keeps tick chan open", func(t *testing.T) {
+		subscribed := make(chan coinbaseSubscribe, 2)
+		server := newWSServer(t, func(conn *websocket.Conn, n int) {
+			s := coinbaseSubscribe{}
+			if err := conn.ReadJSON(&s); err != nil {
+				return
+			}
+			subscribed <- s
+			msg := fmt.Sprintf(`{"type":"ticker","time":"1970-01-01T00:00:0%dZ","product_id":"BTC-USD","best_bid":"1","best_ask":"2"}`, n)
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(msg))
+			if n == 1 {
+				_ = conn.Close()
+			}
+		})
+		defer server.Close()
+
+		btc_usd, _ := crypto.NewPair("btc", "usd")
+		cbw := NewWS()
+		cbw.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		assert.NoError(t, cbw.SetReconnectPolicy(reconnect.Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}))
+		assert.NoError(t, cbw.SetPairs(btc_usd))
+		cbw.SetRawPayload(true)
+		events := cbw.Events()
+		ticks := cbw.Ticker()
+		assert.NoError(t, cbw.Dial())
+		go cbw.Serve()
+
+		for i := 1; i <= 2; i++ {
+			select {
+			case tick, ok := <-ticks:
+				assert.True(t, ok)
+				assert.Equal(t, time.Unix(int64(i), 0).UTC(), tick.T)
+				assert.False(t, tick.Received.IsZero())
+				assert.Equal(t, "coinbase", tick.ExchangeId)
+				assert.Contains(t, string(tick.Raw), `"type":"ticker"`)
+			case <-time.After(5 * time.Second):
+				t.Fatal("tick hasn't been received")
+			}
+			s := <-subscribed
+			assert.Equal(t, []string{"BTC-USD"}, s.ProductIds)
+			assert.Equal(t, []string{tickerChannelName}, s.Channels)
+		}
+
+		var types []reconnect.EventType
+		for len(events) > 0 {
+			types = append(types, (<-events).Type)
+		}
+		assert.Equal(t, []reconnect.EventType{reconnect.Disconnected, reconnect.Reconnecting, reconnect.Reconnected}, types)
+	})
+
+	t.Run("gives up when policy is exhausted", func(t *testing.T) {
+		server := newWSServer(t, func(conn *websocket.Conn, n int) {
+			_ = conn.Close()
+		})
+		url := "ws" + strings.TrimPrefix(server.URL, "http")
+		cbw := NewWS()
+		cbw.SetURL(url)
+		assert.NoError(t, cbw.SetReconnectPolicy(reconnect.Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxAttempts: 2}))
+		assert.NoError(t, cbw.Dial())
+		server.Close()
+
+		events := cbw.Events()
+		assert.False(t, cbw.reconnect(fmt.Errorf("eof")))
+		var types []reconnect.EventType
+		for len(events) > 0 {
+			types = append(types, (<-events).Type)
+		}
+		assert.Equal(t, []reconnect.EventType{reconnect.Disconnected, reconnect.Reconnecting, reconnect.Reconnecting, reconnect.GaveUp}, types)
+	})
+}
+
+func TestCoinbaseWS_UpdatePairs(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	eth_usd, _ := crypto.NewPair("eth", "usd")
+	eth_btc, _ := crypto.NewPair("eth", "btc")
+
+	t.Run("replaces pairs if connection isn't established", func(t *testing.T) {
+		cbw := NewWS()
+		assert.NoError(t, cbw.UpdatePairs(btc_usd))
+		assert.Equal(t, []crypto.Pair{btc_usd}, cbw.pairs.Get())
+		assert.Error(t, cbw.UpdatePairs())
+	})
+
+	t.Run("unsubscribes removed pairs and subscribes added ones", func(t *testing.T) {
+		received := make(chan coinbaseSubscribe, 3)
+		server := newWSServer(t, func(conn *websocket.Conn, n int) {
+			for {
+				s := coinbaseSubscribe{}
+				if err := conn.ReadJSON(&s); err != nil {
+					return
+				}
+				received <- s
+			}
+		})
+		defer server.Close()
+
+		cbw := NewWS()
+		cbw.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		cbw.Ticker()
+		assert.NoError(t, cbw.SetPairs(btc_usd, eth_usd))
+		assert.NoError(t, cbw.Dial())
+		assert.NoError(t, cbw.subscribe())
+		assert.NoError(t, cbw.UpdatePairs(eth_usd, eth_btc))
+
+		expected := []coinbaseSubscribe{
+			{Type: "subscribe", ProductIds: []string{"BTC-USD", "ETH-USD"}, Channels: []string{tickerChannelName}},
+			{Type: "unsubscribe", ProductIds: []string{"BTC-USD"}, Channels: []string{tickerChannelName}},
+			{Type: "subscribe", ProductIds: []string{"ETH-BTC"}, Channels: []string{tickerChannelName}},
+		}
+		for _, e := range expected {
+			select {
+			case s := <-received:
+				assert.Equal(t, e, s)
+			case <-time.After(5 * time.Second):
+				t.Fatal("message hasn't been received")
+			}
+		}
+		assert.Equal(t, []crypto.Pair{eth_usd, eth_btc}, cbw.pairs.Get())
+	})
+}
+
+func TestCoinbaseWS_ServeContext(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	tickMsg := `{"type":"ticker","time":"1970-01-01T00:00:01Z","product_id":"BTC-USD","best_bid":"1","best_ask":"2"}`
+
+	// Dials to server and serves it in goroutine, returns chan of Serve result
+	serve := func(t *testing.T, ctx context.Context, server *httptest.Server, policy reconnect.Policy) (*CoinbaseWS, <-chan crypto.Tick, <-chan error) {
+		cbw := NewWS()
+		cbw.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		assert.NoError(t, cbw.SetReconnectPolicy(policy))
+		assert.NoError(t, cbw.SetPairs(btc_usd))
+		ticks := cbw.Ticker()
+		assert.NoError(t, cbw.DialContext(ctx))
+		served := make(chan error, 1)
+		go func() {
+			served <- cbw.ServeContext(ctx)
+		}()
+		return cbw, ticks, served
+	}
+
+	// Waits for Serve result and checks tick chan is closed
+	wait := func(t *testing.T, ticks <-chan crypto.Tick, served <-chan error) error {
+		select {
+		case err := <-served:
+			for range ticks {
+			}
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("Serve hasn't returned")
+			return nil
+		}
+	}
+
+	// Keeps connection open and sends tick until client goes away
+	streaming := func(conn *websocket.Conn, n int) {
+		_ = conn.ReadJSON(&coinbaseSubscribe{})
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(tickMsg))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+
+	t.Run("cancelled context stops Serve", func(t *testing.T) {
+		server := newWSServer(t, streaming)
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cbw, ticks, served := serve(t, ctx, server, reconnect.DefaultPolicy)
+		<-ticks
+		cancel()
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.ContextDone, lifecycle.ReasonOf(err))
+		assert.True(t, errors.Is(err, context.Canceled))
+		// Stop after context cancel doesn't block
+		cbw.Stop("late stop")
+	})
+
+	t.Run("Stop returns user stop error, Serve returns nil", func(t *testing.T) {
+		server := newWSServer(t, streaming)
+		defer server.Close()
+
+		cbw, ticks, served := serve(t, context.Background(), server, reconnect.DefaultPolicy)
+		<-ticks
+		cbw.Stop("user stopped")
+		cbw.Stop("user stopped again")
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.UserStop, lifecycle.ReasonOf(err))
+
+		// Stop before Serve makes Serve return at once
+		cbw = NewWS()
+		cbw.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		assert.NoError(t, cbw.SetPairs(btc_usd))
+		cbw.Ticker()
+		assert.NoError(t, cbw.Dial())
+		cbw.Stop(nil)
+		assert.NoError(t, cbw.Serve())
+		assert.Error(t, cbw.Dial())
+	})
+
+	t.Run("remote close without reconnect", func(t *testing.T) {
+		server := newWSServer(t, func(conn *websocket.Conn, n int) {
+			_ = conn.ReadJSON(&coinbaseSubscribe{})
+			_ = conn.Close()
+		})
+		defer server.Close()
+
+		_, ticks, served := serve(t, context.Background(), server, reconnect.Policy{MaxAttempts: reconnect.Disabled})
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.RemoteClose, lifecycle.ReasonOf(err))
+	})
+
+	t.Run("error message from server", func(t *testing.T) {
+		server := newWSServer(t, func(conn *websocket.Conn, n int) {
+			_ = conn.ReadJSON(&coinbaseSubscribe{})
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","message":"Failed to subscribe","reason":"BTC-USD is delisted"}`))
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		})
+		defer server.Close()
+
+		_, ticks, served := serve(t, context.Background(), server, reconnect.DefaultPolicy)
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.ProtocolError, lifecycle.ReasonOf(err))
+		var srvErr *serverError
+		assert.True(t, errors.As(err, &srvErr))
+	})
+}
@@ -0,0 +1,132 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"time"
+)
+
+// Level2 channel name according to Coinbase API
+const level2ChannelName = "level2"
+
+// Message types of level2 channel according to Coinbase API
+const (
+	snapshotMessageType = "snapshot"
+	l2UpdateMessageType = "l2update"
+)
+
+// Coinbase snapshot message format. Levels are [price, size]
+type snapshotMessage struct {
+	ProductId string      `json:"product_id"`
+	Bids      [][2]string `json:"bids"`
+	Asks      [][2]string `json:"asks"`
+}
+
+// Coinbase l2update message format. Changes are [side, price, size]
+type l2UpdateMessage struct {
+	ProductId string      `json:"product_id"`
+	Time      time.Time   `json:"time"`
+	Changes   [][3]string `json:"changes"`
+}
+
+// Returns crypto.Level slice out of Coinbase's [price, size] levels
+func parseLevels(raw [][2]string) ([]crypto.Level, error) {
+	levels := make([]crypto.Level, 0, len(raw))
+	for _, r := range raw {
+		price, err := crypto.NewDecimal(r[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert level's price to decimal: %s", r[0])
+		}
+		size, err := crypto.NewDecimal(r[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert level's size to decimal: %s", r[1])
+		}
+		levels = append(levels, crypto.Level{Price: price, Size: size})
+	}
+	return levels, nil
+}
+
+// Returns crypto.Side out of Coinbase's buy/sell side
+func parseSide(side string) (crypto.Side, error) {
+	switch side {
+	case "buy":
+		return crypto.Bid, nil
+	case "sell":
+		return crypto.Ask, nil
+	default:
+		return 0, fmt.Errorf("unknown side: %s", side)
+	}
+}
+
+// Returns crypto.BookChange slice out of Coinbase's [side, price, size] changes
+func parseChanges(raw [][3]string) ([]crypto.BookChange, error) {
+	changes := make([]crypto.BookChange, 0, len(raw))
+	for _, r := range raw {
+		side, err := parseSide(r[0])
+		if err != nil {
+			return nil, err
+		}
+		levels, err := parseLevels([][2]string{{r[1], r[2]}})
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, crypto.BookChange{Side: side, Price: levels[0].Price, Size: levels[0].Size})
+	}
+	return changes, nil
+}
+
+// Resets order book of pair by snapshot message and returns crypto.BookUpdate
+// Creates order book if pair hasn't been seen before
+func (cb *Coinbase) applySnapshot(msg []byte) (update crypto.BookUpdate, err error) {
+	s := snapshotMessage{}
+	if err = json.Unmarshal(msg, &s); err != nil {
+		return update, fmt.Errorf("wrong message format, unable to unmarshall: %s", string(msg))
+	}
+	update.P, err = parseProductId(s.ProductId)
+	if err != nil {
+		return update, err
+	}
+	bids, err := parseLevels(s.Bids)
+	if err != nil {
+		return update, err
+	}
+	asks, err := parseLevels(s.Asks)
+	if err != nil {
+		return update, err
+	}
+	if cb.books == nil {
+		cb.books = map[string]*crypto.OrderBook{}
+	}
+	book, ok := cb.books[s.ProductId]
+	if !ok {
+		book = crypto.NewOrderBook(update.P)
+		cb.books[s.ProductId] = book
+	}
+	update.T = time.Now().UTC()
+	update.Snapshot = true
+	update.Book = book
+	book.Reset(update.T, bids, asks)
+	return update, nil
+}
+
+// Applies l2update message to order book of pair and returns crypto.BookUpdate
+// Returns error if snapshot of pair hasn't been received yet
+func (cb *Coinbase) applyL2Update(msg []byte) (update crypto.BookUpdate, err error) {
+	u := l2UpdateMessage{}
+	if err = json.Unmarshal(msg, &u); err != nil {
+		return update, fmt.Errorf("wrong message format, unable to unmarshall: %s", string(msg))
+	}
+	book, ok := cb.books[u.ProductId]
+	if !ok {
+		return update, fmt.Errorf("l2update received before snapshot: %s", u.ProductId)
+	}
+	update.Changes, err = parseChanges(u.Changes)
+	if err != nil {
+		return update, err
+	}
+	update.T = u.Time
+	update.P, _ = book.Pair()
+	update.Book = book
+	return update, book.Apply(u.Time, update.Changes...)
+}
@@ -0,0 +1,130 @@
+package coinbase
+
+import (
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_parseLevels(t *testing.T) {
+	cases := []struct {
+		raw      [][2]string
+		expected []crypto.Level
+		hasError bool
+	}{
+		{[][2]string{{"10.5", "1"}, {"10", "0.25"}}, []crypto.Level{{Price: crypto.MustDecimal("10.5"), Size: crypto.MustDecimal("1")}, {Price: crypto.MustDecimal("10"), Size: crypto.MustDecimal("0.25")}}, false},
+		{[][2]string{}, []crypto.Level{}, false},
+		{[][2]string{{"ABC", "1"}}, nil, true},
+		{[][2]string{{"1", ""}}, nil, true},
+	}
+	for _, testCase := range cases {
+		levels, err := parseLevels(testCase.raw)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, levels)
+	}
+}
+
+func Test_parseChanges(t *testing.T) {
+	cases := []struct {
+		raw      [][3]string
+		expected []crypto.BookChange
+		hasError bool
+	}{
+		{[][3]string{{"buy", "10", "1"}, {"sell", "11", "0"}}, []crypto.BookChange{{Side: crypto.Bid, Price: crypto.MustDecimal("10"), Size: crypto.MustDecimal("1")}, {Side: crypto.Ask, Price: crypto.MustDecimal("11"), Size: crypto.MustDecimal("0")}}, false},
+		{[][3]string{{"hold", "10", "1"}}, nil, true},
+		{[][3]string{{"buy", "X", "1"}}, nil, true},
+	}
+	for _, testCase := range cases {
+		changes, err := parseChanges(testCase.raw)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, changes)
+	}
+}
+
+func TestCoinbase_applySnapshot(t *testing.T) {
+	cases := []struct {
+		msg      []byte
+		hasError bool
+	}{
+		{[]byte(`{"type":"snapshot","product_id":"BTC-USD","bids":[["10","1"],["11","2"]],"asks":[["12","3"]]}`), false},
+		{[]byte(`{"type":"snapshot","product_id":"BTCUSD","bids":[],"asks":[]}`), true},
+		{[]byte(`{"type":"snapshot","product_id":"BTC-USD","bids":[["X","1"]],"asks":[]}`), true},
+		{[]byte(`{"type":"snapshot","product_id":"BTC-USD","bids":[],"asks":[["1","X"]]}`), true},
+		{[]byte(`{"type":"snapshot","product_id":"BTC-USD","bids":"wrong"}`), true},
+	}
+	for _, testCase := range cases {
+		c := Coinbase{}
+		update, err := c.applySnapshot(testCase.msg)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.True(t, update.Snapshot)
+		assert.Equal(t, "BTC-USD", update.P.String())
+		assert.Equal(t, c.books["BTC-USD"], update.Book)
+		assert.Equal(t, []crypto.Level{{Price: crypto.MustDecimal("11"), Size: crypto.MustDecimal("2")}, {Price: crypto.MustDecimal("10"), Size: crypto.MustDecimal("1")}}, update.Book.Top(crypto.Bid, 0))
+		assert.Equal(t, []crypto.Level{{Price: crypto.MustDecimal("12"), Size: crypto.MustDecimal("3")}}, update.Book.Top(crypto.Ask, 0))
+	}
+}
+
+func TestCoinbase_applyL2Update(t *testing.T) {
+	t.Run("l2update before snapshot", func(t *testing.T) {
+		c := Coinbase{}
+		_, err := c.applyL2Update([]byte(`{"type":"l2update","product_id":"BTC-USD","changes":[["buy","10","1"]]}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("l2update changes order book", func(t *testing.T) {
+		cases := []struct {
+			msg      []byte
+			bids     []crypto.Level
+			asks     []crypto.Level
+			hasError bool
+		}{
+			{
+				msg:  []byte(`{"type":"l2update","product_id":"BTC-USD","time":"1970-01-01T00:00:01Z","changes":[["buy","10","0"],["sell","12.5","1"]]}`),
+				bids: []crypto.Level{{Price: crypto.MustDecimal("11"), Size: crypto.MustDecimal("2")}},
+				asks: []crypto.Level{{Price: crypto.MustDecimal("12"), Size: crypto.MustDecimal("3")}, {Price: crypto.MustDecimal("12.5"), Size: crypto.MustDecimal("1")}},
+			},
+			{
+				msg:      []byte(`{"type":"l2update","product_id":"BTC-USD","changes":[["buy","10","-1"]]}`),
+				hasError: true,
+			},
+			{
+				msg:      []byte(`{"type":"l2update","product_id":"BTC-USD","changes":[["buy","10"]]}`),
+				hasError: true,
+			},
+			{
+				msg:      []byte(`{"type":"l2update","product_id":"BTC-USD","changes":"wrong"}`),
+				hasError: true,
+			},
+		}
+		for _, testCase := range cases {
+			c := Coinbase{}
+			_, err := c.applySnapshot([]byte(`{"type":"snapshot","product_id":"BTC-USD","bids":[["10","1"],["11","2"]],"asks":[["12","3"]]}`))
+			assert.NoError(t, err)
+			update, err := c.applyL2Update(testCase.msg)
+			if testCase.hasError {
+				assert.Error(t, err)
+				continue
+			}
+			assert.NoError(t, err)
+			assert.False(t, update.Snapshot)
+			assert.Equal(t, time.Unix(1, 0).UTC(), update.T)
+			assert.Equal(t, "BTC-USD", update.P.String())
+			assert.Len(t, update.Changes, 2)
+			assert.Equal(t, testCase.bids, update.Book.Top(crypto.Bid, 0))
+			assert.Equal(t, testCase.asks, update.Book.Top(crypto.Ask, 0))
+		}
+	})
+}
@@ -4,8 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -15,22 +13,29 @@ type Tick struct {
 	ProductId string    `json:"product_id"`
 	Bid       string    `json:"best_bid"`
 	Ask       string    `json:"best_ask"`
+	Sequence  int64     `json:"sequence"`
+	TradeId   int64     `json:"trade_id"`
+	Price     string    `json:"price"`
+	LastSize  string    `json:"last_size"`
+	Volume24h string    `json:"volume_24h"`
+	BidSize   string    `json:"best_bid_size"`
+	AskSize   string    `json:"best_ask_size"`
 }
 
-// Returns BestBid in float64 from Coinbase's Tick format
-func (t Tick) BestBid() (bb float64, err error) {
-	bb, err = strconv.ParseFloat(t.Bid, 64)
+// Returns BestBid in crypto.Decimal from Coinbase's Tick format
+func (t Tick) BestBid() (bb crypto.Decimal, err error) {
+	bb, err = crypto.NewDecimal(t.Bid)
 	if err != nil {
-		return 0, fmt.Errorf("failed to convert tick's best_bid to float64: %s", t.Ask)
+		return bb, fmt.Errorf("failed to convert tick's best_bid to decimal: %s", t.Bid)
 	}
 	return
 }
 
-// Returns BestAsk in float64 from Coinbase's Tick format
-func (t Tick) BestAsk() (ba float64, err error) {
-	ba, err = strconv.ParseFloat(t.Ask, 64)
+// Returns BestAsk in crypto.Decimal from Coinbase's Tick format
+func (t Tick) BestAsk() (ba crypto.Decimal, err error) {
+	ba, err = crypto.NewDecimal(t.Ask)
 	if err != nil {
-		return 0, fmt.Errorf("failed to convert tick's best_ask to float64: %s", t.Ask)
+		return ba, fmt.Errorf("failed to convert tick's best_ask to decimal: %s", t.Ask)
 	}
 	return
 }
@@ -42,15 +47,43 @@ func (t Tick) Timestamp() time.Time {
 
 // Returns pairs in crypto.Pair from Coinbase's Tick format
 func (t Tick) Pair() (pair crypto.Pair, err error) {
-	currencies := strings.Split(t.ProductId, string(PairDelimiter))
-	if len(currencies) != 2 {
-		return pair, fmt.Errorf("failed to split currencies by delimiter: %c", PairDelimiter)
+	return parseProductId(t.ProductId)
+}
+
+// Returns crypto.Pair out of Coinbase's product id
+func parseProductId(productId string) (pair crypto.Pair, err error) {
+	return crypto.ParsePair(productId, PairDelimiter)
+}
+
+// Returns crypto.Tick with metadata of Coinbase's Tick format, missing fields are kept zero
+// Error occurs on wrap failure or if some of decimal fields is malformed
+func (t Tick) wrap() (tick crypto.Tick, err error) {
+	if tick, err = crypto.WrapTicker(t); err != nil {
+		return tick, err
 	}
-	pair, err = crypto.NewPair(currencies[0], currencies[1])
-	if err != nil {
-		return
+	tick.ExchangeId = exchangeName
+	tick.Sequence = t.Sequence
+	tick.TradeId = t.TradeId
+	decimals := []struct {
+		name  string
+		value string
+		dst   *crypto.Decimal
+	}{
+		{"price", t.Price, &tick.Price},
+		{"last_size", t.LastSize, &tick.Size},
+		{"volume_24h", t.Volume24h, &tick.Volume24h},
+		{"best_bid_size", t.BidSize, &tick.BidSize},
+		{"best_ask_size", t.AskSize, &tick.AskSize},
 	}
-	return
+	for _, d := range decimals {
+		if d.value == "" {
+			continue
+		}
+		if *d.dst, err = crypto.NewDecimal(d.value); err != nil {
+			return tick, fmt.Errorf("failed to convert tick's %s to decimal: %s", d.name, d.value)
+		}
+	}
+	return tick, nil
 }
 
 // Returns crypto.Tick out of msg. Error occurs on unmarshall or wrap failure
@@ -60,5 +93,5 @@ func parseTick(msg []byte) (tick crypto.Tick, err error) {
 	if err != nil {
 		return tick, fmt.Errorf("wrong message format, unable to unmarshall: %s", string(msg))
 	}
-	return crypto.WrapTicker(t)
+	return t.wrap()
 }
@@ -18,12 +18,13 @@ func TestTick_Timestamp(t *testing.T) {
 func TestTick_BestBid(t *testing.T) {
 	cases := []struct {
 		bid      string
-		expected float64
+		expected string
 		hasError bool
 	}{
-		{"123.2", 123.2, false},
-		{"ABC", 0, true},
-		{"", 0, true},
+		{"123.2", "123.2", false},
+		{"0.00001234", "0.00001234", false},
+		{"ABC", "", true},
+		{"", "", true},
 	}
 	for _, testCase := range cases {
 		tick := Tick{Bid: testCase.bid}
@@ -33,19 +34,20 @@ func TestTick_BestBid(t *testing.T) {
 			continue
 		}
 		assert.NoError(t, err)
-		assert.Equal(t, testCase.expected, actual)
+		assert.Equal(t, testCase.expected, actual.String())
 	}
 }
 
 func TestTick_BestAsk(t *testing.T) {
 	cases := []struct {
 		ask      string
-		expected float64
+		expected string
 		hasError bool
 	}{
-		{"123.2", 123.2, false},
-		{"ABC", 0, true},
-		{"", 0, true},
+		{"123.2", "123.2", false},
+		{"0.00001234", "0.00001234", false},
+		{"ABC", "", true},
+		{"", "", true},
 	}
 	for _, testCase := range cases {
 		tick := Tick{Ask: testCase.ask}
@@ -55,7 +57,7 @@ func TestTick_BestAsk(t *testing.T) {
 			continue
 		}
 		assert.NoError(t, err)
-		assert.Equal(t, testCase.expected, actual)
+		assert.Equal(t, testCase.expected, actual.String())
 	}
 }
 
@@ -122,11 +124,36 @@ func Test_parseTick(t *testing.T) {
 			expectedTick: crypto.Tick{
 				T:   time.Unix(0, 0),
 				P:   btc_usd,
-				Bid: 2,
-				Ask: 1,
+				Bid: crypto.MustDecimal("2"),
+				Ask: crypto.MustDecimal("1"),
 			},
 			hasError: false,
 		},
+		{
+			msg: []byte(`{"type":"ticker","sequence":5928281084,"product_id":"BTC-USD","price":"1.5","open_24h":"1","volume_24h":"1000.5",` +
+				`"best_bid":"1.4","best_bid_size":"0.25","best_ask":"1.6","best_ask_size":"0.5","side":"buy",` +
+				`"time":"1970-01-01T00:00:00.123456Z","trade_id":129966578,"last_size":"0.01"}`),
+			expectedTick: crypto.Tick{
+				T:          time.Unix(0, 123456000),
+				P:          btc_usd,
+				Bid:        crypto.MustDecimal("1.4"),
+				Ask:        crypto.MustDecimal("1.6"),
+				ExchangeId: "coinbase",
+				Sequence:   5928281084,
+				TradeId:    129966578,
+				Price:      crypto.MustDecimal("1.5"),
+				Size:       crypto.MustDecimal("0.01"),
+				Volume24h:  crypto.MustDecimal("1000.5"),
+				BidSize:    crypto.MustDecimal("0.25"),
+				AskSize:    crypto.MustDecimal("0.5"),
+			},
+			hasError: false,
+		},
+		{
+			msg:          []byte(`{"time":"1970-01-01T00:00:00Z", "best_bid":"2", "best_ask":"1", "product_id":"BTC-USD", "last_size":"ABC"}`),
+			expectedTick: crypto.Tick{},
+			hasError:     true,
+		},
 		{
 			msg:          []byte("{\"time\":\"1970-01-01T00:00:00Z\", \"best_bid\":2, \"best_ask\":1, \"product_id\":\"BTC-USD\"}"),
 			expectedTick: crypto.Tick{},
@@ -146,6 +173,13 @@ func Test_parseTick(t *testing.T) {
 		assert.Equal(t, testCase.expectedTick.P, tick.P)
 		assert.Equal(t, testCase.expectedTick.Bid, tick.Bid)
 		assert.Equal(t, testCase.expectedTick.Ask, tick.Ask)
-
+		assert.Equal(t, "coinbase", tick.ExchangeId)
+		assert.Equal(t, testCase.expectedTick.Sequence, tick.Sequence)
+		assert.Equal(t, testCase.expectedTick.TradeId, tick.TradeId)
+		assert.Equal(t, testCase.expectedTick.Price, tick.Price)
+		assert.Equal(t, testCase.expectedTick.Size, tick.Size)
+		assert.Equal(t, testCase.expectedTick.Volume24h, tick.Volume24h)
+		assert.Equal(t, testCase.expectedTick.BidSize, tick.BidSize)
+		assert.Equal(t, testCase.expectedTick.AskSize, tick.AskSize)
 	}
 }
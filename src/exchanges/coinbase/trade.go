@@ -0,0 +1,62 @@
+package coinbase
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"strconv"
+	"time"
+)
+
+// Matches channel name according to Coinbase API
+const matchesChannelName = "matches"
+
+// Message types of matches channel according to Coinbase API
+// last_match is sent once right after subscribe
+const (
+	matchMessageType     = "match"
+	lastMatchMessageType = "last_match"
+)
+
+// Coinbase match message format
+type matchMessage struct {
+	TradeId      int64     `json:"trade_id"`
+	MakerOrderId string    `json:"maker_order_id"`
+	TakerOrderId string    `json:"taker_order_id"`
+	Time         time.Time `json:"time"`
+	ProductId    string    `json:"product_id"`
+	Size         string    `json:"size"`
+	Price        string    `json:"price"`
+	Side         string    `json:"side"`
+}
+
+// Returns crypto.Trade out of msg. Error occurs on unmarshall or conversion failure
+func parseTrade(msg []byte) (trade crypto.Trade, err error) {
+	m := matchMessage{}
+	err = json.Unmarshal(msg, &m)
+	if err != nil {
+		return trade, fmt.Errorf("wrong message format, unable to unmarshall: %s", string(msg))
+	}
+	trade.P, err = parseProductId(m.ProductId)
+	if err != nil {
+		return trade, err
+	}
+	trade.Price, err = crypto.NewDecimal(m.Price)
+	if err != nil {
+		return trade, fmt.Errorf("failed to convert trade's price to decimal: %s", m.Price)
+	}
+	trade.Size, err = crypto.NewDecimal(m.Size)
+	if err != nil {
+		return trade, fmt.Errorf("failed to convert trade's size to decimal: %s", m.Size)
+	}
+	trade.Side, err = parseSide(m.Side)
+	if err != nil {
+		return trade, err
+	}
+	trade.T = m.Time
+	trade.Id = strconv.FormatInt(m.TradeId, 10)
+	trade.MakerOrderId = m.MakerOrderId
+	trade.TakerOrderId = m.TakerOrderId
+	trade.ExchangeId = exchangeName
+	return trade, nil
+}
@@ -0,0 +1,63 @@
+package coinbase
+
+import (
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_parseTrade(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("BTC", "USD")
+
+	cases := []struct {
+		msg           []byte
+		expectedTrade crypto.Trade
+		hasError      bool
+	}{
+		{
+			msg: []byte(`{"type":"match","trade_id":10,"maker_order_id":"ac928c66","taker_order_id":"132fb6ae","time":"1970-01-01T00:00:01Z","product_id":"BTC-USD","size":"5.23512","price":"400.23","side":"sell"}`),
+			expectedTrade: crypto.Trade{
+				T:            time.Unix(1, 0).UTC(),
+				P:            btc_usd,
+				Id:           "10",
+				Price:        crypto.MustDecimal("400.23"),
+				Size:         crypto.MustDecimal("5.23512"),
+				Side:         crypto.Ask,
+				MakerOrderId: "ac928c66",
+				TakerOrderId: "132fb6ae",
+				ExchangeId:   "coinbase",
+			},
+			hasError: false,
+		},
+		{
+			msg:      []byte(`{"type":"match","product_id":"BTCUSD","size":"1","price":"1","side":"buy"}`),
+			hasError: true,
+		},
+		{
+			msg:      []byte(`{"type":"match","product_id":"BTC-USD","size":"1","price":"X","side":"buy"}`),
+			hasError: true,
+		},
+		{
+			msg:      []byte(`{"type":"match","product_id":"BTC-USD","size":"X","price":"1","side":"buy"}`),
+			hasError: true,
+		},
+		{
+			msg:      []byte(`{"type":"match","product_id":"BTC-USD","size":"1","price":"1","side":"none"}`),
+			hasError: true,
+		},
+		{
+			msg:      []byte(`{"type":"match","trade_id":"10"}`),
+			hasError: true,
+		},
+	}
+	for _, testCase := range cases {
+		trade, err := parseTrade(testCase.msg)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expectedTrade, trade)
+	}
+}
@@ -1,16 +1,39 @@
 package exchanges
 
 import (
+	"context"
 	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
 	"io"
 )
 
 // Exchanger represents communication between different Exchanges
+// Stop is idempotent and may be invoked before Serve
+// ServeContext returns *lifecycle.StopError describing why Exchanger has stopped, Serve returns nil on Stop
 type Exchanger interface {
 	Dial() error
+	DialContext(ctx context.Context) error
 	Serve() error
+	ServeContext(ctx context.Context) error
 	Stop(reason interface{})
 	SetLogger(writer io.Writer)
 	SetPairs(...crypto.Pair) error
 	Ticker() <-chan crypto.Tick
 }
+
+// OrderBooker is implemented by Exchangers which are able to maintain order books
+// Check it by type assertion on Exchanger
+type OrderBooker interface {
+	OrderBook() <-chan crypto.BookUpdate
+}
+
+// Trader is implemented by Exchangers which are able to stream executed trades
+// Check it by type assertion on Exchanger
+type Trader interface {
+	Trades() <-chan crypto.Trade
+}
+
+// PairUpdater is implemented by Exchangers which are able to replace pairs without dropping connection
+// Check it by type assertion on Exchanger
+type PairUpdater interface {
+	UpdatePairs(pairs ...crypto.Pair) error
+}
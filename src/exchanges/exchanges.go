@@ -2,7 +2,9 @@ package exchanges
 
 import (
 	"fmt"
-	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/coinbase"
+	"sort"
+	"strings"
+	"sync"
 )
 
 // Protocol represents which transport protocol will be used for data fetching
@@ -10,24 +12,166 @@ type Protocol int
 
 const (
 	WebSocket Protocol = iota + 1
+	REST
 )
 
-type Exchange int
+// Names of protocols, used by CLI and configs
+var protocolNames = map[Protocol]string{
+	WebSocket: "ws",
+	REST:      "rest",
+}
+
+// Returns name of Protocol
+func (p Protocol) String() string {
+	if name, ok := protocolNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(p))
+}
+
+// Returns Protocol by name, case insensitive
+func ParseProtocol(name string) (Protocol, error) {
+	for p, n := range protocolNames {
+		if strings.EqualFold(n, name) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("protocol not found: %s", name)
+}
+
+// Channel is a kind of market data which Exchanger is able to stream
+type Channel string
 
 const (
-	Coinbase Exchange = iota + 1
+	TickerChannel  Channel = "ticker"
+	TradesChannel  Channel = "trades"
+	Level2Channel  Channel = "level2"
+	CandlesChannel Channel = "candles"
 )
 
-func New(exchange Exchange, protocol Protocol) (Exchanger, error) {
-	switch exchange {
-	case Coinbase:
-		switch protocol {
-		case WebSocket:
-			return coinbase.NewWS(), nil
-		default:
-			return nil, fmt.Errorf("coinbase protocol not implemented yet: %d", protocol)
+// Factory creates new Exchanger of registered exchange and protocol
+type Factory func() Exchanger
+
+// Support describes channels of exchange available by protocol
+type Support struct {
+	Protocol Protocol
+	Channels []Channel
+}
+
+// Info describes registered exchange, protocols are sorted
+type Info struct {
+	Name      string
+	Protocols []Support
+}
+
+// Returns true if exchange is registered for protocol
+func (i Info) Supports(protocol Protocol) bool {
+	for _, s := range i.Protocols {
+		if s.Protocol == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if exchange streams channel by protocol
+func (i Info) SupportsChannel(protocol Protocol, channel Channel) bool {
+	for _, s := range i.Protocols {
+		if s.Protocol != protocol {
+			continue
+		}
+		for _, c := range s.Channels {
+			if c == channel {
+				return true
+			}
 		}
-	default:
-		return nil, fmt.Errorf("exchange not found")
 	}
+	return false
+}
+
+// registration of exchange for one protocol
+type registration struct {
+	factory  Factory
+	channels []Channel
+}
+
+var (
+	registryMu sync.RWMutex
+	// registrations by lower case exchange name and protocol
+	registry = make(map[string]map[Protocol]registration)
+)
+
+// Register makes Exchanger of exchange available by name and protocol, channels are reported by List
+// Adapters invoke it in init, so package of adapter should be imported for side effects
+// Panics if factory is nil or exchange has been registered for protocol twice
+func Register(name string, protocol Protocol, factory Factory, channels ...Channel) {
+	if factory == nil {
+		panic("exchanges: Register factory is nil for " + name)
+	}
+	key := strings.ToLower(name)
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[key][protocol]; dup {
+		panic(fmt.Sprintf("exchanges: Register called twice for %s %s", key, protocol))
+	}
+	if registry[key] == nil {
+		registry[key] = make(map[Protocol]registration)
+	}
+	registry[key][protocol] = registration{factory: factory, channels: append([]Channel(nil), channels...)}
+}
+
+// Returns Info of exchange by name, case insensitive
+// Returns error if exchange isn't registered
+func Lookup(name string) (Info, error) {
+	key := strings.ToLower(name)
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	protocols, ok := registry[key]
+	if !ok {
+		return Info{}, fmt.Errorf("exchange not found: %s", name)
+	}
+	return info(key, protocols), nil
+}
+
+// Returns Info of every registered exchange sorted by name
+func List() []Info {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	list := make([]Info, 0, len(registry))
+	for name, protocols := range registry {
+		list = append(list, info(name, protocols))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Builds Info of registrations, must be invoked under registryMu
+func info(name string, protocols map[Protocol]registration) Info {
+	i := Info{Name: name}
+	for p, r := range protocols {
+		i.Protocols = append(i.Protocols, Support{Protocol: p, Channels: append([]Channel(nil), r.channels...)})
+	}
+	sort.Slice(i.Protocols, func(a, b int) bool {
+		return i.Protocols[a].Protocol < i.Protocols[b].Protocol
+	})
+	return i
+}
+
+// Creates new Exchanger of exchange by name, case insensitive
+// Returns error if exchange isn't registered for protocol
+func New(name string, protocol Protocol) (Exchanger, error) {
+	key := strings.ToLower(name)
+	registryMu.RLock()
+	protocols, ok := registry[key]
+	r, supported := protocols[protocol]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("exchange not found: %s", name)
+	}
+	if !supported {
+		return nil, fmt.Errorf("%s protocol not implemented yet: %s", key, protocol)
+	}
+	return r.factory(), nil
 }
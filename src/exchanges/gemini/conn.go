@@ -0,0 +1,228 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/gorilla/websocket"
+	"sync"
+	"time"
+)
+
+// Health describes state of connection of one pair
+type Health struct {
+	Pair        crypto.Pair
+	Connected   bool
+	LastMessage time.Time
+	Reconnects  int
+	// GaveUp is true if connection is lost and reconnect policy doesn't allow more attempts
+	GaveUp bool
+	// last error of connection, nil if connection has never failed
+	Err error
+}
+
+// symbolConn is a connection of one pair, its order book is reconstructed out of change events
+type symbolConn struct {
+	pair crypto.Pair
+	url  string
+	book *crypto.OrderBook
+
+	// sequence of the next message, gap means missed changes
+	seq int64
+	// last sent top of book
+	bid, ask crypto.Decimal
+
+	mu     sync.Mutex
+	conn   *websocket.Conn
+	health Health
+
+	// closed when pair is removed
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// Creates connection of pair, url is a base URL of market data
+func newSymbolConn(pair crypto.Pair, url string) *symbolConn {
+	return &symbolConn{
+		pair:   pair,
+		url:    url + "/" + symbol(pair),
+		book:   crypto.NewOrderBook(pair),
+		health: Health{Pair: pair},
+		done:   make(chan struct{}),
+	}
+}
+
+// Returns copy of connection health
+func (sc *symbolConn) Health() Health {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.health
+}
+
+// Dials connection, book is rebuilt by the next initial update
+func (sc *symbolConn) dial(ctx context.Context) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, sc.url, nil)
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if err != nil {
+		sc.health.Err = err
+		return fmt.Errorf("%s: %s", sc.pair.String(), err)
+	}
+	if sc.isClosed() {
+		_ = conn.Close()
+		return fmt.Errorf("%s: connection has been closed", sc.pair.String())
+	}
+	sc.conn = conn
+	sc.seq = 0
+	sc.health.Connected = true
+	sc.health.GaveUp = false
+	return nil
+}
+
+// Returns current connection, nil if it isn't established
+func (sc *symbolConn) current() *websocket.Conn {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.conn
+}
+
+// Drops current connection and marks it as failed with err
+func (sc *symbolConn) drop(err error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.conn != nil {
+		_ = sc.conn.Close()
+		sc.conn = nil
+	}
+	sc.health.Connected = false
+	if err != nil {
+		sc.health.Err = err
+	}
+}
+
+// Closes connection for good, e.g. pair is removed or Exchanger is stopped
+func (sc *symbolConn) close() {
+	sc.doneOnce.Do(func() {
+		close(sc.done)
+	})
+	sc.drop(nil)
+}
+
+// Returns true if connection has been closed for good
+func (sc *symbolConn) isClosed() bool {
+	select {
+	case <-sc.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Redials according to reconnect.Policy
+// Returns false if connection has been closed for good or policy doesn't allow more attempts
+func (sc *symbolConn) reconnect(g *GeminiWS, reason error) bool {
+	ok := reconnect.Loop{
+		Policy: g.policy,
+		Dial: func() error {
+			return sc.dial(context.Background())
+		},
+		Emit: func(event reconnect.Event) {
+			g.emit(sc.pair, event)
+		},
+	}.Run(sc.done, reason)
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if ok {
+		sc.health.Reconnects++
+	} else if !sc.isClosed() {
+		sc.health.GaveUp = true
+	}
+	return ok
+}
+
+// Applies message to order book, returns tick and true if top of book has changed
+// Returns error if message is out of sequence, connection should be dropped then
+func (sc *symbolConn) apply(m geminiMessage, now time.Time) (tick crypto.Tick, changed bool, err error) {
+	if m.SocketSequence != sc.seq {
+		return tick, false, fmt.Errorf("%s: message out of sequence: %d, expected %d", sc.pair.String(), m.SocketSequence, sc.seq)
+	}
+	sc.seq++
+	if m.Type != updateMessageType {
+		return tick, false, nil
+	}
+	changes, err := bookChanges(m.Events)
+	if err != nil {
+		return tick, false, fmt.Errorf("%s: %s", sc.pair.String(), err)
+	}
+	t := m.time(now)
+	if m.SocketSequence == 0 {
+		// initial update contains whole book
+		sc.book.Reset(t, nil, nil)
+	}
+	if err = sc.book.Apply(t, changes...); err != nil {
+		return tick, false, fmt.Errorf("%s: %s", sc.pair.String(), err)
+	}
+	bid, errBid := sc.book.BestBid()
+	ask, errAsk := sc.book.BestAsk()
+	if errBid != nil || errAsk != nil {
+		return tick, false, nil
+	}
+	if bid.Equal(sc.bid) && ask.Equal(sc.ask) {
+		return tick, false, nil
+	}
+	sc.bid, sc.ask = bid, ask
+	return crypto.Tick{T: t, P: sc.pair, Bid: bid, Ask: ask, ExchangeId: exchangeName}, true, nil
+}
+
+// Reads connection until it's closed for good, sends ticks to g.tick
+// Reconnects on connection lost or sequence gap
+// Returns error if reconnect policy doesn't allow more attempts, nil if closed or stopped
+func (sc *symbolConn) run(g *GeminiWS, stopper *lifecycle.Stopper) error {
+	lastErr := sc.Health().Err
+	for !stopper.Stopped() && !sc.isClosed() {
+		conn := sc.current()
+		if conn == nil {
+			if !sc.reconnect(g, lastErr) {
+				if stopper.Stopped() || sc.isClosed() {
+					return nil
+				}
+				return lastErr
+			}
+			continue
+		}
+		_, msg, err := conn.ReadMessage()
+		now := time.Now().UTC()
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %s", sc.pair.String(), err)
+			sc.drop(lastErr)
+			continue
+		}
+		sc.mu.Lock()
+		sc.health.LastMessage = now
+		sc.mu.Unlock()
+		m, err := parseMessage(msg)
+		if err != nil {
+			g.log(fmt.Errorf("%s: %s", sc.pair.String(), err))
+			continue
+		}
+		tick, changed, err := sc.apply(m, now)
+		if err != nil {
+			lastErr = err
+			g.log(err)
+			sc.drop(err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		tick.Received = now
+		select {
+		case g.tick <- tick:
+		case <-stopper.Done():
+		case <-sc.done:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package gemini
+
+import (
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_newSymbolConn(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	sc := newSymbolConn(btc_usd, "ws://localhost")
+	assert.Equal(t, "ws://localhost/BTCUSD", sc.url)
+	assert.Equal(t, Health{Pair: btc_usd}, sc.Health())
+	assert.False(t, sc.isClosed())
+	sc.close()
+	sc.close()
+	assert.True(t, sc.isClosed())
+}
+
+func Test_symbolConn_apply(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	sc := newSymbolConn(btc_usd, "ws://localhost")
+
+	m, _ := parseMessage([]byte(initialFixture))
+	tick, changed, err := sc.apply(m, now)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, crypto.Tick{T: now, P: btc_usd, Bid: crypto.MustDecimal("3641.61"), Ask: crypto.MustDecimal("3641.62"), ExchangeId: "gemini"}, tick)
+
+	// size of best ask changed only
+	m, _ = parseMessage([]byte(changeFixture))
+	_, changed, err = sc.apply(m, now)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// heartbeat keeps sequence
+	_, changed, err = sc.apply(geminiMessage{Type: heartbeatMessageType, SocketSequence: 2}, now)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	m = geminiMessage{Type: updateMessageType, SocketSequence: 3, Events: []geminiEvent{
+		{Type: changeEventType, Side: "ask", Price: "3641.62", Remaining: "0"},
+		{Type: changeEventType, Side: "ask", Price: "3642", Remaining: "1"},
+	}}
+	tick, changed, err = sc.apply(m, now)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "3642", tick.Ask.String())
+
+	t.Run("gap in sequence", func(t *testing.T) {
+		_, _, err = sc.apply(geminiMessage{Type: heartbeatMessageType, SocketSequence: 5}, now)
+		assert.Error(t, err)
+	})
+
+	t.Run("initial update resets book", func(t *testing.T) {
+		sc.seq = 0
+		m, _ := parseMessage([]byte(initialFixture))
+		tick, changed, err := sc.apply(m, now)
+		assert.NoError(t, err)
+		assert.True(t, changed)
+		assert.Equal(t, "3641.62", tick.Ask.String())
+	})
+}
@@ -0,0 +1,319 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"io"
+	"log"
+	"sync"
+)
+
+// Name of exchange, ticks are marked by it
+const exchangeName = "gemini"
+
+// Default base URL of Gemini v1 market data API, symbol is appended to it
+const GeminiWS_URL = "wss://api.gemini.com/v1/marketdata"
+
+// GeminiWS is used for WebSocket Protocol. Gemini streams one symbol per connection,
+// so GeminiWS keeps a pool of connections and merges their ticks into one chan
+// Connection failure of one pair doesn't affect the others
+type GeminiWS struct {
+	tick chan crypto.Tick
+
+	pairs exchanges.Pairs
+
+	url string
+
+	// connection per pair, serving is true while ServeContext runs connections
+	conns   map[crypto.Pair]*symbolConn
+	serving bool
+	connsMu sync.Mutex
+	running sync.WaitGroup
+
+	// reconnect policy of every connection and chan of reconnect events for caller
+	policy reconnect.Policy
+	events reconnect.Events
+
+	// stop signal, Stop may be invoked before Serve
+	stopper lifecycle.Stopper
+
+	logger *log.Logger
+}
+
+// Registers gemini for WebSocket protocol
+func init() {
+	exchanges.Register(exchangeName, exchanges.WebSocket, func() exchanges.Exchanger {
+		return NewWS()
+	}, exchanges.TickerChannel)
+}
+
+// Creates new Gemini Exchanger for WebSocket protocol
+func NewWS() *GeminiWS {
+	g := new(GeminiWS)
+	g.url = GeminiWS_URL
+	g.policy = reconnect.DefaultPolicy
+	return g
+}
+
+// Sets base URL of market data, GeminiWS_URL is used by default
+func (g *GeminiWS) SetURL(url string) {
+	g.url = url
+}
+
+// Sets reconnect.Policy which is used when connection of a pair is lost
+// Returns error if policy isn't valid
+func (g *GeminiWS) SetReconnectPolicy(policy reconnect.Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	g.policy = policy
+	return nil
+}
+
+// Returns chan of reconnect.Event of all connections
+// Events are dropped if nobody reads the chan
+func (g *GeminiWS) Events() <-chan reconnect.Event {
+	return g.events.Chan()
+}
+
+// Sends event to events chan without blocking and logs it with pair
+func (g *GeminiWS) emit(pair crypto.Pair, event reconnect.Event) {
+	event = g.events.Emit(event)
+	g.log(fmt.Sprintf("%s: %s", pair.String(), event))
+}
+
+// Simple log function
+func (g *GeminiWS) log(v interface{}) {
+	if g.logger != nil {
+		g.logger.Println(v)
+	}
+}
+
+// Sets logger as io.Writer interface
+func (g *GeminiWS) SetLogger(w io.Writer) {
+	g.logger = log.New(w, "", log.Ldate|log.Ltime)
+}
+
+// Sets slice of crypto.Pair, connection is dialed for every pair later on
+func (g *GeminiWS) SetPairs(pairs ...crypto.Pair) error {
+	return g.pairs.Set(pairs...)
+}
+
+// Returns chan of crypto.Tick
+func (g *GeminiWS) Ticker() <-chan crypto.Tick {
+	if g.tick == nil {
+		g.tick = make(chan crypto.Tick, 1)
+	}
+	return g.tick
+}
+
+// Closes tick chan if it has been requested
+func (g *GeminiWS) closeChannels() {
+	if g.tick != nil {
+		close(g.tick)
+		g.tick = nil
+	}
+}
+
+// Returns Health of every connection in order of pairs
+func (g *GeminiWS) Health() []Health {
+	g.connsMu.Lock()
+	defer g.connsMu.Unlock()
+	health := make([]Health, 0, len(g.conns))
+	for _, pair := range g.pairs.Get() {
+		if sc, ok := g.conns[pair]; ok {
+			health = append(health, sc.Health())
+		}
+	}
+	return health
+}
+
+// Stops Exchanger, Serve returns lifecycle.StopError with UserStop reason
+// Safe to invoke several times and before Serve. Logs reason of the first stop
+func (g *GeminiWS) Stop(reason interface{}) {
+	if g.stopper.Stop(lifecycle.UserStop, reason, nil) && reason != nil {
+		g.log(reason)
+	}
+}
+
+// Dials connection of every pair
+// Returns error if all dials failed
+func (g *GeminiWS) Dial() error {
+	return g.DialContext(context.Background())
+}
+
+// Dials connection of every pair, ctx limits time of handshakes
+// Failed pairs are redialed by Serve according to reconnect.Policy
+// Returns error if all dials failed or Exchanger has been stopped
+func (g *GeminiWS) DialContext(ctx context.Context) error {
+	if g.url == "" {
+		g.url = GeminiWS_URL
+	}
+	if g.stopper.Stopped() {
+		return fmt.Errorf("exchanger has been stopped")
+	}
+	g.connsMu.Lock()
+	if g.conns == nil {
+		g.conns = make(map[crypto.Pair]*symbolConn)
+	}
+	var conns []*symbolConn
+	for _, pair := range g.pairs.Get() {
+		sc, ok := g.conns[pair]
+		if !ok {
+			sc = newSymbolConn(pair, g.url)
+			g.conns[pair] = sc
+		}
+		conns = append(conns, sc)
+	}
+	g.connsMu.Unlock()
+
+	var lastErr error
+	dialed := 0
+	for _, sc := range conns {
+		if err := sc.dial(ctx); err != nil {
+			g.log(err)
+			lastErr = err
+			continue
+		}
+		dialed++
+	}
+	if dialed == 0 && lastErr != nil {
+		return lastErr
+	}
+	return nil
+}
+
+// Starts reading of connection, must be invoked under connsMu while serving
+// Stops Exchanger with lifecycle.RemoteClose once every connection gave up
+func (g *GeminiWS) start(sc *symbolConn, stopper *lifecycle.Stopper) {
+	g.running.Add(1)
+	go func() {
+		defer g.running.Done()
+		if err := sc.run(g, stopper); err != nil && g.allGaveUp() {
+			stopper.Stop(lifecycle.RemoteClose, "all connections closed", err)
+		}
+	}()
+}
+
+// Returns true if reconnect policy doesn't allow more attempts for any connection
+func (g *GeminiWS) allGaveUp() bool {
+	g.connsMu.Lock()
+	defer g.connsMu.Unlock()
+	for _, sc := range g.conns {
+		if !sc.Health().GaveUp {
+			return false
+		}
+	}
+	return true
+}
+
+// Replaces pairs without dropping connections of remaining pairs
+// Closes connections of removed pairs and dials added ones if Exchanger has been dialed
+func (g *GeminiWS) UpdatePairs(pairs ...crypto.Pair) error {
+	prev := g.pairs.Get()
+	if err := g.SetPairs(pairs...); err != nil {
+		return err
+	}
+	g.connsMu.Lock()
+	dialed := g.conns != nil
+	g.connsMu.Unlock()
+	if !dialed {
+		return nil
+	}
+	added, removed := crypto.DiffPairs(prev, pairs)
+	var conns []*symbolConn
+	for _, pair := range added {
+		sc := newSymbolConn(pair, g.url)
+		// failed connection is redialed by reader according to reconnect.Policy
+		if err := sc.dial(context.Background()); err != nil {
+			g.log(err)
+		}
+		conns = append(conns, sc)
+	}
+
+	stopper := &g.stopper
+	g.connsMu.Lock()
+	defer g.connsMu.Unlock()
+	for _, pair := range removed {
+		if sc, ok := g.conns[pair]; ok {
+			sc.close()
+			delete(g.conns, pair)
+		}
+	}
+	for _, sc := range conns {
+		if _, ok := g.conns[sc.pair]; ok {
+			sc.close()
+			continue
+		}
+		g.conns[sc.pair] = sc
+		if g.serving {
+			g.start(sc, stopper)
+		}
+	}
+	return nil
+}
+
+// Returns error if some of required fields hasn't been initialized
+func (g *GeminiWS) isValidSetup() error {
+	if len(g.pairs.Get()) == 0 {
+		return fmt.Errorf("pairs aren't set")
+	}
+	if g.tick == nil {
+		return fmt.Errorf("channels aren't set")
+	}
+	g.connsMu.Lock()
+	defer g.connsMu.Unlock()
+	if g.conns == nil {
+		return fmt.Errorf("connections aren't dialed")
+	}
+	return nil
+}
+
+// Serve starts reading of every connection. And waits for stop to finish
+// Returns error if setup isn't valid or Exchanger has been stopped not by Stop()
+func (g *GeminiWS) Serve() error {
+	err := g.ServeContext(context.Background())
+	if lifecycle.ReasonOf(err) == lifecycle.UserStop {
+		return nil
+	}
+	return err
+}
+
+// ServeContext starts reading of every connection. And waits for stop or ctx to finish
+// Connection which lost is redialed on its own, Exchanger stops with lifecycle.RemoteClose
+// only when every connection gave up
+// Closes connections and tick chan on return
+// Returns error if setup isn't valid, otherwise *lifecycle.StopError describing why Exchanger has stopped
+func (g *GeminiWS) ServeContext(ctx context.Context) error {
+	err := g.isValidSetup()
+	if err != nil {
+		g.log(err)
+		g.closeChannels()
+		return err
+	}
+
+	stopper := &g.stopper
+	go stopper.Watch(ctx)
+	g.connsMu.Lock()
+	g.serving = true
+	for _, sc := range g.conns {
+		g.start(sc, stopper)
+	}
+	g.connsMu.Unlock()
+
+	<-stopper.Done()
+	// unblocks readers waiting for message
+	g.connsMu.Lock()
+	g.serving = false
+	for _, sc := range g.conns {
+		sc.close()
+	}
+	g.connsMu.Unlock()
+	g.running.Wait()
+	g.closeChannels()
+	return stopper.Err()
+}
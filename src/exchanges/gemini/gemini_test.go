@@ -0,0 +1,313 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Starts local websocket server which invokes handler on each new connection with symbol of path
+// n counts connections of symbol. Symbols of rejected are answered with 400 Bad Request
+func newWSServer(t *testing.T, handler func(conn *websocket.Conn, symbol string, n int), rejected ...string) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := strings.TrimPrefix(r.URL.Path, "/")
+		for _, rej := range rejected {
+			if s == rej {
+				http.Error(w, "unknown symbol", http.StatusBadRequest)
+				return
+			}
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		counts[s]++
+		n := counts[s]
+		mu.Unlock()
+		handler(conn, s, n)
+	}))
+}
+
+// Sends initial update with bid and ask, then messages with %d replaced by socket sequence starting from 1
+// Waits until client goes away
+func streaming(bid, ask string, messages ...string) func(conn *websocket.Conn, symbol string, n int) {
+	return func(conn *websocket.Conn, symbol string, n int) {
+		initial := fmt.Sprintf(`{"type":"update","eventId":1,"socket_sequence":0,"events":[`+
+			`{"type":"change","reason":"initial","price":"%s","remaining":"1","side":"bid"},`+
+			`{"type":"change","reason":"initial","price":"%s","remaining":"1","side":"ask"}]}`, bid, ask)
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(initial))
+		for i, msg := range messages {
+			if strings.Contains(msg, "%d") {
+				msg = fmt.Sprintf(msg, i+1)
+			}
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Creates GeminiWS connected to local server and serves it in goroutine
+func serve(t *testing.T, ctx context.Context, server *httptest.Server, pairs ...crypto.Pair) (*GeminiWS, <-chan crypto.Tick, <-chan error) {
+	g := NewWS()
+	g.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.NoError(t, g.SetPairs(pairs...))
+	assert.NoError(t, g.SetReconnectPolicy(reconnect.Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxAttempts: 3}))
+	ticks := g.Ticker()
+	assert.NoError(t, g.DialContext(ctx))
+	served := make(chan error, 1)
+	go func() {
+		served <- g.ServeContext(ctx)
+	}()
+	return g, ticks, served
+}
+
+// Waits for Serve result and checks tick chan is closed
+func wait(t *testing.T, ticks <-chan crypto.Tick, served <-chan error) error {
+	select {
+	case err := <-served:
+		for range ticks {
+		}
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve hasn't returned")
+		return nil
+	}
+}
+
+// Waits for tick and returns it
+func nextTick(t *testing.T, ticks <-chan crypto.Tick) crypto.Tick {
+	select {
+	case tick, ok := <-ticks:
+		assert.True(t, ok)
+		return tick
+	case <-time.After(5 * time.Second):
+		t.Fatal("tick hasn't been received")
+		return crypto.Tick{}
+	}
+}
+
+func TestNewWS(t *testing.T) {
+	g := NewWS()
+	assert.Equal(t, GeminiWS_URL, g.url)
+	assert.Equal(t, reconnect.DefaultPolicy, g.policy)
+
+	assert.Error(t, g.SetReconnectPolicy(reconnect.Policy{Jitter: 2}))
+	assert.Error(t, g.SetPairs())
+	assert.Empty(t, g.Health())
+}
+
+func TestGeminiWS_ServeContext(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	eth_usd, _ := crypto.NewPair("eth", "usd")
+
+	t.Run("closes tick chan if connections aren't dialed", func(t *testing.T) {
+		g := NewWS()
+		assert.NoError(t, g.SetPairs(btc_usd))
+		ticks := g.Ticker()
+		assert.Error(t, g.ServeContext(context.Background()))
+		_, ok := <-ticks
+		assert.False(t, ok)
+	})
+
+	t.Run("merges ticks of pairs until context cancel", func(t *testing.T) {
+		server := newWSServer(t, func(conn *websocket.Conn, symbol string, n int) {
+			if symbol == "BTCUSD" {
+				streaming("100", "101",
+					`{"type":"heartbeat","socket_sequence":%d}`,
+					`{"type":"update","socket_sequence":%d,"timestampms":1547760288001,"events":[{"type":"change","side":"bid","price":"100.5","remaining":"2"}]}`,
+				)(conn, symbol, n)
+				return
+			}
+			streaming("10", "11")(conn, symbol, n)
+		})
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		g, ticks, served := serve(t, ctx, server, btc_usd, eth_usd)
+		received := make(map[crypto.Pair][]crypto.Tick)
+		for i := 0; i < 3; i++ {
+			tick := nextTick(t, ticks)
+			received[tick.P] = append(received[tick.P], tick)
+		}
+		assert.Len(t, received[eth_usd], 1)
+		assert.Equal(t, "10", received[eth_usd][0].Bid.String())
+		assert.Len(t, received[btc_usd], 2)
+		assert.Equal(t, "100.5", received[btc_usd][1].Bid.String())
+		assert.Equal(t, "101", received[btc_usd][1].Ask.String())
+		assert.Equal(t, time.Date(2019, 1, 17, 21, 24, 48, int(time.Millisecond), time.UTC), received[btc_usd][1].T)
+
+		for _, h := range g.Health() {
+			assert.True(t, h.Connected)
+			assert.False(t, h.LastMessage.IsZero())
+			assert.NoError(t, h.Err)
+		}
+
+		cancel()
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.ContextDone, lifecycle.ReasonOf(err))
+		for _, h := range g.Health() {
+			assert.False(t, h.Connected)
+		}
+		g.Stop("late stop")
+	})
+
+	t.Run("sequence gap reconnects pair", func(t *testing.T) {
+		server := newWSServer(t, func(conn *websocket.Conn, symbol string, n int) {
+			if n == 1 {
+				streaming("100", "101", `{"type":"heartbeat","socket_sequence":5}`)(conn, symbol, n)
+				return
+			}
+			streaming("200", "201")(conn, symbol, n)
+		})
+		defer server.Close()
+
+		g, ticks, served := serve(t, context.Background(), server, btc_usd)
+		assert.Equal(t, "100", nextTick(t, ticks).Bid.String())
+		assert.Equal(t, "200", nextTick(t, ticks).Bid.String())
+		h := g.Health()
+		assert.Equal(t, 1, h[0].Reconnects)
+		assert.Error(t, h[0].Err)
+
+		g.Stop(nil)
+		g.Stop(nil)
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.UserStop, lifecycle.ReasonOf(err))
+	})
+
+	t.Run("bad symbol doesn't take down the others", func(t *testing.T) {
+		server := newWSServer(t, streaming("10", "11", `{"type":"update","socket_sequence":%d,"events":[{"type":"change","side":"ask","price":"10.5","remaining":"1"}]}`), "BTCUSD")
+		defer server.Close()
+
+		g, ticks, served := serve(t, context.Background(), server, btc_usd, eth_usd)
+		assert.Equal(t, eth_usd, nextTick(t, ticks).P)
+		assert.Equal(t, "10.5", nextTick(t, ticks).Ask.String())
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !g.Health()[0].GaveUp && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		h := g.Health()
+		assert.Equal(t, btc_usd, h[0].Pair)
+		assert.True(t, h[0].GaveUp)
+		assert.False(t, h[0].Connected)
+		assert.Error(t, h[0].Err)
+		assert.Equal(t, eth_usd, h[1].Pair)
+		assert.True(t, h[1].Connected)
+		assert.False(t, h[1].GaveUp)
+
+		g.Stop(nil)
+		assert.Equal(t, lifecycle.UserStop, lifecycle.ReasonOf(wait(t, ticks, served)))
+	})
+
+	t.Run("stops with remote close when every pair gave up", func(t *testing.T) {
+		// first connection is closed after initial update, the next ones are rejected
+		upgrader := websocket.Upgrader{}
+		var n int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&n, 1) > 1 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(initialFixture))
+			_ = conn.Close()
+		}))
+		defer server.Close()
+
+		g, ticks, served := serve(t, context.Background(), server, btc_usd)
+		assert.Equal(t, btc_usd, nextTick(t, ticks).P)
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.RemoteClose, lifecycle.ReasonOf(err))
+		assert.True(t, g.Health()[0].GaveUp)
+	})
+
+	t.Run("Dial fails if every pair failed", func(t *testing.T) {
+		server := newWSServer(t, streaming("1", "2"), "BTCUSD", "ETHUSD")
+		defer server.Close()
+
+		g := NewWS()
+		g.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		assert.NoError(t, g.SetPairs(btc_usd, eth_usd))
+		assert.Error(t, g.Dial())
+		assert.Len(t, g.Health(), 2)
+		g.Stop(nil)
+		assert.Error(t, g.Dial())
+	})
+
+	t.Run("Serve returns error on invalid setup", func(t *testing.T) {
+		g := NewWS()
+		assert.Error(t, g.Serve())
+		assert.NoError(t, g.SetPairs(btc_usd))
+		assert.Error(t, g.Serve())
+		g.Ticker()
+		assert.Error(t, g.Serve())
+	})
+}
+
+func TestGeminiWS_UpdatePairs(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	eth_usd, _ := crypto.NewPair("eth", "usd")
+
+	g := NewWS()
+	assert.NoError(t, g.UpdatePairs(btc_usd))
+	assert.Error(t, g.UpdatePairs())
+	assert.Empty(t, g.Health())
+
+	server := newWSServer(t, func(conn *websocket.Conn, symbol string, n int) {
+		if symbol == "BTCUSD" {
+			streaming("100", "101")(conn, symbol, n)
+			return
+		}
+		streaming("10", "11")(conn, symbol, n)
+	})
+	defer server.Close()
+
+	g.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.NoError(t, g.SetReconnectPolicy(reconnect.Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}))
+	ticks := g.Ticker()
+	assert.NoError(t, g.Dial())
+	served := make(chan error, 1)
+	go func() {
+		served <- g.Serve()
+	}()
+	assert.Equal(t, btc_usd, nextTick(t, ticks).P)
+	before := g.conns[btc_usd]
+
+	assert.NoError(t, g.UpdatePairs(btc_usd, eth_usd))
+	assert.Equal(t, eth_usd, nextTick(t, ticks).P)
+	assert.Same(t, before, g.conns[btc_usd])
+	assert.Equal(t, 0, g.Health()[0].Reconnects)
+
+	assert.NoError(t, g.UpdatePairs(eth_usd))
+	h := g.Health()
+	assert.Len(t, h, 1)
+	assert.Equal(t, eth_usd, h[0].Pair)
+	assert.True(t, before.isClosed())
+
+	g.Stop(nil)
+	assert.NoError(t, wait(t, ticks, served))
+}
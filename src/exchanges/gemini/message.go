@@ -0,0 +1,88 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"strings"
+	"time"
+)
+
+// Message types according to Gemini v1 market data API
+const (
+	updateMessageType    = "update"
+	heartbeatMessageType = "heartbeat"
+	changeEventType      = "change"
+)
+
+// Update and heartbeat message format provided by Gemini v1 market data API
+// SocketSequence increases by one for every message of connection, starting with 0
+type geminiMessage struct {
+	Type           string        `json:"type"`
+	EventId        int64         `json:"eventId"`
+	SocketSequence int64         `json:"socket_sequence"`
+	TimestampMs    int64         `json:"timestampms"`
+	Events         []geminiEvent `json:"events"`
+}
+
+// Event of update message, only change events are used
+// Remaining is size of price level after change
+type geminiEvent struct {
+	Type      string `json:"type"`
+	Side      string `json:"side"`
+	Price     string `json:"price"`
+	Remaining string `json:"remaining"`
+	Reason    string `json:"reason"`
+}
+
+// Returns Gemini symbol of pair, e.g. BTCUSD
+func symbol(pair crypto.Pair) string {
+	return strings.ToUpper(pair.Primary() + pair.Secondary())
+}
+
+// Parses message of Gemini market data API
+func parseMessage(msg []byte) (m geminiMessage, err error) {
+	if err = json.Unmarshal(msg, &m); err != nil {
+		return m, fmt.Errorf("wrong message format, unable to decode: %s", err)
+	}
+	if m.Type == "" {
+		return m, fmt.Errorf("message type is empty")
+	}
+	return m, nil
+}
+
+// Returns time of message, receive time t if message has no timestamp, e.g. initial update
+func (m geminiMessage) time(t time.Time) time.Time {
+	if m.TimestampMs == 0 {
+		return t
+	}
+	return time.Unix(0, m.TimestampMs*int64(time.Millisecond)).UTC()
+}
+
+// Converts change events of update to crypto.BookChange, other events are skipped
+func bookChanges(events []geminiEvent) ([]crypto.BookChange, error) {
+	changes := make([]crypto.BookChange, 0, len(events))
+	for _, e := range events {
+		if e.Type != changeEventType {
+			continue
+		}
+		c := crypto.BookChange{}
+		switch e.Side {
+		case "bid":
+			c.Side = crypto.Bid
+		case "ask":
+			c.Side = crypto.Ask
+		default:
+			return nil, fmt.Errorf("unknown side: %s", e.Side)
+		}
+		var err error
+		if c.Price, err = crypto.NewDecimal(e.Price); err != nil {
+			return nil, fmt.Errorf("bad price of change: %s", err)
+		}
+		if c.Size, err = crypto.NewDecimal(e.Remaining); err != nil {
+			return nil, fmt.Errorf("bad remaining of change: %s", err)
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
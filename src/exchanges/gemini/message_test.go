@@ -0,0 +1,59 @@
+package gemini
+
+import (
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const initialFixture = `{"type":"update","eventId":5375461993,"socket_sequence":0,"events":[{"type":"change","reason":"initial","price":"3641.61","delta":"0.83372051","remaining":"0.83372051","side":"bid"},{"type":"change","reason":"initial","price":"3641.62","delta":"4.072","remaining":"4.072","side":"ask"}]}`
+
+const changeFixture = `{"type":"update","eventId":5375503736,"timestamp":1547760288,"timestampms":1547760288001,"socket_sequence":1,"events":[{"type":"trade","tid":5375503736,"price":"3641.62","amount":"0.1","makerSide":"ask"},{"type":"change","side":"ask","price":"3641.62","remaining":"3.972","delta":"-0.1","reason":"trade"}]}`
+
+func Test_symbol(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	assert.Equal(t, "BTCUSD", symbol(btc_usd))
+}
+
+func Test_parseMessage(t *testing.T) {
+	m, err := parseMessage([]byte(initialFixture))
+	assert.NoError(t, err)
+	assert.Equal(t, updateMessageType, m.Type)
+	assert.Equal(t, int64(0), m.SocketSequence)
+	assert.Len(t, m.Events, 2)
+
+	m, err = parseMessage([]byte(`{"type":"heartbeat","socket_sequence":3}`))
+	assert.NoError(t, err)
+	assert.Equal(t, heartbeatMessageType, m.Type)
+	assert.Equal(t, int64(3), m.SocketSequence)
+
+	_, err = parseMessage([]byte(`{"socket_sequence":3}`))
+	assert.Error(t, err)
+	_, err = parseMessage([]byte(`[]`))
+	assert.Error(t, err)
+}
+
+func Test_geminiMessage_time(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	m, _ := parseMessage([]byte(initialFixture))
+	assert.Equal(t, now, m.time(now))
+	m, _ = parseMessage([]byte(changeFixture))
+	assert.Equal(t, time.Date(2019, 1, 17, 21, 24, 48, int(time.Millisecond), time.UTC), m.time(now))
+}
+
+func Test_bookChanges(t *testing.T) {
+	m, _ := parseMessage([]byte(changeFixture))
+	changes, err := bookChanges(m.Events)
+	assert.NoError(t, err)
+	assert.Equal(t, []crypto.BookChange{
+		{Side: crypto.Ask, Price: crypto.MustDecimal("3641.62"), Size: crypto.MustDecimal("3.972")},
+	}, changes)
+
+	_, err = bookChanges([]geminiEvent{{Type: changeEventType, Side: "auction", Price: "1", Remaining: "1"}})
+	assert.Error(t, err)
+	_, err = bookChanges([]geminiEvent{{Type: changeEventType, Side: "bid", Price: "x", Remaining: "1"}})
+	assert.Error(t, err)
+	_, err = bookChanges([]geminiEvent{{Type: changeEventType, Side: "bid", Price: "1", Remaining: "x"}})
+	assert.Error(t, err)
+}
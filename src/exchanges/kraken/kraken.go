@@ -0,0 +1,348 @@
+package kraken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/gorilla/websocket"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// Name of exchange, ticks are marked by it
+const exchangeName = "kraken"
+
+// Default URL of Kraken public WS API
+const KrakenWS_URL = "wss://ws.kraken.com"
+
+// KrakenWS is used for WebSocket Protocol. Streams best bid and ask of pairs by ticker or spread channel
+type KrakenWS struct {
+	tick chan crypto.Tick
+
+	pairs exchanges.Pairs
+
+	// channel which ticks are built of, TickerChannel by default
+	channel string
+
+	conn *websocket.Conn
+	url  string
+
+	// connection supports one concurrent writer only, guards conn replacement too
+	writeMu sync.Mutex
+
+	// reconnect policy and chan of reconnect events for caller
+	policy reconnect.Policy
+	events reconnect.Events
+
+	// stop signal, Stop may be invoked before Serve
+	stopper lifecycle.Stopper
+
+	logger *log.Logger
+}
+
+// Registers kraken for WebSocket protocol
+func init() {
+	exchanges.Register(exchangeName, exchanges.WebSocket, func() exchanges.Exchanger {
+		return NewWS()
+	}, exchanges.TickerChannel)
+}
+
+// Creates new Kraken Exchanger for WebSocket protocol
+func NewWS() *KrakenWS {
+	k := new(KrakenWS)
+	k.url = KrakenWS_URL
+	k.channel = TickerChannel
+	k.policy = reconnect.DefaultPolicy
+	return k
+}
+
+// Sets URL of websocket server, KrakenWS_URL is used by default
+func (k *KrakenWS) SetURL(url string) {
+	k.url = url
+}
+
+// Sets channel which ticks are built of: TickerChannel or SpreadChannel
+// Spread has time of update, ticker is timed by receive time
+func (k *KrakenWS) SetChannel(channel string) error {
+	if channel != TickerChannel && channel != SpreadChannel {
+		return fmt.Errorf("channel is not supported: %s", channel)
+	}
+	k.channel = channel
+	return nil
+}
+
+// Sets reconnect.Policy which is used when connection is lost
+// Returns error if policy isn't valid
+func (k *KrakenWS) SetReconnectPolicy(policy reconnect.Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	k.policy = policy
+	return nil
+}
+
+// Returns chan of reconnect.Event
+// Events are dropped if nobody reads the chan
+func (k *KrakenWS) Events() <-chan reconnect.Event {
+	return k.events.Chan()
+}
+
+// Sends event to events chan without blocking and logs it
+func (k *KrakenWS) emit(event reconnect.Event) {
+	k.log(k.events.Emit(event))
+}
+
+// Simple log function
+func (k *KrakenWS) log(v interface{}) {
+	if k.logger != nil {
+		k.logger.Println(v)
+	}
+}
+
+// Sets logger as io.Writer interface
+func (k *KrakenWS) SetLogger(w io.Writer) {
+	k.logger = log.New(w, "", log.Ldate|log.Ltime)
+}
+
+// Sets slice of crypto.Pair, will be used for subscribe later on
+func (k *KrakenWS) SetPairs(pairs ...crypto.Pair) error {
+	return k.pairs.Set(pairs...)
+}
+
+// Returns chan of crypto.Tick
+func (k *KrakenWS) Ticker() <-chan crypto.Tick {
+	if k.tick == nil {
+		k.tick = make(chan crypto.Tick, 1)
+	}
+	return k.tick
+}
+
+// Closes tick chan if it has been requested
+func (k *KrakenWS) closeChannels() {
+	if k.tick != nil {
+		close(k.tick)
+		k.tick = nil
+	}
+}
+
+// Stops Exchanger, Serve returns lifecycle.StopError with UserStop reason
+// Safe to invoke several times and before Serve. Logs reason of the first stop
+func (k *KrakenWS) Stop(reason interface{}) {
+	if k.stopper.Stop(lifecycle.UserStop, reason, nil) && reason != nil {
+		k.log(reason)
+	}
+}
+
+// Dials to predefined URL
+// Returns error is Dial to server failed
+func (k *KrakenWS) Dial() error {
+	return k.DialContext(context.Background())
+}
+
+// Dials to predefined URL, ctx limits time of handshake
+// Returns error is Dial to server failed or Exchanger has been stopped
+func (k *KrakenWS) DialContext(ctx context.Context) error {
+	if k.url == "" {
+		k.url = KrakenWS_URL
+	}
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, k.url, nil)
+	if err != nil {
+		k.log(err)
+		return err
+	}
+	k.writeMu.Lock()
+	defer k.writeMu.Unlock()
+	// ServeContext closes connection on stop under writeMu, don't leak the one dialed after it
+	if k.stopper.Stopped() {
+		_ = conn.Close()
+		return fmt.Errorf("exchanger has been stopped")
+	}
+	k.conn = conn
+	return nil
+}
+
+// Closes connection if it's established
+func (k *KrakenWS) closeConn() {
+	k.writeMu.Lock()
+	defer k.writeMu.Unlock()
+	if k.conn != nil {
+		_ = k.conn.Close()
+	}
+}
+
+// Sends subscribe or unsubscribe event of pairs for channel
+func (k *KrakenWS) send(event string, pairs []crypto.Pair) error {
+	s := krakenSubscribe{
+		Event:        event,
+		Subscription: krakenSubscription{Name: k.channel},
+	}
+	for _, pair := range pairs {
+		s.Pair = append(s.Pair, crypto.DefaultAliases.PairString(pair, PairDelimiter))
+	}
+	k.writeMu.Lock()
+	defer k.writeMu.Unlock()
+	if k.conn == nil {
+		return fmt.Errorf("connection isn't established")
+	}
+	err := k.conn.WriteJSON(s)
+	if err != nil {
+		k.log(fmt.Errorf("WriteJSON failed: %s. message: %v", err.Error(), s))
+	}
+	return err
+}
+
+// Subscribes current pairs
+func (k *KrakenWS) subscribe() error {
+	return k.send("subscribe", k.pairs.Get())
+}
+
+// Replaces pairs without dropping connection
+// Sends unsubscribe for removed pairs and subscribe for added ones if connection is established
+func (k *KrakenWS) UpdatePairs(pairs ...crypto.Pair) error {
+	prev := k.pairs.Get()
+	if err := k.SetPairs(pairs...); err != nil {
+		return err
+	}
+	k.writeMu.Lock()
+	connected := k.conn != nil
+	k.writeMu.Unlock()
+	if !connected {
+		return nil
+	}
+	added, removed := crypto.DiffPairs(prev, pairs)
+	if len(removed) > 0 {
+		if err := k.send("unsubscribe", removed); err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		return k.send("subscribe", added)
+	}
+	return nil
+}
+
+// Redials and resubscribes according to reconnect.Policy
+// Returns false if stop has been requested or policy doesn't allow more attempts
+func (k *KrakenWS) reconnect(reason error) bool {
+	return reconnect.Loop{
+		Policy:    k.policy,
+		Dial:      k.Dial,
+		Subscribe: k.subscribe,
+		Close:     k.closeConn,
+		Emit:      k.emit,
+	}.Run(k.stopper.Done(), reason)
+}
+
+// Reader is invoked by ServeContext method
+// Reader starts read message out of connection and sends ticks to tick chan
+// Returns when stopper is stopped
+// On connection lost tries to reconnect, stops with lifecycle.RemoteClose if reconnect failed
+// Stops with lifecycle.ProtocolError if Kraken rejected subscription
+func (k *KrakenWS) reader(stopper *lifecycle.Stopper) {
+	for !stopper.Stopped() {
+		_, msg, err := k.conn.ReadMessage()
+		received := time.Now().UTC()
+		if err != nil {
+			if stopper.Stopped() {
+				return
+			}
+			if !k.reconnect(err) {
+				stopper.Stop(lifecycle.RemoteClose, "connection closed", err)
+			}
+			continue
+		}
+		event, data, err := parseMessage(msg)
+		if err != nil {
+			var evErr *eventError
+			if errors.As(err, &evErr) {
+				stopper.Stop(lifecycle.ProtocolError, nil, err)
+			}
+			k.log(err)
+			continue
+		}
+		if event != nil {
+			if event.Event == "systemStatus" && event.Status != "online" {
+				k.log("system status: " + event.Status)
+			}
+			continue
+		}
+		var tick crypto.Tick
+		switch data.Channel {
+		case TickerChannel:
+			tick, err = parseTicker(data, received)
+		case SpreadChannel:
+			tick, err = parseSpread(data)
+		default:
+			continue
+		}
+		if err != nil {
+			k.log(err)
+			continue
+		}
+		tick.Received = received
+		select {
+		case k.tick <- tick:
+		case <-stopper.Done():
+		}
+	}
+}
+
+// Returns error if some of required fields hasn't been initialized
+func (k *KrakenWS) isValidSetup() error {
+	if len(k.pairs.Get()) == 0 {
+		return fmt.Errorf("pairs aren't set")
+	}
+	if k.tick == nil {
+		return fmt.Errorf("channels aren't set")
+	}
+	return nil
+}
+
+// Serve subscribes pairs and starts reader. And waits for stop to finish
+// Returns error if setup isn't valid or Exchanger has been stopped not by Stop()
+func (k *KrakenWS) Serve() error {
+	err := k.ServeContext(context.Background())
+	if lifecycle.ReasonOf(err) == lifecycle.UserStop {
+		return nil
+	}
+	return err
+}
+
+// ServeContext subscribes pairs and starts reader. And waits for stop or ctx to finish
+// Closes connection and tick chan on return
+// Returns error if setup isn't valid, otherwise *lifecycle.StopError describing why Exchanger has stopped
+func (k *KrakenWS) ServeContext(ctx context.Context) error {
+	err := k.isValidSetup()
+	if err != nil {
+		k.log(err)
+		k.closeChannels()
+		return err
+	}
+
+	err = k.subscribe()
+	if err != nil {
+		k.closeChannels()
+		return err
+	}
+
+	stopper := &k.stopper
+	go stopper.Watch(ctx)
+	finished := make(chan struct{})
+	go func() {
+		k.reader(stopper)
+		close(finished)
+	}()
+
+	<-stopper.Done()
+	// unblocks reader waiting for message
+	k.closeConn()
+	<-finished
+	k.closeChannels()
+	return stopper.Err()
+}
@@ -0,0 +1,251 @@
+package kraken
+
+import (
+	"context"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/lifecycle"
+	"github.com/Sn0w1eo/crypto-fetcher/src/exchanges/reconnect"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Starts local websocket server which invokes handler on each new connection
+func newWSServer(t *testing.T, handler func(conn *websocket.Conn, n int)) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	var n int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		handler(conn, int(atomic.AddInt32(&n, 1)))
+	}))
+}
+
+// Reads subscription, replies with messages and keeps connection open until client goes away
+func replying(subscribed chan<- krakenSubscribe, messages ...string) func(conn *websocket.Conn, n int) {
+	return func(conn *websocket.Conn, n int) {
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"connectionID":1,"event":"systemStatus","status":"online","version":"1.0.0"}`))
+		s := krakenSubscribe{}
+		if err := conn.ReadJSON(&s); err != nil {
+			return
+		}
+		if subscribed != nil {
+			subscribed <- s
+		}
+		for _, msg := range messages {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Creates KrakenWS connected to local server and serves it in goroutine
+func serve(t *testing.T, ctx context.Context, server *httptest.Server, pairs ...crypto.Pair) (*KrakenWS, <-chan crypto.Tick, <-chan error) {
+	k := NewWS()
+	k.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.NoError(t, k.SetPairs(pairs...))
+	ticks := k.Ticker()
+	assert.NoError(t, k.DialContext(ctx))
+	served := make(chan error, 1)
+	go func() {
+		served <- k.ServeContext(ctx)
+	}()
+	return k, ticks, served
+}
+
+// Waits for Serve result and checks tick chan is closed
+func wait(t *testing.T, ticks <-chan crypto.Tick, served <-chan error) error {
+	select {
+	case err := <-served:
+		for range ticks {
+		}
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve hasn't returned")
+		return nil
+	}
+}
+
+func TestNewWS(t *testing.T) {
+	k := NewWS()
+	assert.Equal(t, KrakenWS_URL, k.url)
+	assert.Equal(t, TickerChannel, k.channel)
+	assert.Equal(t, reconnect.DefaultPolicy, k.policy)
+
+	assert.NoError(t, k.SetChannel(SpreadChannel))
+	assert.Error(t, k.SetChannel("book"))
+	assert.Equal(t, SpreadChannel, k.channel)
+	assert.Error(t, k.SetReconnectPolicy(reconnect.Policy{Jitter: 2}))
+	assert.Error(t, k.SetPairs())
+}
+
+func TestKrakenWS_ServeContext(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	doge_btc, _ := crypto.NewPair("doge", "btc")
+
+	t.Run("closes tick chan if subscribe failed", func(t *testing.T) {
+		k := NewWS()
+		assert.NoError(t, k.SetPairs(btc_usd))
+		ticks := k.Ticker()
+		assert.Error(t, k.ServeContext(context.Background()))
+		_, ok := <-ticks
+		assert.False(t, ok)
+	})
+
+	t.Run("subscribes aliased pairs and streams ticks until context cancel", func(t *testing.T) {
+		subscribed := make(chan krakenSubscribe, 1)
+		server := newWSServer(t, replying(subscribed, `{"event":"heartbeat"}`, tickerFixture))
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		k, ticks, served := serve(t, ctx, server, btc_usd, doge_btc)
+		s := <-subscribed
+		assert.Equal(t, krakenSubscribe{Event: "subscribe", Pair: []string{"XBT/USD", "XDG/XBT"}, Subscription: krakenSubscription{Name: TickerChannel}}, s)
+
+		select {
+		case tick := <-ticks:
+			assert.Equal(t, btc_usd, tick.P)
+			assert.Equal(t, "5525.10000", tick.Bid.String())
+		case <-time.After(5 * time.Second):
+			t.Fatal("tick hasn't been received")
+		}
+		cancel()
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.ContextDone, lifecycle.ReasonOf(err))
+		k.Stop("late stop")
+	})
+
+	t.Run("rejected subscription stops with protocol error", func(t *testing.T) {
+		server := newWSServer(t, replying(nil, `{"event":"subscriptionStatus","pair":"XBT/USD","status":"error","errorMessage":"Subscription depth not supported"}`))
+		defer server.Close()
+
+		_, ticks, served := serve(t, context.Background(), server, btc_usd)
+		err := wait(t, ticks, served)
+		assert.Equal(t, lifecycle.ProtocolError, lifecycle.ReasonOf(err))
+	})
+
+	t.Run("Stop stops Serve", func(t *testing.T) {
+		server := newWSServer(t, replying(nil))
+		defer server.Close()
+
+		k := NewWS()
+		k.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+		assert.Error(t, k.Serve())
+		assert.NoError(t, k.SetPairs(btc_usd))
+		assert.Error(t, k.Serve())
+		ticks := k.Ticker()
+		assert.NoError(t, k.Dial())
+		served := make(chan error, 1)
+		go func() {
+			served <- k.Serve()
+		}()
+		k.Stop("user stopped")
+		k.Stop("user stopped again")
+		assert.NoError(t, wait(t, ticks, served))
+	})
+}
+
+func TestKrakenWS_reconnect(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	subscribed := make(chan krakenSubscribe, 2)
+	server := newWSServer(t, func(conn *websocket.Conn, n int) {
+		s := krakenSubscribe{}
+		if err := conn.ReadJSON(&s); err != nil {
+			return
+		}
+		subscribed <- s
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(spreadFixture))
+		if n == 1 {
+			_ = conn.Close()
+			return
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	defer server.Close()
+
+	k := NewWS()
+	k.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.NoError(t, k.SetChannel(SpreadChannel))
+	assert.NoError(t, k.SetReconnectPolicy(reconnect.Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}))
+	assert.NoError(t, k.SetPairs(btc_usd))
+	events := k.Events()
+	ticks := k.Ticker()
+	assert.NoError(t, k.Dial())
+	served := make(chan error, 1)
+	go func() {
+		served <- k.Serve()
+	}()
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, SpreadChannel, (<-subscribed).Subscription.Name)
+		select {
+		case <-ticks:
+		case <-time.After(5 * time.Second):
+			t.Fatal("tick hasn't been received")
+		}
+	}
+	k.Stop(nil)
+	assert.NoError(t, wait(t, ticks, served))
+
+	var types []reconnect.EventType
+	for len(events) > 0 {
+		types = append(types, (<-events).Type)
+	}
+	assert.Equal(t, []reconnect.EventType{reconnect.Disconnected, reconnect.Reconnecting, reconnect.Reconnected}, types)
+}
+
+func TestKrakenWS_UpdatePairs(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	eth_usd, _ := crypto.NewPair("eth", "usd")
+
+	k := NewWS()
+	assert.NoError(t, k.UpdatePairs(btc_usd))
+	assert.Error(t, k.UpdatePairs())
+
+	received := make(chan krakenSubscribe, 3)
+	server := newWSServer(t, func(conn *websocket.Conn, n int) {
+		for {
+			s := krakenSubscribe{}
+			if err := conn.ReadJSON(&s); err != nil {
+				return
+			}
+			received <- s
+		}
+	})
+	defer server.Close()
+
+	k.SetURL("ws" + strings.TrimPrefix(server.URL, "http"))
+	assert.NoError(t, k.Dial())
+	assert.NoError(t, k.subscribe())
+	assert.NoError(t, k.UpdatePairs(eth_usd))
+
+	expected := []krakenSubscribe{
+		{Event: "subscribe", Pair: []string{"XBT/USD"}, Subscription: krakenSubscription{Name: TickerChannel}},
+		{Event: "unsubscribe", Pair: []string{"XBT/USD"}, Subscription: krakenSubscription{Name: TickerChannel}},
+		{Event: "subscribe", Pair: []string{"ETH/USD"}, Subscription: krakenSubscription{Name: TickerChannel}},
+	}
+	for _, e := range expected {
+		select {
+		case s := <-received:
+			assert.Equal(t, e, s)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message hasn't been received")
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package kraken
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delimiter of pairs according to Kraken WS API, e.g. XBT/USD
+const PairDelimiter = '/'
+
+// Channel names according to Kraken WS API
+const (
+	TickerChannel = "ticker"
+	SpreadChannel = "spread"
+)
+
+// Event message format provided by Kraken WS API, e.g. subscriptionStatus or heartbeat
+type krakenEvent struct {
+	Event        string `json:"event"`
+	Status       string `json:"status"`
+	Pair         string `json:"pair"`
+	ChannelName  string `json:"channelName"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// Subscription request format
+type krakenSubscribe struct {
+	Event        string             `json:"event"`
+	Pair         []string           `json:"pair"`
+	Subscription krakenSubscription `json:"subscription"`
+}
+
+type krakenSubscription struct {
+	Name string `json:"name"`
+}
+
+// eventError is returned by parseMessage if Kraken rejected request
+type eventError struct {
+	Event   string
+	Pair    string
+	Message string
+}
+
+func (e *eventError) Error() string {
+	if e.Pair != "" {
+		return fmt.Sprintf("%s error received: %s, pair: %s", e.Event, e.Message, e.Pair)
+	}
+	return fmt.Sprintf("%s error received: %s", e.Event, e.Message)
+}
+
+// Channel message, Kraken sends it as array: [channelID, payload, channelName, pair]
+type channelMessage struct {
+	Channel string
+	Pair    string
+	Payload json.RawMessage
+}
+
+// Parses message of Kraken WS API, either event or channelMessage is returned
+// Returns *eventError if Kraken sent error status
+func parseMessage(msg []byte) (event *krakenEvent, data *channelMessage, err error) {
+	msg = bytes.TrimSpace(msg)
+	if len(msg) == 0 {
+		return nil, nil, fmt.Errorf("message is empty")
+	}
+	if msg[0] == '{' {
+		event = &krakenEvent{}
+		if err = json.Unmarshal(msg, event); err != nil {
+			return nil, nil, fmt.Errorf("wrong event format, unable to decode: %s", err)
+		}
+		if event.Event == "" {
+			return nil, nil, fmt.Errorf("event is empty")
+		}
+		if event.Event == "error" || event.Status == "error" {
+			return event, nil, &eventError{Event: event.Event, Pair: event.Pair, Message: event.ErrorMessage}
+		}
+		return event, nil, nil
+	}
+	var fields []json.RawMessage
+	if err = json.Unmarshal(msg, &fields); err != nil {
+		return nil, nil, fmt.Errorf("wrong channel message format, unable to decode: %s", err)
+	}
+	if len(fields) < 4 {
+		return nil, nil, fmt.Errorf("channel message has %d fields, at least 4 expected", len(fields))
+	}
+	data = &channelMessage{Payload: fields[1]}
+	if err = json.Unmarshal(fields[len(fields)-2], &data.Channel); err != nil {
+		return nil, nil, fmt.Errorf("wrong channel name: %s", err)
+	}
+	if err = json.Unmarshal(fields[len(fields)-1], &data.Pair); err != nil {
+		return nil, nil, fmt.Errorf("wrong pair: %s", err)
+	}
+	return nil, data, nil
+}
+
+// Kraken ticker payload, every field is [price, whole lot volume, lot volume]
+type krakenTicker struct {
+	Ask []json.Number `json:"a"`
+	Bid []json.Number `json:"b"`
+}
+
+// Parses ticker payload and converts it to crypto.Tick
+// Kraken doesn't send time of ticker, receive time t is used
+func parseTicker(data *channelMessage, t time.Time) (tick crypto.Tick, err error) {
+	kt := krakenTicker{}
+	if err = json.Unmarshal(data.Payload, &kt); err != nil {
+		return tick, fmt.Errorf("wrong ticker format of %s, unable to decode: %s", data.Pair, err)
+	}
+	if len(kt.Bid) == 0 || len(kt.Ask) == 0 {
+		return tick, fmt.Errorf("ticker of %s has no bid or ask", data.Pair)
+	}
+	return newTick(data.Pair, t, kt.Bid[0], kt.Ask[0])
+}
+
+// Parses spread payload and converts it to crypto.Tick
+// Spread is [bid, ask, timestamp, bid volume, ask volume]
+func parseSpread(data *channelMessage) (tick crypto.Tick, err error) {
+	var spread []json.Number
+	if err = json.Unmarshal(data.Payload, &spread); err != nil {
+		return tick, fmt.Errorf("wrong spread format of %s, unable to decode: %s", data.Pair, err)
+	}
+	if len(spread) < 3 {
+		return tick, fmt.Errorf("spread of %s has %d fields, at least 3 expected", data.Pair, len(spread))
+	}
+	t, err := parseUnixTime(spread[2].String())
+	if err != nil {
+		return tick, err
+	}
+	return newTick(data.Pair, t, spread[0], spread[1])
+}
+
+// Builds crypto.Tick out of Kraken pair, e.g. XBT/USD, and prices
+func newTick(pair string, t time.Time, bid, ask json.Number) (tick crypto.Tick, err error) {
+	tick.P, err = crypto.DefaultAliases.ParsePair(pair, PairDelimiter)
+	if err != nil {
+		return tick, err
+	}
+	tick.Bid, err = crypto.NewDecimal(bid.String())
+	if err != nil {
+		return tick, fmt.Errorf("bad bid of %s: %s", pair, err)
+	}
+	tick.Ask, err = crypto.NewDecimal(ask.String())
+	if err != nil {
+		return tick, fmt.Errorf("bad ask of %s: %s", pair, err)
+	}
+	tick.T = t
+	tick.ExchangeId = exchangeName
+	return tick, nil
+}
+
+// Parses unix time with fractional seconds, e.g. 1542057299.545897
+func parseUnixTime(s string) (time.Time, error) {
+	parts := strings.SplitN(s, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad timestamp: %s", s)
+	}
+	var nsec int64
+	if len(parts) == 2 {
+		frac := parts[1]
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		frac += strings.Repeat("0", 9-len(frac))
+		if nsec, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, fmt.Errorf("bad timestamp: %s", s)
+		}
+	}
+	return time.Unix(sec, nsec).UTC(), nil
+}
@@ -0,0 +1,119 @@
+package kraken
+
+import (
+	"errors"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const (
+	tickerFixture = `[340,{"a":["5525.40000",1,"1.000"],"b":["5525.10000",1,"1.000"],"c":["5525.10000","0.00398963"],"v":["2634.11501494","3591.17907851"]},"ticker","XBT/USD"]`
+	spreadFixture = `[320,["5698.40000","5700.00000","1542057299.545897","1.01234567","0.98765432"],"spread","XDG/XBT"]`
+)
+
+func Test_parseMessage(t *testing.T) {
+	t.Run("events", func(t *testing.T) {
+		event, data, err := parseMessage([]byte(`{"event":"heartbeat"}`))
+		assert.NoError(t, err)
+		assert.Nil(t, data)
+		assert.Equal(t, "heartbeat", event.Event)
+
+		event, _, err = parseMessage([]byte(`{"event":"subscriptionStatus","channelName":"ticker","pair":"XBT/USD","status":"subscribed","subscription":{"name":"ticker"}}`))
+		assert.NoError(t, err)
+		assert.Equal(t, "subscribed", event.Status)
+
+		var evErr *eventError
+		_, _, err = parseMessage([]byte(`{"event":"subscriptionStatus","pair":"XBT/XXX","status":"error","errorMessage":"Currency pair not supported XBT/XXX"}`))
+		assert.True(t, errors.As(err, &evErr))
+		assert.Equal(t, "XBT/XXX", evErr.Pair)
+
+		_, _, err = parseMessage([]byte(`{"event":"error","errorMessage":"Malformed request"}`))
+		assert.True(t, errors.As(err, &evErr))
+
+		_, _, err = parseMessage([]byte(`{"status":"online"}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("channel messages", func(t *testing.T) {
+		event, data, err := parseMessage([]byte(tickerFixture))
+		assert.NoError(t, err)
+		assert.Nil(t, event)
+		assert.Equal(t, TickerChannel, data.Channel)
+		assert.Equal(t, "XBT/USD", data.Pair)
+
+		cases := []string{``, `[1,"ticker","XBT/USD"]`, `[1,{},2,"XBT/USD"]`, `[1,{},"ticker",2]`, `not json`}
+		for _, msg := range cases {
+			_, _, err = parseMessage([]byte(msg))
+			assert.Error(t, err, msg)
+		}
+	})
+}
+
+func Test_parseTicker(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	now := time.Unix(100, 0).UTC()
+
+	_, data, _ := parseMessage([]byte(tickerFixture))
+	tick, err := parseTicker(data, now)
+	assert.NoError(t, err)
+	assert.Equal(t, crypto.Tick{T: now, P: btc_usd, Bid: crypto.MustDecimal("5525.10000"), Ask: crypto.MustDecimal("5525.40000"), ExchangeId: "kraken"}, tick)
+
+	cases := []string{
+		`[1,{"a":[],"b":["1",1,"1"]},"ticker","XBT/USD"]`,
+		`[1,{"a":["x",1,"1"],"b":["1",1,"1"]},"ticker","XBT/USD"]`,
+		`[1,{"a":["1",1,"1"],"b":["1",1,"1"]},"ticker","XBTUSD"]`,
+		`[1,[],"ticker","XBT/USD"]`,
+	}
+	for _, msg := range cases {
+		_, data, err = parseMessage([]byte(msg))
+		assert.NoError(t, err)
+		_, err = parseTicker(data, now)
+		assert.Error(t, err, msg)
+	}
+}
+
+func Test_parseSpread(t *testing.T) {
+	doge_btc, _ := crypto.NewPair("doge", "btc")
+
+	_, data, _ := parseMessage([]byte(spreadFixture))
+	tick, err := parseSpread(data)
+	assert.NoError(t, err)
+	assert.Equal(t, crypto.Tick{T: time.Unix(1542057299, 545897000).UTC(), P: doge_btc, Bid: crypto.MustDecimal("5698.40000"), Ask: crypto.MustDecimal("5700.00000"), ExchangeId: "kraken"}, tick)
+
+	cases := []string{
+		`[1,["1","2"],"spread","XBT/USD"]`,
+		`[1,["1","2","x"],"spread","XBT/USD"]`,
+		`[1,{},"spread","XBT/USD"]`,
+	}
+	for _, msg := range cases {
+		_, data, err = parseMessage([]byte(msg))
+		assert.NoError(t, err)
+		_, err = parseSpread(data)
+		assert.Error(t, err, msg)
+	}
+}
+
+func Test_parseUnixTime(t *testing.T) {
+	cases := []struct {
+		s        string
+		expected time.Time
+		hasError bool
+	}{
+		{"1542057299.545897", time.Unix(1542057299, 545897000).UTC(), false},
+		{"1542057299", time.Unix(1542057299, 0).UTC(), false},
+		{"1542057299.1234567891", time.Unix(1542057299, 123456789).UTC(), false},
+		{"x.1", time.Time{}, true},
+		{"1.x", time.Time{}, true},
+	}
+	for _, testCase := range cases {
+		actual, err := parseUnixTime(testCase.s)
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, actual)
+	}
+}
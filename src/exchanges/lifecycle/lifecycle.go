@@ -0,0 +1,139 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Reason describes why Exchanger has been stopped
+type Reason int
+
+const (
+	// Stop() has been called
+	UserStop Reason = iota + 1
+	// Context passed to ServeContext has been cancelled or its deadline exceeded
+	ContextDone
+	// Connection has been closed by remote side and couldn't be restored
+	RemoteClose
+	// Exchange sent error or message which can't be handled
+	ProtocolError
+)
+
+// Returns Reason as string
+func (r Reason) String() string {
+	switch r {
+	case UserStop:
+		return "user stop"
+	case ContextDone:
+		return "context done"
+	case RemoteClose:
+		return "remote close"
+	case ProtocolError:
+		return "protocol error"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(r))
+	}
+}
+
+// StopError is returned by ServeContext, it describes why Exchanger has been stopped
+// Detail is a value passed to Stop(), Err is an underlying error if any
+type StopError struct {
+	Reason Reason
+	Detail interface{}
+	Err    error
+}
+
+// Returns StopError as string
+func (e *StopError) Error() string {
+	s := "stopped: " + e.Reason.String()
+	if e.Detail != nil {
+		s += fmt.Sprintf(": %v", e.Detail)
+	}
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// Returns underlying error
+func (e *StopError) Unwrap() error {
+	return e.Err
+}
+
+// Returns Reason of err if it's StopError, 0 otherwise
+func ReasonOf(err error) Reason {
+	var stopErr *StopError
+	if errors.As(err, &stopErr) {
+		return stopErr.Reason
+	}
+	return 0
+}
+
+// Stopper is an idempotent stop signal, only the first Stop is taken into account
+// Zero value is ready to use, so Exchanger may be stopped before Serve. Stopper is safe for concurrent use
+type Stopper struct {
+	once sync.Once
+	init sync.Once
+	done chan struct{}
+	err  *StopError
+}
+
+// Creates new Stopper
+func NewStopper() *Stopper {
+	return &Stopper{done: make(chan struct{})}
+}
+
+// Returns done chan, creates it on first call
+func (s *Stopper) doneChan() chan struct{} {
+	s.init.Do(func() {
+		if s.done == nil {
+			s.done = make(chan struct{})
+		}
+	})
+	return s.done
+}
+
+// Stops with reason. Returns true if this call has stopped Stopper, false if it's been stopped before
+func (s *Stopper) Stop(reason Reason, detail interface{}, err error) (stopped bool) {
+	s.once.Do(func() {
+		s.err = &StopError{Reason: reason, Detail: detail, Err: err}
+		close(s.doneChan())
+		stopped = true
+	})
+	return stopped
+}
+
+// Returns chan which is closed on Stop
+func (s *Stopper) Done() <-chan struct{} {
+	return s.doneChan()
+}
+
+// Returns true if Stopper has been stopped
+func (s *Stopper) Stopped() bool {
+	select {
+	case <-s.doneChan():
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns StopError of the first Stop or nil if Stopper hasn't been stopped yet
+func (s *Stopper) Err() *StopError {
+	if !s.Stopped() {
+		return nil
+	}
+	return s.err
+}
+
+// Stops with ContextDone when ctx is done. Returns when either ctx or Stopper is done
+// Should be run in goroutine
+func (s *Stopper) Watch(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		s.Stop(ContextDone, nil, ctx.Err())
+	case <-s.doneChan():
+	}
+}
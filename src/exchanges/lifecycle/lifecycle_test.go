@@ -0,0 +1,90 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestReason_String(t *testing.T) {
+	assert.Equal(t, "user stop", UserStop.String())
+	assert.Equal(t, "context done", ContextDone.String())
+	assert.Equal(t, "remote close", RemoteClose.String())
+	assert.Equal(t, "protocol error", ProtocolError.String())
+	assert.Equal(t, "unknown(0)", Reason(0).String())
+}
+
+func TestStopError(t *testing.T) {
+	eof := errors.New("EOF")
+	err := &StopError{Reason: RemoteClose, Detail: "connection closed", Err: eof}
+	assert.Equal(t, "stopped: remote close: connection closed: EOF", err.Error())
+	assert.True(t, errors.Is(err, eof))
+
+	assert.Equal(t, RemoteClose, ReasonOf(fmt.Errorf("serve: %w", err)))
+	assert.Equal(t, Reason(0), ReasonOf(eof))
+	assert.Equal(t, Reason(0), ReasonOf(nil))
+}
+
+func TestStopper_Stop(t *testing.T) {
+	s := NewStopper()
+	assert.False(t, s.Stopped())
+	assert.Nil(t, s.Err())
+
+	assert.True(t, s.Stop(UserStop, "first", nil))
+	assert.False(t, s.Stop(RemoteClose, "second", nil))
+	assert.True(t, s.Stopped())
+	assert.Equal(t, &StopError{Reason: UserStop, Detail: "first"}, s.Err())
+
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("Done chan isn't closed")
+	}
+}
+
+func TestStopper_zero(t *testing.T) {
+	s := Stopper{}
+	done := s.Done()
+	assert.False(t, s.Stopped())
+	assert.True(t, s.Stop(UserStop, nil, nil))
+	select {
+	case <-done:
+	default:
+		t.Fatal("Done chan isn't closed")
+	}
+	assert.Equal(t, UserStop, s.Err().Reason)
+}
+
+func TestStopper_Watch(t *testing.T) {
+	t.Run("context cancel stops Stopper", func(t *testing.T) {
+		s := NewStopper()
+		ctx, cancel := context.WithCancel(context.Background())
+		go s.Watch(ctx)
+		cancel()
+		select {
+		case <-s.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("Stopper isn't stopped")
+		}
+		assert.Equal(t, ContextDone, s.Err().Reason)
+		assert.True(t, errors.Is(s.Err(), context.Canceled))
+	})
+
+	t.Run("Watch returns on Stop", func(t *testing.T) {
+		s := NewStopper()
+		returned := make(chan struct{})
+		go func() {
+			s.Watch(context.Background())
+			close(returned)
+		}()
+		s.Stop(UserStop, nil, nil)
+		select {
+		case <-returned:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Watch hasn't returned")
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package exchanges
+
+import (
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"sync"
+)
+
+// Pairs keeps pairs of Exchanger which may be replaced while it's serving
+// Zero value is ready to use, Pairs is safe for concurrent use
+type Pairs struct {
+	mu    sync.RWMutex
+	pairs []crypto.Pair
+}
+
+// Replaces pairs by copy of pairs
+// Returns error if no pair is set, current pairs are kept then
+func (p *Pairs) Set(pairs ...crypto.Pair) error {
+	if len(pairs) == 0 {
+		return fmt.Errorf("at least one pair should be set")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pairs = make([]crypto.Pair, len(pairs))
+	copy(p.pairs, pairs)
+	return nil
+}
+
+// Returns copy of current pairs
+func (p *Pairs) Get() []crypto.Pair {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	pairs := make([]crypto.Pair, len(p.pairs))
+	copy(pairs, p.pairs)
+	return pairs
+}
@@ -0,0 +1,24 @@
+package exchanges
+
+import (
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPairs(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	eth_usd, _ := crypto.NewPair("eth", "usd")
+
+	p := Pairs{}
+	assert.Empty(t, p.Get())
+	pairs := []crypto.Pair{btc_usd, eth_usd}
+	assert.NoError(t, p.Set(pairs...))
+	pairs[0] = eth_usd
+	assert.Equal(t, []crypto.Pair{btc_usd, eth_usd}, p.Get())
+
+	assert.Error(t, p.Set())
+	got := p.Get()
+	got[0] = eth_usd
+	assert.Equal(t, []crypto.Pair{btc_usd, eth_usd}, p.Get())
+}
@@ -0,0 +1,82 @@
+package reconnect
+
+import (
+	"sync"
+	"time"
+)
+
+// Events delivers Event to caller of Exchanger, zero value is ready to use
+// Events are dropped if nobody reads the chan. Events is safe for concurrent use
+type Events struct {
+	mu sync.Mutex
+	ch chan Event
+}
+
+// Returns chan of Events, it's created on first call
+func (e *Events) Chan() <-chan Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ch == nil {
+		e.ch = make(chan Event, 16)
+	}
+	return e.ch
+}
+
+// Sets time of event and sends it without blocking, returns sent event
+func (e *Events) Emit(event Event) Event {
+	event.Time = time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ch == nil {
+		return event
+	}
+	select {
+	case e.ch <- event:
+	default:
+	}
+	return event
+}
+
+// Loop restores lost connection of Exchanger according to Policy
+// Close drops lost connection and connection which failed to subscribe, Subscribe subscribes over new connection
+// Close and Subscribe may be nil if there is nothing to do. Emit receives every Event of Loop
+type Loop struct {
+	Policy    Policy
+	Dial      func() error
+	Subscribe func() error
+	Close     func()
+	Emit      func(Event)
+}
+
+// Run drops connection lost by reason, redials and resubscribes it until it succeeds
+// Returns false if done has been closed or Policy doesn't allow more attempts
+func (l Loop) Run(done <-chan struct{}, reason error) bool {
+	if l.Close != nil {
+		l.Close()
+	}
+	l.Emit(Event{Type: Disconnected, Err: reason})
+	for attempt := 1; l.Policy.Allows(attempt); attempt++ {
+		delay := l.Policy.Delay(attempt)
+		l.Emit(Event{Type: Reconnecting, Attempt: attempt, Delay: delay, Err: reason})
+		select {
+		case <-done:
+			return false
+		case <-time.After(delay):
+		}
+		if reason = l.Dial(); reason != nil {
+			continue
+		}
+		if l.Subscribe != nil {
+			if reason = l.Subscribe(); reason != nil {
+				if l.Close != nil {
+					l.Close()
+				}
+				continue
+			}
+		}
+		l.Emit(Event{Type: Reconnected, Attempt: attempt})
+		return true
+	}
+	l.Emit(Event{Type: GaveUp, Err: reason})
+	return false
+}
@@ -0,0 +1,81 @@
+package reconnect
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	e := Events{}
+	assert.False(t, e.Emit(Event{Type: Disconnected}).Time.IsZero())
+
+	ch := e.Chan()
+	assert.Equal(t, ch, e.Chan())
+	for i := 0; i < cap(ch)+1; i++ {
+		e.Emit(Event{Type: Reconnecting, Attempt: i + 1})
+	}
+	assert.Len(t, ch, cap(ch))
+	assert.Equal(t, 1, (<-ch).Attempt)
+}
+
+func TestLoop_Run(t *testing.T) {
+	policy := Policy{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxAttempts: 3}
+	eof := errors.New("eof")
+
+	// Returns loop which fails dial fails times, subscribe fails once after successful dial if failSubscribe is set
+	newLoop := func(fails int, failSubscribe bool) (*Loop, *[]EventType, *int) {
+		var types []EventType
+		closed := 0
+		l := &Loop{
+			Policy: policy,
+			Dial: func() error {
+				if fails > 0 {
+					fails--
+					return errors.New("refused")
+				}
+				return nil
+			},
+			Subscribe: func() error {
+				if failSubscribe {
+					failSubscribe = false
+					return errors.New("rejected")
+				}
+				return nil
+			},
+			Close: func() { closed++ },
+			Emit:  func(e Event) { types = append(types, e.Type) },
+		}
+		return l, &types, &closed
+	}
+
+	t.Run("redials until connection is subscribed", func(t *testing.T) {
+		l, types, closed := newLoop(1, true)
+		assert.True(t, l.Run(make(chan struct{}), eof))
+		assert.Equal(t, []EventType{Disconnected, Reconnecting, Reconnecting, Reconnecting, Reconnected}, *types)
+		// lost connection and connection failed to subscribe
+		assert.Equal(t, 2, *closed)
+	})
+
+	t.Run("gives up when policy is exhausted", func(t *testing.T) {
+		l, types, _ := newLoop(3, false)
+		assert.False(t, l.Run(make(chan struct{}), eof))
+		assert.Equal(t, []EventType{Disconnected, Reconnecting, Reconnecting, Reconnecting, GaveUp}, *types)
+	})
+
+	t.Run("returns once done is closed", func(t *testing.T) {
+		l, types, _ := newLoop(0, false)
+		l.Policy = Policy{InitialDelay: time.Hour, MaxDelay: time.Hour}
+		done := make(chan struct{})
+		close(done)
+		assert.False(t, l.Run(done, eof))
+		assert.Equal(t, []EventType{Disconnected, Reconnecting}, *types)
+	})
+
+	t.Run("close and subscribe are optional", func(t *testing.T) {
+		l, _, _ := newLoop(0, false)
+		l.Close, l.Subscribe = nil, nil
+		assert.True(t, l.Run(make(chan struct{}), eof))
+	})
+}
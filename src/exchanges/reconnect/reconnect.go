@@ -0,0 +1,124 @@
+package reconnect
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Disabled can be used as MaxAttempts to turn reconnects off
+const Disabled = -1
+
+// Policy describes how an Exchanger redials after the connection has been lost
+// InitialDelay is a delay before the first attempt, every next attempt doubles it up to MaxDelay
+// Jitter is a fraction of delay (0..1) randomly added or subtracted to avoid reconnect storms
+// MaxAttempts limits attempts in a row, 0 means unlimited, Disabled turns reconnects off
+// InitialDelay must be positive unless reconnects are off, otherwise a dead endpoint is redialed in a tight loop
+type Policy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Jitter       float64
+	MaxAttempts  int
+}
+
+// DefaultPolicy is used by Exchangers if no other Policy has been set
+var DefaultPolicy = Policy{
+	InitialDelay: time.Second,
+	MaxDelay:     time.Minute,
+	Jitter:       0.2,
+	MaxAttempts:  0,
+}
+
+// Returns error if some of Policy fields are out of range
+func (p Policy) Validate() error {
+	if p.MaxAttempts == Disabled {
+		return nil
+	}
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("max attempts should be positive, zero or Disabled: %d", p.MaxAttempts)
+	}
+	if p.InitialDelay <= 0 {
+		return fmt.Errorf("initial delay should be positive: %s", p.InitialDelay)
+	}
+	if p.MaxDelay < p.InitialDelay {
+		return fmt.Errorf("max delay %s is less than initial delay %s", p.MaxDelay, p.InitialDelay)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("jitter should be in range [0, 1]: %f", p.Jitter)
+	}
+	return nil
+}
+
+// Returns true if Policy allows one more attempt. Attempts are counted from 1
+func (p Policy) Allows(attempt int) bool {
+	if p.MaxAttempts == Disabled {
+		return false
+	}
+	return p.MaxAttempts == 0 || attempt <= p.MaxAttempts
+}
+
+// Returns delay before attempt. Attempts are counted from 1
+func (p Policy) Delay(attempt int) time.Duration {
+	d := p.InitialDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 && d > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d))
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// EventType represents what happened with connection
+type EventType int
+
+const (
+	Disconnected EventType = iota + 1
+	Reconnecting
+	Reconnected
+	GaveUp
+)
+
+// Returns EventType as string
+func (t EventType) String() string {
+	switch t {
+	case Disconnected:
+		return "disconnected"
+	case Reconnecting:
+		return "reconnecting"
+	case Reconnected:
+		return "reconnected"
+	case GaveUp:
+		return "gave up"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(t))
+	}
+}
+
+// Event is sent to caller on every change of connection state
+// Err holds the reason of disconnect or failed attempt
+type Event struct {
+	Type    EventType
+	Attempt int
+	Delay   time.Duration
+	Err     error
+	Time    time.Time
+}
+
+// Represents Event as string
+func (e Event) String() string {
+	s := fmt.Sprintf("%s, attempt: %d", e.Type, e.Attempt)
+	if e.Delay > 0 {
+		s += fmt.Sprintf(", delay: %s", e.Delay)
+	}
+	if e.Err != nil {
+		s += fmt.Sprintf(", error: %s", e.Err)
+	}
+	return s
+}
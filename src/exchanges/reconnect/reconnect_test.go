@@ -0,0 +1,75 @@
+package reconnect
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Validate(t *testing.T) {
+	cases := []struct {
+		policy   Policy
+		hasError bool
+	}{
+		{DefaultPolicy, false},
+		{Policy{MaxAttempts: Disabled}, false},
+		{Policy{InitialDelay: time.Second, MaxDelay: time.Second}, false},
+		{Policy{MaxAttempts: -2}, true},
+		{Policy{}, true},
+		{Policy{MaxDelay: time.Second, MaxAttempts: 3}, true},
+		{Policy{InitialDelay: -time.Second}, true},
+		{Policy{InitialDelay: time.Minute, MaxDelay: time.Second}, true},
+		{Policy{InitialDelay: time.Second, MaxDelay: time.Second, Jitter: 1.5}, true},
+		{Policy{InitialDelay: time.Second, MaxDelay: time.Second, Jitter: -0.1}, true},
+	}
+	for _, testCase := range cases {
+		err := testCase.policy.Validate()
+		if testCase.hasError {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+	}
+}
+
+func TestPolicy_Allows(t *testing.T) {
+	cases := []struct {
+		policy   Policy
+		attempt  int
+		expected bool
+	}{
+		{Policy{MaxAttempts: 0}, 100, true},
+		{Policy{MaxAttempts: 3}, 3, true},
+		{Policy{MaxAttempts: 3}, 4, false},
+		{Policy{MaxAttempts: Disabled}, 1, false},
+	}
+	for _, testCase := range cases {
+		assert.Equal(t, testCase.expected, testCase.policy.Allows(testCase.attempt))
+	}
+}
+
+func TestPolicy_Delay(t *testing.T) {
+	t.Run("delay grows exponentially up to max delay", func(t *testing.T) {
+		p := Policy{InitialDelay: time.Second, MaxDelay: 5 * time.Second}
+		assert.Equal(t, time.Second, p.Delay(1))
+		assert.Equal(t, 2*time.Second, p.Delay(2))
+		assert.Equal(t, 4*time.Second, p.Delay(3))
+		assert.Equal(t, 5*time.Second, p.Delay(4))
+		assert.Equal(t, 5*time.Second, p.Delay(100))
+	})
+
+	t.Run("jitter keeps delay in range", func(t *testing.T) {
+		p := Policy{InitialDelay: time.Second, MaxDelay: time.Second, Jitter: 0.5}
+		for i := 0; i < 100; i++ {
+			d := p.Delay(1)
+			assert.True(t, d >= 500*time.Millisecond && d <= 1500*time.Millisecond, d)
+		}
+	})
+}
+
+func TestEvent_String(t *testing.T) {
+	e := Event{Type: Reconnecting, Attempt: 2, Delay: time.Second, Err: errors.New("eof")}
+	assert.Equal(t, "reconnecting, attempt: 2, delay: 1s, error: eof", e.String())
+	assert.Equal(t, "unknown(0)", EventType(0).String())
+}
@@ -0,0 +1,12 @@
+// Package all registers every storage of crypto-fetcher in storage registry
+// Import it for side effects:
+//
+//	import _ "github.com/Sn0w1eo/crypto-fetcher/src/storage/all"
+package all
+
+import (
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/storage/file"
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/storage/mysql"
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/storage/postgres"
+	_ "github.com/Sn0w1eo/crypto-fetcher/src/storage/sqlite"
+)
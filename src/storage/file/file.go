@@ -0,0 +1,266 @@
+package file
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/storage"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Formats of files
+const (
+	CSV  = "csv"
+	JSON = "json"
+)
+
+// Columns of files, same as columns of storage/mysql tables
+var (
+	tickColumns = []string{"timestamp", "symbol", "bid", "ask",
+		"received", "exchange", "sequence", "trade_id", "price", "size", "volume_24h", "bid_size", "ask_size", "raw"}
+	tradeColumns  = []string{"timestamp", "symbol", "trade_id", "price", "size", "side", "maker_order_id", "taker_order_id"}
+	candleColumns = []string{"timestamp", "symbol", "granularity", "open", "high", "low", "close", "volume"}
+	// metadata of ticks, empty if unknown, it's omitted by JSON
+	tickMetaColumns = tickColumns[4:]
+)
+
+// FileStorage appends ticks, trades and candles to ticks, trades and candles files of directory
+// CSV files get header once they are created, JSON files have one object per line
+// Existing CSV files keep their header, so columns added later aren't written to them
+// Candles are appended, so candle of same pair, interval and time is written again instead of being replaced
+type FileStorage struct {
+	dir    string
+	format string
+
+	mu      sync.Mutex
+	ticks   *sink
+	trades  *sink
+	candles *sink
+}
+
+// Registers FileStorage as file storage
+func init() {
+	storage.Register("file", func() (storage.Storage, error) {
+		return New()
+	})
+}
+
+// Creates FileStorage
+func New() (*FileStorage, error) {
+	return new(FileStorage), nil
+}
+
+// Opens files of directory for append, directory is created if it doesn't exist
+// DSN is URL of directory with format parameter csv (default) or json, e.g. file:///var/lib/crypto-fetcher?format=csv
+// Relative directory is set by host, e.g. file://data
+func (fs *FileStorage) Open(dsn string) error {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return fmt.Errorf("bad DSN: %s", err)
+	}
+	if u.Scheme != "file" {
+		return fmt.Errorf("bad DSN scheme: %s, expected file", u.Scheme)
+	}
+	fs.dir = filepath.FromSlash(u.Host + u.Path)
+	if fs.dir == "" {
+		return fmt.Errorf("directory isn't set")
+	}
+	fs.format = u.Query().Get("format")
+	if fs.format == "" {
+		fs.format = CSV
+	}
+	if fs.format != CSV && fs.format != JSON {
+		return fmt.Errorf("format is not supported: %s", fs.format)
+	}
+	if err = os.MkdirAll(fs.dir, 0755); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.ticks, err = fs.open("ticks", tickColumns); err != nil {
+		return err
+	}
+	fs.ticks.optional = tickMetaColumns
+	if fs.trades, err = fs.open("trades", tradeColumns); err != nil {
+		_ = fs.ticks.close()
+		return err
+	}
+	if fs.candles, err = fs.open("candles", candleColumns); err != nil {
+		_ = fs.ticks.close()
+		_ = fs.trades.close()
+		return err
+	}
+	return nil
+}
+
+// Opens file of name for append, writes CSV header if file is empty, otherwise reads it
+func (fs *FileStorage) open(name string, columns []string) (*sink, error) {
+	path := filepath.Join(fs.dir, name+"."+fs.format)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &sink{file: f, format: fs.format, columns: columns, header: columns}
+	if fs.format != CSV {
+		return s, nil
+	}
+	info, err := f.Stat()
+	switch {
+	case err != nil:
+	case info.Size() == 0:
+		err = s.writeCSV(columns)
+	default:
+		s.header, err = readHeader(path)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Returns header of CSV file
+func readHeader(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header, err := csv.NewReader(f).Read()
+	if err != nil {
+		return nil, fmt.Errorf("bad header of %s: %s", path, err)
+	}
+	return header, nil
+}
+
+// Writes crypto.Ticker to ticks file, metadata and raw payload of crypto.Tick are written as well
+func (fs *FileStorage) WriteTick(ticker crypto.Ticker) error {
+	pair, _ := ticker.Pair()
+	bid, _ := ticker.BestBid()
+	ask, _ := ticker.BestAsk()
+	tick, _ := ticker.(crypto.Tick)
+	var received string
+	if !tick.Received.IsZero() {
+		received = formatTime(tick.Received)
+	}
+	return fs.write(fs.ticks, formatTime(ticker.Timestamp()), pair.String('-'), bid.String(), ask.String(),
+		received, tick.ExchangeId, formatInt(tick.Sequence), formatInt(tick.TradeId), formatDecimal(tick.Price), formatDecimal(tick.Size),
+		formatDecimal(tick.Volume24h), formatDecimal(tick.BidSize), formatDecimal(tick.AskSize), string(tick.Raw))
+}
+
+// Writes crypto.Trade to trades file
+func (fs *FileStorage) WriteTrade(trade crypto.Trade) error {
+	return fs.write(fs.trades, formatTime(trade.T), trade.P.String('-'), trade.Id, trade.Price.String(), trade.Size.String(),
+		trade.Side.String(), trade.MakerOrderId, trade.TakerOrderId)
+}
+
+// Writes crypto.Candle to candles file
+func (fs *FileStorage) WriteCandle(candle crypto.Candle) error {
+	return fs.write(fs.candles, formatTime(candle.T), candle.P.String('-'), strconv.FormatInt(int64(candle.Interval.Seconds()), 10),
+		candle.Open.String(), candle.High.String(), candle.Low.String(), candle.Close.String(), candle.Volume.String())
+}
+
+// Writes row to sink, storage may be written by several goroutines
+func (fs *FileStorage) write(s *sink, row ...string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if s == nil || s.file == nil {
+		return fmt.Errorf("storage isn't opened")
+	}
+	return s.write(row)
+}
+
+// Closes files
+func (fs *FileStorage) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var err error
+	for _, s := range []*sink{fs.ticks, fs.trades, fs.candles} {
+		if s == nil {
+			continue
+		}
+		if closeErr := s.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Formats time of record, precision is kept
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// Formats metadata, 0 is unknown value and it's empty
+func formatInt(i int64) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.FormatInt(i, 10)
+}
+
+// Formats metadata, 0 is unknown value and it's empty
+func formatDecimal(d crypto.Decimal) string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.String()
+}
+
+// sink is one file of records
+type sink struct {
+	file    *os.File
+	format  string
+	columns []string
+	// columns of CSV file in its order, columns which file doesn't have are skipped
+	header []string
+	// columns which are omitted by JSON if they are empty
+	optional []string
+}
+
+// Writes row of columns as CSV record or JSON object
+func (s *sink) write(row []string) error {
+	obj := make(map[string]string, len(row))
+	for i, c := range s.columns {
+		obj[c] = row[i]
+	}
+	if s.format == CSV {
+		record := make([]string, len(s.header))
+		for i, c := range s.header {
+			record[i] = obj[c]
+		}
+		return s.writeCSV(record)
+	}
+	for _, c := range s.optional {
+		if obj[c] == "" {
+			delete(obj, c)
+		}
+	}
+	return json.NewEncoder(s.file).Encode(obj)
+}
+
+// Writes CSV record and flushes it to file
+func (s *sink) writeCSV(record []string) error {
+	w := csv.NewWriter(s.file)
+	if err := w.Write(record); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Closes file, sink isn't writable afterwards
+func (s *sink) close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,100 @@
+package file
+
+import (
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/storage"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileStorage(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	tick := crypto.Tick{T: time.Date(2021, 1, 1, 0, 0, 0, 1000, time.UTC), P: btc_usd, Bid: crypto.MustDecimal("1.5"), Ask: crypto.MustDecimal("2")}
+	trade := crypto.Trade{T: tick.T, P: btc_usd, Id: "1", Price: crypto.MustDecimal("1.75"), Size: crypto.MustDecimal("0.1"), Side: crypto.Bid}
+	candle := crypto.Candle{T: tick.T, P: btc_usd, Interval: time.Minute, Open: tick.Bid, High: tick.Ask, Low: tick.Bid, Close: tick.Ask, Volume: trade.Size}
+
+	t.Run("csv", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "storage")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		for i := 0; i < 2; i++ {
+			st, err := storage.Open("file://" + filepath.ToSlash(dir) + "?format=csv")
+			assert.NoError(t, err)
+			assert.NoError(t, st.WriteTick(tick))
+			assert.NoError(t, st.WriteTrade(trade))
+			assert.NoError(t, st.WriteCandle(candle))
+			assert.NoError(t, st.Close())
+			assert.Error(t, st.WriteTick(tick))
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, "ticks.csv"))
+		assert.NoError(t, err)
+		assert.Equal(t, "timestamp,symbol,bid,ask,received,exchange,sequence,trade_id,price,size,volume_24h,bid_size,ask_size,raw\n"+
+			strings.Repeat("2021-01-01T00:00:00.000001Z,BTC-USD,1.5,2,,,,,,,,,,\n", 2), string(b))
+		b, err = ioutil.ReadFile(filepath.Join(dir, "trades.csv"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), "2021-01-01T00:00:00.000001Z,BTC-USD,1,1.75,0.1,bid,,\n")
+		b, err = ioutil.ReadFile(filepath.Join(dir, "candles.csv"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), "2021-01-01T00:00:00.000001Z,BTC-USD,60,1.5,2,1.5,2,0.1\n")
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "storage")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		meta := tick
+		meta.Received = tick.T.Add(time.Millisecond)
+		meta.ExchangeId, meta.Sequence, meta.Price = "coinbase", 42, crypto.MustDecimal("1.75")
+		meta.Raw = []byte(`{"type":"ticker"}`)
+
+		st, err := storage.Open("file://" + filepath.ToSlash(dir) + "?format=json")
+		assert.NoError(t, err)
+		assert.NoError(t, st.WriteTick(meta))
+		assert.NoError(t, st.Close())
+		b, err := ioutil.ReadFile(filepath.Join(dir, "ticks.json"))
+		assert.NoError(t, err)
+		assert.Equal(t, `{"ask":"2","bid":"1.5","exchange":"coinbase","price":"1.75","raw":"{\"type\":\"ticker\"}",`+
+			`"received":"2021-01-01T00:00:00.001001Z","sequence":"42","symbol":"BTC-USD","timestamp":"2021-01-01T00:00:00.000001Z"}`+"\n", string(b))
+
+		// existing CSV file keeps its header
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ticks.csv"), []byte("timestamp,symbol,bid,ask\n"), 0644))
+		st, err = storage.Open("file://" + filepath.ToSlash(dir) + "?format=csv")
+		assert.NoError(t, err)
+		assert.NoError(t, st.WriteTick(meta))
+		assert.NoError(t, st.Close())
+		b, err = ioutil.ReadFile(filepath.Join(dir, "ticks.csv"))
+		assert.NoError(t, err)
+		assert.Equal(t, "timestamp,symbol,bid,ask\n2021-01-01T00:00:00.000001Z,BTC-USD,1.5,2\n", string(b))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "storage")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		st, err := storage.Open("file://" + filepath.ToSlash(dir) + "?format=json")
+		assert.NoError(t, err)
+		assert.NoError(t, st.WriteTick(tick))
+		assert.NoError(t, st.Close())
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, "ticks.json"))
+		assert.NoError(t, err)
+		assert.Equal(t, `{"ask":"2","bid":"1.5","symbol":"BTC-USD","timestamp":"2021-01-01T00:00:00.000001Z"}`+"\n", string(b))
+	})
+
+	t.Run("bad DSN", func(t *testing.T) {
+		fs, _ := New()
+		assert.Error(t, fs.Open("file://"))
+		assert.Error(t, fs.Open("mysql://host/db"))
+		assert.Error(t, fs.Open("file:///tmp?format=xml"))
+		assert.Error(t, fs.WriteTick(tick))
+		assert.NoError(t, fs.Close())
+	})
+}
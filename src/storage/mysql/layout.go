@@ -0,0 +1,191 @@
+package mysql
+
+import (
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"strings"
+)
+
+// Tables are names of base tables, tables of exchanges and pairs are named after them, e.g. Ticks_BTC_USD
+type Tables struct {
+	Ticks   string
+	Trades  string
+	Candles string
+}
+
+// Default names of database and tables, used if DSN has no database and tables aren't set
+const DefaultDatabase = "CryptoFetcher"
+
+var DefaultTables = Tables{Ticks: "Ticks", Trades: "Trades", Candles: "Candles"}
+
+// Max length of MySQL identifier
+const maxIdentifier = 64
+
+// Layout describes how ticks and trades are split into tables
+type Layout int
+
+const (
+	// Single keeps ticks and trades in base tables
+	Single Layout = iota + 1
+	// PerExchange keeps ticks and trades in table of exchange, e.g. Ticks_coinbase
+	// Values without exchange are kept in base tables
+	PerExchange
+	// PerPair keeps ticks and trades in table of pair, e.g. Ticks_BTC_USD
+	PerPair
+)
+
+// Names of layouts, used by tables parameter of DSN
+var layoutNames = map[Layout]string{
+	Single:      "single",
+	PerExchange: "exchange",
+	PerPair:     "pair",
+}
+
+// Returns name of Layout
+func (l Layout) String() string {
+	if name, ok := layoutNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(l))
+}
+
+// Returns Layout by name, case insensitive
+func ParseLayout(name string) (Layout, error) {
+	for l, n := range layoutNames {
+		if strings.EqualFold(n, name) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("layout not found: %s", name)
+}
+
+// Returns error if name isn't a plain MySQL identifier, which is safe to quote by backticks
+func checkIdentifier(name string) error {
+	if name == "" || len(name) > maxIdentifier {
+		return fmt.Errorf("name should be 1 to %d characters long: %s", maxIdentifier, name)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '$') {
+			return fmt.Errorf("name should consist of letters, digits, _ and $: %s", name)
+		}
+	}
+	return nil
+}
+
+// Replaces characters which aren't allowed in table names by _
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// Returns name of derived table of base one, suffix is exchange or pair
+func derived(base string, suffix string) string {
+	name := base + "_" + sanitize(suffix)
+	if len(name) > maxIdentifier {
+		name = name[:maxIdentifier]
+	}
+	return name
+}
+
+// Sets names of database and base tables, empty names keep defaults. Must be invoked before Open
+// Database of DSN takes precedence over database set here
+func (mysqlConn *MySQLConn) SetTables(database string, tables Tables) error {
+	if database == "" {
+		database = mysqlConn.database
+	}
+	if tables.Ticks == "" {
+		tables.Ticks = mysqlConn.tables.Ticks
+	}
+	if tables.Trades == "" {
+		tables.Trades = mysqlConn.tables.Trades
+	}
+	if tables.Candles == "" {
+		tables.Candles = mysqlConn.tables.Candles
+	}
+	for _, name := range []string{database, tables.Ticks, tables.Trades, tables.Candles} {
+		if err := checkIdentifier(name); err != nil {
+			return err
+		}
+	}
+	if tables.Ticks == tables.Trades || tables.Ticks == tables.Candles || tables.Trades == tables.Candles {
+		return fmt.Errorf("tables should have different names: %s, %s, %s", tables.Ticks, tables.Trades, tables.Candles)
+	}
+	mysqlConn.database = database
+	mysqlConn.tables = tables
+	return nil
+}
+
+// Sets Layout of ticks and trades tables. Must be invoked before Open
+func (mysqlConn *MySQLConn) SetLayout(layout Layout) error {
+	if _, ok := layoutNames[layout]; !ok {
+		return fmt.Errorf("layout is not supported: %s", layout)
+	}
+	mysqlConn.layout = layout
+	return nil
+}
+
+// Returns quoted name of table in database
+func (mysqlConn *MySQLConn) qualified(table string) string {
+	return fmt.Sprintf("`%s`.`%s`", mysqlConn.database, table)
+}
+
+// Returns table of value by Layout, exchange is taken from value if it has Exchange() method
+func (mysqlConn *MySQLConn) tableOf(base string, pair crypto.Pair, v interface{}) string {
+	switch mysqlConn.layout {
+	case PerPair:
+		return derived(base, pair.String('_'))
+	case PerExchange:
+		if e, ok := v.(interface{ Exchange() string }); ok && e.Exchange() != "" {
+			return derived(base, strings.ToLower(e.Exchange()))
+		}
+	}
+	return base
+}
+
+// Returns base table and existing tables derived of it
+func (mysqlConn *MySQLConn) tablesOf(base string) ([]string, error) {
+	prefix := strings.NewReplacer(`\`, `\\`, "_", `\_`, "%", `\%`).Replace(base + "_")
+	rows, err := mysqlConn.db.Query("SELECT table_name FROM information_schema.tables "+
+		"WHERE table_schema = ? AND table_name LIKE ? ORDER BY table_name;", mysqlConn.database, prefix+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables := []string{base}
+	for rows.Next() {
+		var table string
+		if err = rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// Creates derived table as a copy of base one, including indexes and partitions
+// Created tables are cached, so table is created once per connection
+func (mysqlConn *MySQLConn) ensureTable(base string, table string) error {
+	if table == base {
+		return nil
+	}
+	mysqlConn.tablesMu.Lock()
+	defer mysqlConn.tablesMu.Unlock()
+	if mysqlConn.created[table] {
+		return nil
+	}
+	if _, err := mysqlConn.db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s LIKE %s;",
+		mysqlConn.qualified(table), mysqlConn.qualified(base))); err != nil {
+		return err
+	}
+	if mysqlConn.retention > 0 {
+		if err := mysqlConn.partition(table); err != nil {
+			return err
+		}
+	}
+	mysqlConn.created[table] = true
+	return nil
+}
@@ -0,0 +1,324 @@
+package mysql
+
+import (
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"strings"
+	"time"
+)
+
+// Index of ticks tables used by reads of pair in time range
+const tickIndex = "symbol_timestamp"
+
+// MySQL errors of statements which have been applied already, e.g. by hand before migrations
+const (
+	// CREATE INDEX of existing index
+	errDupKeyName = 1061
+	// REMOVE PARTITIONING of table which isn't partitioned
+	errPartitionMgmtOnNonpartitioned = 1505
+)
+
+// Placeholders of names in statements of migrations
+// Statement of ticks or trades is executed for base table and every table of exchange or pair
+const (
+	databaseName = "{{database}}"
+	ticksTable   = "{{ticks}}"
+	tradesTable  = "{{trades}}"
+	candlesTable = "{{candles}}"
+	// type of precise time columns by Precision
+	timeType = "{{time}}"
+)
+
+// Converts bid and ask of ticks to decimal, tables created before decimal columns keep them as DOUBLE
+var decimalTicks = fmt.Sprintf("ALTER TABLE %s MODIFY `bid` %s NOT NULL, MODIFY `ask` %s NOT NULL;", ticksTable, decimalType, decimalType)
+
+// Migration is a versioned change of schema, Down statements revert Up ones
+type Migration struct {
+	Version int
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+// Migrations of schema ordered by version, a change of schema is appended as migration with the next version
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create ticks, trades and candles",
+		Up: []string{
+			"CREATE DATABASE IF NOT EXISTS " + databaseName + ";",
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			%s integer AUTO_INCREMENT NOT NULL PRIMARY KEY,
+			%s BIGINT NOT NULL,
+			%s VARCHAR(255) NOT NULL,
+			%s %s NOT NULL,
+			%s %s NOT NULL
+			);`, ticksTable, "`id`", "`timestamp`", "`symbol`", "`bid`", decimalType, "`ask`", decimalType),
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			%s integer AUTO_INCREMENT NOT NULL PRIMARY KEY,
+			%s BIGINT NOT NULL,
+			%s VARCHAR(255) NOT NULL,
+			%s VARCHAR(255) NOT NULL,
+			%s %s NOT NULL,
+			%s %s NOT NULL,
+			%s VARCHAR(8) NOT NULL,
+			%s VARCHAR(255) NOT NULL,
+			%s VARCHAR(255) NOT NULL
+			);`, tradesTable, "`id`", "`timestamp`", "`symbol`", "`trade_id`", "`price`", decimalType, "`size`", decimalType, "`side`", "`maker_order_id`", "`taker_order_id`"),
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			%s integer AUTO_INCREMENT NOT NULL PRIMARY KEY,
+			%s BIGINT NOT NULL,
+			%s VARCHAR(255) NOT NULL,
+			%s integer NOT NULL,
+			%s %s NOT NULL,
+			%s %s NOT NULL,
+			%s %s NOT NULL,
+			%s %s NOT NULL,
+			%s %s NOT NULL,
+			UNIQUE KEY %s (%s, %s, %s)
+			);`, candlesTable, "`id`", "`timestamp`", "`symbol`", "`granularity`", "`open`", decimalType, "`high`", decimalType, "`low`", decimalType, "`close`", decimalType, "`volume`", decimalType,
+				"`symbol_granularity_timestamp`", "`symbol`", "`granularity`", "`timestamp`"),
+		},
+		Down: []string{
+			"DROP TABLE IF EXISTS " + candlesTable + ";",
+			"DROP TABLE IF EXISTS " + tradesTable + ";",
+			"DROP TABLE IF EXISTS " + ticksTable + ";",
+		},
+	},
+	{
+		Version: 2,
+		Name:    "index ticks by symbol and timestamp",
+		Up:      []string{fmt.Sprintf("CREATE INDEX `%s` ON %s (`symbol`, `timestamp`);", tickIndex, ticksTable)},
+		Down:    []string{fmt.Sprintf("DROP INDEX `%s` ON %s;", tickIndex, ticksTable)},
+	},
+	{
+		// partitioning column should be a part of every unique key
+		Version: 3,
+		Name:    "add timestamp to primary keys of ticks and trades",
+		Up: []string{
+			"ALTER TABLE " + ticksTable + " DROP PRIMARY KEY, ADD PRIMARY KEY (`id`, `timestamp`);",
+			"ALTER TABLE " + tradesTable + " DROP PRIMARY KEY, ADD PRIMARY KEY (`id`, `timestamp`);",
+		},
+		Down: []string{
+			"ALTER TABLE " + ticksTable + " REMOVE PARTITIONING;",
+			"ALTER TABLE " + ticksTable + " DROP PRIMARY KEY, ADD PRIMARY KEY (`id`);",
+			"ALTER TABLE " + tradesTable + " REMOVE PARTITIONING;",
+			"ALTER TABLE " + tradesTable + " DROP PRIMARY KEY, ADD PRIMARY KEY (`id`);",
+		},
+	},
+	{
+		// timestamp in seconds is kept for indexes, partitions and aggregates, precise times are NULL for older ticks
+		Version: 4,
+		Name:    "add precise time and receive time to ticks",
+		Up: []string{
+			"ALTER TABLE " + ticksTable + " ADD COLUMN `time` " + timeType + " NULL, ADD COLUMN `received` " + timeType + " NULL;",
+		},
+		Down: []string{"ALTER TABLE " + ticksTable + " DROP COLUMN `time`, DROP COLUMN `received`;"},
+	},
+	{
+		Version: 5,
+		Name:    "add exchange metadata to ticks",
+		Up: []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN `exchange` VARCHAR(64) NULL, ADD COLUMN `sequence` BIGINT NULL, "+
+			"ADD COLUMN `trade_id` BIGINT NULL, ADD COLUMN `price` %s NULL, ADD COLUMN `size` %s NULL, ADD COLUMN `volume_24h` %s NULL, "+
+			"ADD COLUMN `bid_size` %s NULL, ADD COLUMN `ask_size` %s NULL, ADD COLUMN `raw` MEDIUMTEXT NULL;",
+			ticksTable, decimalType, decimalType, decimalType, decimalType, decimalType)},
+		Down: []string{"ALTER TABLE " + ticksTable + " DROP COLUMN `exchange`, DROP COLUMN `sequence`, DROP COLUMN `trade_id`, " +
+			"DROP COLUMN `price`, DROP COLUMN `size`, DROP COLUMN `volume_24h`, DROP COLUMN `bid_size`, DROP COLUMN `ask_size`, DROP COLUMN `raw`;"},
+	},
+	{
+		Version: 6,
+		Name:    "add precise time to trades",
+		Up:      []string{"ALTER TABLE " + tradesTable + " ADD COLUMN `time` " + timeType + " NULL;"},
+		Down:    []string{"ALTER TABLE " + tradesTable + " DROP COLUMN `time`;"},
+	},
+	{
+		// CREATE TABLE IF NOT EXISTS of version 1 keeps DOUBLE columns of tables created before it
+		// decimal columns are kept by Down, since version 1 creates them
+		Version: 7,
+		Name:    "convert bid and ask of ticks to decimal",
+		Up:      []string{decimalTicks},
+		Down:    []string{decimalTicks},
+	},
+}
+
+// Step is a migration applied or reverted by Migrate
+type Step struct {
+	Version int
+	Name    string
+	// true if migration is reverted by Down statements
+	Revert bool
+	// statements with names of database and tables in order of execution
+	Statements []string
+}
+
+// Returns version of the last migration
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Returns version of schema, 0 if no migration has been applied
+func (mysqlConn *MySQLConn) SchemaVersion() (int, error) {
+	if mysqlConn.db == nil {
+		return 0, fmt.Errorf("storage isn't opened")
+	}
+	exists, err := mysqlConn.tableExists("schema_version")
+	if err != nil || !exists {
+		return 0, err
+	}
+	var version int
+	err = mysqlConn.db.QueryRow("SELECT COALESCE(MAX(`version`), 0) FROM " + mysqlConn.qualified("schema_version") + ";").Scan(&version)
+	return version, err
+}
+
+// Returns true if table exists in database
+func (mysqlConn *MySQLConn) tableExists(table string) (bool, error) {
+	var exists bool
+	err := mysqlConn.db.QueryRow("SELECT EXISTS(SELECT 1 FROM information_schema.tables WHERE table_schema = ? AND table_name = ?);",
+		mysqlConn.database, table).Scan(&exists)
+	return exists, err
+}
+
+// Returns true if schema is unversioned legacy one, i.e. ticks table has been created before migrations
+// Legacy ticks table is kept by CREATE TABLE IF NOT EXISTS of version 1 with DOUBLE bid and ask
+func (mysqlConn *MySQLConn) legacy(current int) (bool, error) {
+	if current > 0 {
+		return false, nil
+	}
+	return mysqlConn.tableExists(mysqlConn.tables.Ticks)
+}
+
+// Returns steps migrating schema from version to target, statements have placeholders of names
+func plan(from int, target int) []Step {
+	var steps []Step
+	if target >= from {
+		for _, m := range migrations {
+			if m.Version > from && m.Version <= target {
+				steps = append(steps, Step{Version: m.Version, Name: m.Name, Statements: m.Up})
+			}
+		}
+		return steps
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if m := migrations[i]; m.Version <= from && m.Version > target {
+			steps = append(steps, Step{Version: m.Version, Name: m.Name, Revert: true, Statements: m.Down})
+		}
+	}
+	return steps
+}
+
+// Replaces placeholders of statements by names of database and tables and type of time columns
+// Statement of ticks or trades is repeated for every existing table of exchange or pair
+func (mysqlConn *MySQLConn) render(statements []string) ([]string, error) {
+	names := strings.NewReplacer(
+		databaseName, "`"+mysqlConn.database+"`",
+		candlesTable, mysqlConn.qualified(mysqlConn.tables.Candles),
+		timeType, mysqlConn.precision.columnType(),
+	)
+	var rendered []string
+	for _, statement := range statements {
+		placeholder, base := "", ""
+		switch {
+		case strings.Contains(statement, ticksTable):
+			placeholder, base = ticksTable, mysqlConn.tables.Ticks
+		case strings.Contains(statement, tradesTable):
+			placeholder, base = tradesTable, mysqlConn.tables.Trades
+		default:
+			rendered = append(rendered, names.Replace(statement))
+			continue
+		}
+		tables, err := mysqlConn.tablesOf(base)
+		if err != nil {
+			return nil, err
+		}
+		for _, table := range tables {
+			rendered = append(rendered, names.Replace(strings.Replace(statement, placeholder, mysqlConn.qualified(table), -1)))
+		}
+	}
+	return rendered, nil
+}
+
+// Migrates schema up or down to version, 0 reverts every migration
+// Returns steps in order of execution, nothing is executed if dryRun is set
+// Schema version is recorded after each step, so failed migration is retried by the next Migrate
+func (mysqlConn *MySQLConn) Migrate(version int, dryRun bool) ([]Step, error) {
+	if version < 0 || version > LatestVersion() {
+		return nil, fmt.Errorf("version should be in range [0, %d]: %d", LatestVersion(), version)
+	}
+	current, err := mysqlConn.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	steps := plan(current, version)
+	legacy, err := mysqlConn.legacy(current)
+	if err != nil {
+		return nil, err
+	}
+	if legacy && len(steps) > 0 {
+		// version 1 upgrades legacy ticks to its columns explicitly
+		steps[0].Statements = append(append([]string(nil), steps[0].Statements...), decimalTicks)
+	}
+	for i := range steps {
+		if steps[i].Statements, err = mysqlConn.render(steps[i].Statements); err != nil {
+			return nil, err
+		}
+	}
+	if dryRun || len(steps) == 0 {
+		return steps, nil
+	}
+	if err = mysqlConn.createSchemaVersion(); err != nil {
+		return nil, err
+	}
+	for i, step := range steps {
+		if err = mysqlConn.apply(step); err != nil {
+			return steps[:i], fmt.Errorf("migration %d (%s): %s", step.Version, step.Name, err)
+		}
+	}
+	return steps, nil
+}
+
+// Creates database and table of schema version
+func (mysqlConn *MySQLConn) createSchemaVersion() error {
+	if _, err := mysqlConn.db.Exec("CREATE DATABASE IF NOT EXISTS `" + mysqlConn.database + "`;"); err != nil {
+		return err
+	}
+	_, err := mysqlConn.db.Exec("CREATE TABLE IF NOT EXISTS " + mysqlConn.qualified("schema_version") + " (" +
+		"`version` integer NOT NULL PRIMARY KEY, `name` VARCHAR(255) NOT NULL, `applied_at` BIGINT NOT NULL);")
+	return err
+}
+
+// Executes statements of step and records schema version
+// MySQL commits DDL implicitly, so statements aren't wrapped into transaction
+func (mysqlConn *MySQLConn) apply(step Step) error {
+	for _, statement := range step.Statements {
+		if _, err := mysqlConn.db.Exec(statement); err != nil && !applied(err) {
+			return err
+		}
+	}
+	if step.Revert {
+		_, err := mysqlConn.db.Exec("DELETE FROM "+mysqlConn.qualified("schema_version")+" WHERE `version` = ?;", step.Version)
+		return err
+	}
+	_, err := mysqlConn.db.Exec("INSERT INTO "+mysqlConn.qualified("schema_version")+" (`version`, `name`, `applied_at`) VALUES(?, ?, ?);",
+		step.Version, step.Name, time.Now().Unix())
+	return err
+}
+
+// Returns true if err is caused by statement which has been applied already, e.g. index exists
+func applied(err error) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && (mysqlErr.Number == errDupKeyName || mysqlErr.Number == errPartitionMgmtOnNonpartitioned)
+}
+
+// Applies migrations which haven't been applied yet
+// Returns error if schema is newer than migrations known by this version of storage
+func (mysqlConn *MySQLConn) migrateUp() error {
+	current, err := mysqlConn.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > LatestVersion() {
+		return fmt.Errorf("schema version %d is newer than supported %d", current, LatestVersion())
+	}
+	_, err = mysqlConn.Migrate(LatestVersion(), false)
+	return err
+}
@@ -0,0 +1,251 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// Answers schema version queries by version, -1 means there is no schema_version table
+// Other tables exist if they are listed in tables of driver
+func schemaAt(d *fDriver, version *int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.query = func(q string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		switch {
+		case strings.Contains(q, "information_schema.tables") && args[1] == "schema_version":
+			return []string{"exists"}, [][]driver.Value{{*version >= 0}}, nil
+		case strings.Contains(q, "information_schema.tables"):
+			exists := false
+			for _, table := range d.tables {
+				exists = exists || table == args[1]
+			}
+			return []string{"exists"}, [][]driver.Value{{exists}}, nil
+		case strings.Contains(q, "FROM `CryptoFetcher`.`schema_version`"):
+			return []string{"version"}, [][]driver.Value{{int64(*version)}}, nil
+		}
+		return nil, nil, fmt.Errorf("unexpected query: %s", q)
+	}
+}
+
+// Returns recorded statements and forgets them
+func takeExecs(d *fDriver) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	execs := d.execs
+	d.execs = nil
+	return execs
+}
+
+func TestMigrations(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+	assert.Equal(t, len(migrations), LatestVersion())
+}
+
+func TestPlan(t *testing.T) {
+	versions := func(steps []Step) (v []int) {
+		for _, s := range steps {
+			v = append(v, s.Version)
+		}
+		return v
+	}
+	assert.Equal(t, []int{1, 2, 3, 4}, versions(plan(0, 4)))
+	assert.Equal(t, []int{2}, versions(plan(1, 2)))
+	assert.Empty(t, plan(2, 2))
+	assert.Equal(t, []int{4, 3, 2, 1}, versions(plan(4, 0)))
+	assert.Equal(t, migrations[1].Up, plan(1, 2)[0].Statements)
+	down := plan(2, 1)[0]
+	assert.True(t, down.Revert)
+	assert.Equal(t, migrations[1].Down, down.Statements)
+}
+
+func TestMySQLConn_render(t *testing.T) {
+	c, _ := New()
+	assert.NoError(t, c.SetTables("market", Tables{Ticks: "tick"}))
+	assert.NoError(t, c.SetPrecision(Microseconds))
+	d := openFake(t, c)
+	defer c.Close()
+	d.tables = []string{"tick_BTC_USD", "tick_ETH_BTC"}
+
+	statements, err := c.render([]string{
+		"CREATE DATABASE IF NOT EXISTS {{database}};",
+		"DROP INDEX `i` ON {{ticks}};",
+		"DROP TABLE {{trades}};",
+		"DROP TABLE {{candles}};",
+		"ALTER TABLE {{candles}} ADD COLUMN `time` {{time}};",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"CREATE DATABASE IF NOT EXISTS `market`;",
+		"DROP INDEX `i` ON `market`.`tick`;",
+		"DROP INDEX `i` ON `market`.`tick_BTC_USD`;",
+		"DROP INDEX `i` ON `market`.`tick_ETH_BTC`;",
+		"DROP TABLE `market`.`Trades`;",
+		"DROP TABLE `market`.`Candles`;",
+		"ALTER TABLE `market`.`Candles` ADD COLUMN `time` DATETIME(6);",
+	}, statements)
+}
+
+func TestMySQLConn_Migrate(t *testing.T) {
+	t.Run("not opened", func(t *testing.T) {
+		c, _ := New()
+		_, err := c.Migrate(LatestVersion(), true)
+		assert.Error(t, err)
+	})
+
+	t.Run("dry run executes nothing", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		version := -1
+		schemaAt(d, &version)
+
+		steps, err := c.Migrate(LatestVersion(), true)
+		assert.NoError(t, err)
+		assert.Len(t, steps, LatestVersion())
+		assert.Empty(t, takeExecs(d))
+
+		_, err = c.Migrate(LatestVersion()+1, true)
+		assert.Error(t, err)
+		_, err = c.Migrate(-1, true)
+		assert.Error(t, err)
+	})
+
+	t.Run("up and down", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		version := 0
+		schemaAt(d, &version)
+
+		steps, err := c.Migrate(LatestVersion(), false)
+		assert.NoError(t, err)
+		assert.Len(t, steps, LatestVersion())
+		execs := takeExecs(d)
+		assert.Equal(t, "CREATE DATABASE IF NOT EXISTS `CryptoFetcher`;", execs[0])
+		assert.Contains(t, execs[1], "`CryptoFetcher`.`schema_version`")
+		assert.Equal(t, "CREATE DATABASE IF NOT EXISTS `CryptoFetcher`;", execs[2])
+		assert.True(t, strings.HasPrefix(execs[3], "CREATE TABLE IF NOT EXISTS `CryptoFetcher`.`Ticks`"))
+		assert.Contains(t, execs, "CREATE INDEX `symbol_timestamp` ON `CryptoFetcher`.`Ticks` (`symbol`, `timestamp`);")
+		assert.Contains(t, execs, "ALTER TABLE `CryptoFetcher`.`Trades` DROP PRIMARY KEY, ADD PRIMARY KEY (`id`, `timestamp`);")
+		assert.Contains(t, execs, "ALTER TABLE `CryptoFetcher`.`Ticks` ADD COLUMN `time` BIGINT NULL, ADD COLUMN `received` BIGINT NULL;")
+		assert.True(t, strings.HasPrefix(execs[len(execs)-1], "INSERT INTO `CryptoFetcher`.`schema_version`"))
+
+		version = LatestVersion()
+		steps, err = c.Migrate(LatestVersion(), false)
+		assert.NoError(t, err)
+		assert.Empty(t, steps)
+		assert.Empty(t, takeExecs(d))
+
+		steps, err = c.Migrate(1, false)
+		assert.NoError(t, err)
+		assert.Len(t, steps, LatestVersion()-1)
+		execs = takeExecs(d)
+		assert.Contains(t, execs, "ALTER TABLE `CryptoFetcher`.`Ticks` DROP COLUMN `time`, DROP COLUMN `received`;")
+		assert.Contains(t, execs, "ALTER TABLE `CryptoFetcher`.`Ticks` REMOVE PARTITIONING;")
+		assert.Contains(t, execs, "DROP INDEX `symbol_timestamp` ON `CryptoFetcher`.`Ticks`;")
+		assert.True(t, strings.HasPrefix(execs[len(execs)-1], "DELETE FROM `CryptoFetcher`.`schema_version`"))
+	})
+
+	t.Run("baseline schema gets decimal bid and ask", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		version := -1
+		schemaAt(d, &version)
+		d.tables = []string{"Ticks"}
+
+		steps, err := c.Migrate(LatestVersion(), false)
+		assert.NoError(t, err)
+		assert.Len(t, steps, LatestVersion())
+		execs := takeExecs(d)
+		assert.Contains(t, execs, "ALTER TABLE `CryptoFetcher`.`Ticks` MODIFY `bid` DECIMAL(36, 18) NOT NULL, MODIFY `ask` DECIMAL(36, 18) NOT NULL;")
+
+		version = 6
+		steps, err = c.Migrate(LatestVersion(), false)
+		assert.NoError(t, err)
+		assert.Len(t, steps, 1)
+		assert.Equal(t, []string{"ALTER TABLE `CryptoFetcher`.`Ticks` MODIFY `bid` DECIMAL(36, 18) NOT NULL, MODIFY `ask` DECIMAL(36, 18) NOT NULL;"}, steps[0].Statements)
+	})
+
+	t.Run("legacy schema is upgraded by the first migration", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		version := -1
+		schemaAt(d, &version)
+		decimal := "ALTER TABLE `CryptoFetcher`.`Ticks` MODIFY `bid` DECIMAL(36, 18) NOT NULL, MODIFY `ask` DECIMAL(36, 18) NOT NULL;"
+
+		steps, err := c.Migrate(1, true)
+		assert.NoError(t, err)
+		assert.NotContains(t, steps[0].Statements, decimal)
+
+		d.tables = []string{"Ticks"}
+		steps, err = c.Migrate(1, false)
+		assert.NoError(t, err)
+		assert.Len(t, steps, 1)
+		assert.Equal(t, decimal, steps[0].Statements[len(steps[0].Statements)-1])
+		assert.Contains(t, takeExecs(d), decimal)
+		assert.Len(t, migrations[0].Up, 4)
+
+		version = 1
+		steps, err = c.Migrate(2, true)
+		assert.NoError(t, err)
+		assert.NotContains(t, steps[0].Statements, decimal)
+	})
+
+	t.Run("existing index is kept", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		version := 1
+		schemaAt(d, &version)
+		d.execErr = func(query string) error {
+			if strings.HasPrefix(query, "CREATE INDEX") {
+				return &mysql.MySQLError{Number: errDupKeyName, Message: "Duplicate key name 'symbol_timestamp'"}
+			}
+			return nil
+		}
+
+		steps, err := c.Migrate(2, false)
+		assert.NoError(t, err)
+		assert.Len(t, steps, 1)
+	})
+
+	t.Run("failed migration isn't recorded", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		version := 0
+		schemaAt(d, &version)
+		d.execErr = func(query string) error {
+			if strings.HasPrefix(query, "CREATE INDEX") {
+				return fmt.Errorf("lock wait timeout exceeded")
+			}
+			return nil
+		}
+
+		steps, err := c.Migrate(2, false)
+		assert.EqualError(t, err, "migration 2 (index ticks by symbol and timestamp): lock wait timeout exceeded")
+		assert.Len(t, steps, 1)
+		execs := takeExecs(d)
+		assert.True(t, strings.HasPrefix(execs[len(execs)-1], "INSERT INTO `CryptoFetcher`.`schema_version`"))
+	})
+
+	t.Run("schema newer than storage", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		version := LatestVersion() + 1
+		schemaAt(d, &version)
+		assert.Error(t, c.migrateUp())
+	})
+}
@@ -0,0 +1,185 @@
+package mysql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default range of partition by timestamp
+const DefaultPartition = 24 * time.Hour
+
+// Partitions which are created ahead of the current one
+const partitionsAhead = 2
+
+// Period of partitions maintenance
+const partitionCheck = time.Hour
+
+// Name of the last partition, it keeps rows beyond created partitions
+const maxPartition = "pmax"
+
+// Name of the first partition, it keeps rows which had been written before table was partitioned
+// It's dropped by retention as any other partition, once rows newer than them are out of retention
+const minPartition = "pmin"
+
+// partition is a partition of table by RANGE of timestamp
+type partition struct {
+	name string
+	// VALUES LESS THAN, unused by maxPartition
+	bound int64
+}
+
+// Sets retention of ticks and trades and range of their partitions, zero retention turns partitioning off
+// Tables are partitioned by RANGE of timestamp, partitions are created ahead and dropped once they are older than retention
+// Zero period is DefaultPartition. Must be invoked before Open
+func (mysqlConn *MySQLConn) SetRetention(retention time.Duration, period time.Duration) error {
+	if retention < 0 {
+		return fmt.Errorf("retention should not be negative: %s", retention)
+	}
+	if period == 0 {
+		period = DefaultPartition
+	}
+	if period < time.Hour || period%time.Hour != 0 {
+		return fmt.Errorf("partition should be a whole number of hours: %s", period)
+	}
+	if retention > 0 && retention < period {
+		return fmt.Errorf("retention %s should not be less than partition %s", retention, period)
+	}
+	mysqlConn.retention = retention
+	mysqlConn.partitionPeriod = period
+	return nil
+}
+
+// Returns name of partition starting at Unix time
+func partitionName(start int64) string {
+	return "p" + time.Unix(start, 0).UTC().Format("2006010215")
+}
+
+// Returns definitions of partitions in range [from, until) of period seconds
+func partitionDefs(from int64, until int64, period int64) []string {
+	var defs []string
+	for start := from; start < until; start += period {
+		defs = append(defs, fmt.Sprintf("PARTITION %s VALUES LESS THAN (%d)", partitionName(start), start+period))
+	}
+	return defs
+}
+
+// Returns statements which partition table if it has no partitions, add partitions ahead of now
+// and drop partitions older than retention. parts are existing partitions in order of bounds
+func partitionPlan(table string, parts []partition, now time.Time, period time.Duration, retention time.Duration) []string {
+	p := int64(period / time.Second)
+	current := now.Unix() / p * p
+	until := current + p*(partitionsAhead+1)
+	maxDef := fmt.Sprintf("PARTITION %s VALUES LESS THAN MAXVALUE", maxPartition)
+	if len(parts) == 0 {
+		// rows older than current partition are kept apart, so they aren't dropped along with the current one
+		minDef := fmt.Sprintf("PARTITION %s VALUES LESS THAN (%d)", minPartition, current)
+		defs := append(append([]string{minDef}, partitionDefs(current, until, p)...), maxDef)
+		return []string{fmt.Sprintf("ALTER TABLE %s PARTITION BY RANGE (`timestamp`) (%s);", table, strings.Join(defs, ", "))}
+	}
+
+	var statements, expired []string
+	// partitions are added after the last one, the first added covers gap up to current partition
+	start, hasMax := current, false
+	cutoff := now.Add(-retention).Unix()
+	for _, part := range parts {
+		if part.name == maxPartition {
+			hasMax = true
+			continue
+		}
+		if part.bound > start {
+			start = part.bound
+		}
+		if part.bound <= cutoff {
+			expired = append(expired, part.name)
+		}
+	}
+	if defs := partitionDefs(start, until, p); len(defs) > 0 {
+		if hasMax {
+			defs = append(defs, maxDef)
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s REORGANIZE PARTITION %s INTO (%s);", table, maxPartition, strings.Join(defs, ", ")))
+		} else {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD PARTITION (%s);", table, strings.Join(defs, ", ")))
+		}
+	}
+	if len(expired) > 0 {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP PARTITION %s;", table, strings.Join(expired, ", ")))
+	}
+	return statements
+}
+
+// Returns partitions of table in order of bounds, empty if table isn't partitioned
+func (mysqlConn *MySQLConn) partitions(table string) ([]partition, error) {
+	rows, err := mysqlConn.db.Query("SELECT partition_name, partition_description FROM information_schema.partitions "+
+		"WHERE table_schema = ? AND table_name = ? AND partition_name IS NOT NULL ORDER BY partition_ordinal_position;",
+		mysqlConn.database, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var parts []partition
+	for rows.Next() {
+		var part partition
+		var description string
+		if err = rows.Scan(&part.name, &description); err != nil {
+			return nil, err
+		}
+		if part.name != maxPartition {
+			if part.bound, err = strconv.ParseInt(description, 10, 64); err != nil {
+				return nil, fmt.Errorf("bad bound of partition %s of %s: %s", part.name, table, description)
+			}
+		}
+		parts = append(parts, part)
+	}
+	return parts, rows.Err()
+}
+
+// Partitions table, creates partitions ahead of now and drops ones older than retention
+func (mysqlConn *MySQLConn) partition(table string) error {
+	parts, err := mysqlConn.partitions(table)
+	if err != nil {
+		return err
+	}
+	for _, statement := range partitionPlan(mysqlConn.qualified(table), parts, time.Now(), mysqlConn.partitionPeriod, mysqlConn.retention) {
+		if _, err = mysqlConn.db.Exec(statement); err != nil {
+			return fmt.Errorf("partitions of %s: %s", table, err)
+		}
+	}
+	return nil
+}
+
+// Maintains partitions of ticks and trades tables including ones of exchanges and pairs
+func (mysqlConn *MySQLConn) partitionAll() error {
+	for _, base := range []string{mysqlConn.tables.Ticks, mysqlConn.tables.Trades} {
+		tables, err := mysqlConn.tablesOf(base)
+		if err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if err = mysqlConn.partition(table); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Maintains partitions in background until Close, error is returned by the next WriteTick
+func (mysqlConn *MySQLConn) maintainPartitions() {
+	defer mysqlConn.writer.Done()
+	ticker := time.NewTicker(partitionCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mysqlConn.done:
+			return
+		case <-ticker.C:
+			if err := mysqlConn.partitionAll(); err != nil {
+				mysqlConn.mu.Lock()
+				mysqlConn.err = err
+				mysqlConn.mu.Unlock()
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package mysql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMySQLConn_SetRetention(t *testing.T) {
+	c, _ := New()
+	assert.Error(t, c.SetRetention(-time.Hour, 0))
+	assert.Error(t, c.SetRetention(time.Hour, 30*time.Minute))
+	assert.Error(t, c.SetRetention(time.Hour, 90*time.Minute))
+	assert.Error(t, c.SetRetention(time.Hour, 2*time.Hour))
+	assert.NoError(t, c.SetRetention(0, 0))
+	assert.NoError(t, c.SetRetention(720*time.Hour, 0))
+	assert.Equal(t, DefaultPartition, c.partitionPeriod)
+}
+
+func TestPartitionPlan(t *testing.T) {
+	day := 24 * time.Hour
+	now := time.Date(2021, 3, 10, 15, 30, 0, 0, time.UTC)
+	bound := func(y int, m time.Month, d int) int64 {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix()
+	}
+
+	t.Run("table isn't partitioned", func(t *testing.T) {
+		statements := partitionPlan("`db`.`Ticks`", nil, now, day, 7*day)
+		assert.Equal(t, []string{"ALTER TABLE `db`.`Ticks` PARTITION BY RANGE (`timestamp`) (" +
+			"PARTITION pmin VALUES LESS THAN (1615334400), " +
+			"PARTITION p2021031000 VALUES LESS THAN (1615420800), " +
+			"PARTITION p2021031100 VALUES LESS THAN (1615507200), " +
+			"PARTITION p2021031200 VALUES LESS THAN (1615593600), " +
+			"PARTITION pmax VALUES LESS THAN MAXVALUE);"}, statements)
+		assert.Equal(t, bound(2021, 3, 11), int64(1615420800))
+	})
+
+	t.Run("rows written before partitioning are dropped by their own retention", func(t *testing.T) {
+		parts := []partition{
+			{name: minPartition, bound: bound(2021, 3, 10)},
+			{name: "p2021031000", bound: bound(2021, 3, 11)},
+			{name: "p2021031100", bound: bound(2021, 3, 12)},
+			{name: "p2021031200", bound: bound(2021, 3, 13)},
+			{name: maxPartition},
+		}
+		// pmin is dropped once its bound is out of retention, partition of 10 March is kept
+		assert.Equal(t, []string{
+			"ALTER TABLE `db`.`Ticks` REORGANIZE PARTITION pmax INTO (" +
+				"PARTITION p2021031300 VALUES LESS THAN (1615680000), " +
+				"PARTITION p2021031400 VALUES LESS THAN (1615766400), " +
+				"PARTITION p2021031500 VALUES LESS THAN (1615852800), " +
+				"PARTITION pmax VALUES LESS THAN MAXVALUE);",
+			"ALTER TABLE `db`.`Ticks` DROP PARTITION pmin;",
+		}, partitionPlan("`db`.`Ticks`", parts, now.Add(3*day), day, 3*day))
+	})
+
+	t.Run("partitions are up to date", func(t *testing.T) {
+		parts := []partition{
+			{name: "p2021030900", bound: bound(2021, 3, 10)},
+			{name: "p2021031000", bound: bound(2021, 3, 11)},
+			{name: "p2021031100", bound: bound(2021, 3, 12)},
+			{name: "p2021031200", bound: bound(2021, 3, 13)},
+			{name: maxPartition},
+		}
+		assert.Empty(t, partitionPlan("`db`.`Ticks`", parts, now, day, 7*day))
+	})
+
+	t.Run("partitions are added ahead and dropped by retention", func(t *testing.T) {
+		parts := []partition{
+			{name: "p2021030100", bound: bound(2021, 3, 2)},
+			{name: "p2021030200", bound: bound(2021, 3, 3)},
+			{name: "p2021030300", bound: bound(2021, 3, 4)},
+			{name: "p2021031000", bound: bound(2021, 3, 11)},
+			{name: maxPartition},
+		}
+		assert.Equal(t, []string{
+			"ALTER TABLE `db`.`Ticks` REORGANIZE PARTITION pmax INTO (" +
+				"PARTITION p2021031100 VALUES LESS THAN (1615507200), " +
+				"PARTITION p2021031200 VALUES LESS THAN (1615593600), " +
+				"PARTITION pmax VALUES LESS THAN MAXVALUE);",
+			"ALTER TABLE `db`.`Ticks` DROP PARTITION p2021030100, p2021030200;",
+		}, partitionPlan("`db`.`Ticks`", parts, now, day, 7*day))
+	})
+
+	t.Run("gap up to current partition", func(t *testing.T) {
+		parts := []partition{{name: "p2021030100", bound: bound(2021, 3, 2)}}
+		assert.Equal(t, []string{
+			"ALTER TABLE `db`.`Ticks` ADD PARTITION (" +
+				"PARTITION p2021031000 VALUES LESS THAN (1615420800), " +
+				"PARTITION p2021031100 VALUES LESS THAN (1615507200), " +
+				"PARTITION p2021031200 VALUES LESS THAN (1615593600));",
+			"ALTER TABLE `db`.`Ticks` DROP PARTITION p2021030100;",
+		}, partitionPlan("`db`.`Ticks`", parts, now, day, 7*day))
+	})
+}
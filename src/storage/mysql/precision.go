@@ -0,0 +1,122 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Precision describes how exchange and receive times of ticks and time of trades are stored
+// Ticks and trades keep time in seconds as well, it's used by indexes, partitions and aggregates
+type Precision int
+
+const (
+	// Nanoseconds stores Unix time in nanoseconds as BIGINT
+	Nanoseconds Precision = iota + 1
+	// Microseconds stores time in UTC as DATETIME(6)
+	Microseconds
+)
+
+// Names of precisions, used by precision parameter of DSN
+var precisionNames = map[Precision]string{
+	Nanoseconds:  "ns",
+	Microseconds: "us",
+}
+
+// Format of DATETIME(6) values
+const datetimeFormat = "2006-01-02 15:04:05.999999"
+
+// Returns name of Precision
+func (p Precision) String() string {
+	if name, ok := precisionNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(p))
+}
+
+// Returns Precision by name, case insensitive
+func ParsePrecision(name string) (Precision, error) {
+	for p, n := range precisionNames {
+		if strings.EqualFold(n, name) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("precision not found: %s", name)
+}
+
+// Returns type of time columns
+func (p Precision) columnType() string {
+	if p == Microseconds {
+		return "DATETIME(6)"
+	}
+	return "BIGINT"
+}
+
+// Sets Precision of time columns, it's applied once the columns are created by migration
+// Open returns error if precision doesn't match existing columns. Must be invoked before Open
+func (mysqlConn *MySQLConn) SetPrecision(precision Precision) error {
+	if _, ok := precisionNames[precision]; !ok {
+		return fmt.Errorf("precision is not supported: %s", precision)
+	}
+	mysqlConn.precision = precision
+	return nil
+}
+
+// Returns Unix time in nanoseconds, 0 for zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// Returns value of time column by Precision, NULL for 0
+func (mysqlConn *MySQLConn) timeValue(nanos int64) interface{} {
+	switch {
+	case nanos == 0:
+		return nil
+	case mysqlConn.precision == Microseconds:
+		return time.Unix(0, nanos).UTC()
+	}
+	return nanos
+}
+
+// Returns time of scanned time column, zero time for NULL
+// Value is BIGINT or DATETIME(6), which is time.Time if DSN has parseTime=true
+func scanTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case int64:
+		return time.Unix(0, t).UTC(), nil
+	case time.Time:
+		return t.UTC(), nil
+	case []byte:
+		if nanos, err := strconv.ParseInt(string(t), 10, 64); err == nil {
+			return time.Unix(0, nanos).UTC(), nil
+		}
+		return time.ParseInLocation(datetimeFormat, string(t), time.UTC)
+	}
+	return time.Time{}, fmt.Errorf("unable to scan %T into time", v)
+}
+
+// Returns error if time column of ticks or trades has type of another Precision
+func (mysqlConn *MySQLConn) checkPrecision() error {
+	for _, table := range []string{mysqlConn.tables.Ticks, mysqlConn.tables.Trades} {
+		var dataType string
+		err := mysqlConn.db.QueryRow("SELECT data_type FROM information_schema.columns "+
+			"WHERE table_schema = ? AND table_name = ? AND column_name = ?;", mysqlConn.database, table, "time").Scan(&dataType)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(strings.ToUpper(mysqlConn.precision.columnType()), strings.ToUpper(dataType)) {
+			return fmt.Errorf("precision %s doesn't match type %s of time column of %s", mysqlConn.precision, dataType, table)
+		}
+	}
+	return nil
+}
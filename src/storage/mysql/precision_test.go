@@ -0,0 +1,145 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMySQLConn_SetPrecision(t *testing.T) {
+	c, _ := New()
+	assert.Equal(t, Nanoseconds, c.precision)
+	assert.Error(t, c.SetPrecision(Precision(42)))
+	_, err := ParsePrecision("ms")
+	assert.Error(t, err)
+	precision, err := ParsePrecision("US")
+	assert.NoError(t, err)
+	assert.NoError(t, c.SetPrecision(precision))
+	assert.Equal(t, Microseconds, c.precision)
+	assert.Equal(t, "us", c.precision.String())
+}
+
+func TestScanTime(t *testing.T) {
+	want := time.Unix(1615334400, 123456000).UTC()
+	cases := []struct {
+		v    interface{}
+		want time.Time
+	}{
+		{nil, time.Time{}},
+		{want.UnixNano(), want},
+		{[]byte("1615334400123456000"), want},
+		{[]byte("2021-03-10 00:00:00.123456"), want},
+		{want.In(time.FixedZone("UTC+3", 3*60*60)), want},
+	}
+	for _, testCase := range cases {
+		got, err := scanTime(testCase.v)
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.want, got, "%v", testCase.v)
+	}
+	_, err := scanTime([]byte("yesterday"))
+	assert.Error(t, err)
+	_, err = scanTime(1.5)
+	assert.Error(t, err)
+}
+
+func TestMySQLConn_precision(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	at := time.Unix(100, 123456789).UTC()
+	received := at.Add(250 * time.Millisecond)
+	tick := crypto.Tick{T: at, P: btc_usd, Bid: crypto.MustDecimal("1.5"), Ask: crypto.MustDecimal("2"), Received: received}
+
+	t.Run("nanoseconds are written as BIGINT", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		assert.NoError(t, c.WriteTick(tick))
+		assert.NoError(t, c.WriteTick(tickAt(5)))
+		assert.NoError(t, c.Flush())
+		_, rows := d.written()
+		assert.Equal(t, []driver.Value{int64(100), at.UnixNano(), received.UnixNano(), "BTC-USD", "1.5", "2", nil, nil, nil, nil, nil, nil, nil, nil, nil}, rows[0])
+		// unknown receive time is NULL
+		assert.Equal(t, []driver.Value{int64(5), int64(5000000000), nil, "BTC-USD", "1.5", "2", nil, nil, nil, nil, nil, nil, nil, nil, nil}, rows[1])
+	})
+
+	t.Run("microseconds are written as DATETIME", func(t *testing.T) {
+		c, _ := New()
+		assert.NoError(t, c.SetPrecision(Microseconds))
+		d := openFake(t, c)
+		defer c.Close()
+		assert.NoError(t, c.WriteTick(tick))
+		assert.NoError(t, c.Flush())
+		_, rows := d.written()
+		assert.Equal(t, []driver.Value{int64(100), at, received, "BTC-USD", "1.5", "2", nil, nil, nil, nil, nil, nil, nil, nil, nil}, rows[0])
+	})
+
+	t.Run("time of trade is written by precision", func(t *testing.T) {
+		trade := crypto.Trade{T: at, P: btc_usd, Id: "1", Price: crypto.MustDecimal("1.5"), Size: crypto.MustDecimal("2"), Side: crypto.Bid}
+		for precision, want := range map[Precision]driver.Value{Nanoseconds: at.UnixNano(), Microseconds: at} {
+			c, _ := New()
+			assert.NoError(t, c.SetPrecision(precision))
+			d := openFake(t, c)
+			assert.NoError(t, c.WriteTrade(trade))
+			assert.Equal(t, []driver.Value{int64(100), want}, d.execArgs[0][:2])
+			assert.NoError(t, c.Close())
+		}
+	})
+
+	t.Run("candle is kept in seconds", func(t *testing.T) {
+		c, _ := New()
+		openFake(t, c)
+		defer c.Close()
+		assert.NoError(t, c.WriteCandle(crypto.Candle{T: time.Unix(60, 0), P: btc_usd, Interval: time.Minute}))
+		assert.Error(t, c.WriteCandle(crypto.Candle{T: at, P: btc_usd, Interval: time.Minute}))
+		assert.Error(t, c.WriteCandle(crypto.Candle{T: time.Unix(60, 0), P: btc_usd, Interval: 1500 * time.Millisecond}))
+	})
+
+	t.Run("reads precise times", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		var queries [][]driver.Value
+		answer(d, &queries, func(q string) ([]string, [][]driver.Value, error) {
+			return []string{"timestamp", "time", "received", "bid", "ask"}, [][]driver.Value{
+				{int64(100), at.UnixNano(), []byte("1970-01-01 00:01:40.373456"), []byte("1.5"), []byte("2")},
+			}, nil
+		})
+		got, err := c.LatestTick(btc_usd)
+		assert.NoError(t, err)
+		assert.Equal(t, at, got.T)
+		assert.Equal(t, time.Unix(100, 373456000).UTC(), got.Received)
+
+		it, err := c.Ticks(context.Background(), btc_usd, time.Unix(0, 0), time.Unix(200, 0))
+		assert.NoError(t, err)
+		assert.True(t, it.Next())
+		assert.Equal(t, at, it.Tick().T)
+		assert.NoError(t, it.Close())
+	})
+
+	t.Run("precision is checked against existing columns", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		var types [][]driver.Value
+		var queries [][]driver.Value
+		answer(d, &queries, func(q string) ([]string, [][]driver.Value, error) {
+			if !strings.Contains(q, "information_schema.columns") {
+				t.Errorf("unexpected query: %s", q)
+			}
+			return []string{"data_type"}, types, nil
+		})
+		// columns are not created by migration yet
+		assert.NoError(t, c.checkPrecision())
+		assert.Equal(t, []driver.Value{"CryptoFetcher", "Ticks", "time"}, queries[0])
+		assert.Equal(t, []driver.Value{"CryptoFetcher", "Trades", "time"}, queries[1])
+		types = [][]driver.Value{{[]byte("bigint")}}
+		assert.NoError(t, c.checkPrecision())
+		assert.NoError(t, c.SetPrecision(Microseconds))
+		assert.Error(t, c.checkPrecision())
+		types = [][]driver.Value{{[]byte("datetime")}}
+		assert.NoError(t, c.checkPrecision())
+	})
+}
@@ -0,0 +1,254 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/storage"
+	"math"
+	"strings"
+	"time"
+)
+
+// tickIterator is storage.TickIterator over rows of Ticks
+type tickIterator struct {
+	rows *sql.Rows
+	pair crypto.Pair
+	tick crypto.Tick
+	err  error
+}
+
+// Scans the next row, iteration stops on the first error
+func (it *tickIterator) Next() bool {
+	if it.err != nil || !it.rows.Next() {
+		return false
+	}
+	tick := crypto.Tick{P: it.pair}
+	if it.err = scanTick(it.rows, &tick); it.err != nil {
+		_ = it.rows.Close()
+		return false
+	}
+	it.tick = tick
+	return true
+}
+
+// Scans timestamp, time, received, bid and ask of row into tick
+// Time in seconds is used for ticks written before precise time has been stored
+func scanTick(row interface{ Scan(...interface{}) error }, tick *crypto.Tick) error {
+	var ts int64
+	var t, received interface{}
+	if err := row.Scan(&ts, &t, &received, &tick.Bid, &tick.Ask); err != nil {
+		return err
+	}
+	var err error
+	if tick.T, err = scanTime(t); err != nil {
+		return err
+	}
+	if tick.T.IsZero() {
+		tick.T = time.Unix(ts, 0).UTC()
+	}
+	tick.Received, err = scanTime(received)
+	return err
+}
+
+func (it *tickIterator) Tick() crypto.Tick {
+	return it.tick
+}
+
+func (it *tickIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.rows.Err()
+}
+
+func (it *tickIterator) Close() error {
+	return it.rows.Close()
+}
+
+// Writes queued ticks, so reads see every tick written before. Returns error if storage isn't opened
+func (mysqlConn *MySQLConn) beforeRead() error {
+	mysqlConn.mu.Lock()
+	opened := mysqlConn.db != nil
+	mysqlConn.mu.Unlock()
+	if !opened {
+		return fmt.Errorf("storage isn't opened")
+	}
+	return mysqlConn.Flush()
+}
+
+// Returns tables which may keep ticks of pair by Layout
+func (mysqlConn *MySQLConn) readTables(pair crypto.Pair) ([]string, error) {
+	base := mysqlConn.tables.Ticks
+	if mysqlConn.layout == Single {
+		return []string{base}, nil
+	}
+	tables, err := mysqlConn.tablesOf(base)
+	if err != nil || mysqlConn.layout != PerPair {
+		return tables, err
+	}
+	// ticks written before layout has been changed are kept by base table
+	read := []string{base}
+	for _, table := range tables[1:] {
+		if table == derived(base, pair.String('_')) {
+			read = append(read, table)
+		}
+	}
+	return read, nil
+}
+
+// Returns UNION ALL of query repeated for tables, %s of query is replaced by table. args are repeated as well
+func (mysqlConn *MySQLConn) union(tables []string, query string, args ...interface{}) (string, []interface{}) {
+	parts := make([]string, len(tables))
+	var unionArgs []interface{}
+	for i, table := range tables {
+		parts[i] = "(" + fmt.Sprintf(query, mysqlConn.qualified(table)) + ")"
+		unionArgs = append(unionArgs, args...)
+	}
+	return strings.Join(parts, " UNION ALL "), unionArgs
+}
+
+// Condition of ticks of pair in time range, timestamp in seconds narrows rows by index and partitions
+// Range is compared with precise time, ticks written before precise time has been stored are compared by timestamp
+const rangeCondition = "`symbol` = ? AND `timestamp` >= ? AND `timestamp` <= ? AND " +
+	"(`time` >= ? AND `time` < ? OR `time` IS NULL AND `timestamp` >= ? AND `timestamp` < ?)"
+
+// Returns args of rangeCondition for pair ticks in range [from, to)
+func (mysqlConn *MySQLConn) rangeArgs(pair crypto.Pair, from time.Time, to time.Time) []interface{} {
+	return []interface{}{pair.String('-'), from.Unix(), to.Unix(),
+		mysqlConn.timeBound(from), mysqlConn.timeBound(to), ceilUnix(from), ceilUnix(to)}
+}
+
+// Returns value of time column by Precision compared with bound of range
+// DATETIME(6) keeps microseconds, nanoseconds out of BIGINT range are clamped
+func (mysqlConn *MySQLConn) timeBound(t time.Time) interface{} {
+	if mysqlConn.precision == Microseconds {
+		return t.UTC().Truncate(time.Microsecond)
+	}
+	switch {
+	case t.Before(time.Unix(0, math.MinInt64)):
+		return int64(math.MinInt64)
+	case t.After(time.Unix(0, math.MaxInt64)):
+		return int64(math.MaxInt64)
+	}
+	return t.UnixNano()
+}
+
+// Returns Unix time in seconds rounded up
+func ceilUnix(t time.Time) int64 {
+	if t.Nanosecond() > 0 {
+		return t.Unix() + 1
+	}
+	return t.Unix()
+}
+
+// Returns iterator of pair ticks in range [from, to), queued ticks are written before
+func (mysqlConn *MySQLConn) Ticks(ctx context.Context, pair crypto.Pair, from time.Time, to time.Time) (storage.TickIterator, error) {
+	if err := mysqlConn.beforeRead(); err != nil {
+		return nil, err
+	}
+	tables, err := mysqlConn.readTables(pair)
+	if err != nil {
+		return nil, err
+	}
+	union, args := mysqlConn.union(tables, "SELECT `id`, `timestamp`, `time`, `received`, `bid`, `ask` FROM %s WHERE "+rangeCondition,
+		mysqlConn.rangeArgs(pair, from, to)...)
+	rows, err := mysqlConn.db.QueryContext(ctx, "SELECT `timestamp`, `time`, `received`, `bid`, `ask` FROM ("+union+") AS `t` ORDER BY `timestamp`, `time`, `id`;", args...)
+	if err != nil {
+		return nil, err
+	}
+	return &tickIterator{rows: rows, pair: pair}, nil
+}
+
+// Returns the last stored tick of pair, zero Tick if there is no ticks
+func (mysqlConn *MySQLConn) LatestTick(pair crypto.Pair) (crypto.Tick, error) {
+	if err := mysqlConn.beforeRead(); err != nil {
+		return crypto.Tick{}, err
+	}
+	tables, err := mysqlConn.readTables(pair)
+	if err != nil {
+		return crypto.Tick{}, err
+	}
+	union, args := mysqlConn.union(tables, "SELECT `id`, `timestamp`, `time`, `received`, `bid`, `ask` FROM %s WHERE `symbol` = ? ORDER BY `timestamp` DESC, `time` DESC, `id` DESC LIMIT 1",
+		pair.String('-'))
+	tick := crypto.Tick{P: pair}
+	err = scanTick(mysqlConn.db.QueryRow("SELECT `timestamp`, `time`, `received`, `bid`, `ask` FROM ("+union+") AS `t` "+
+		"ORDER BY `timestamp` DESC, `time` DESC, `id` DESC LIMIT 1;", args...), &tick)
+	if err == sql.ErrNoRows {
+		return crypto.Tick{}, nil
+	}
+	if err != nil {
+		return crypto.Tick{}, err
+	}
+	return tick, nil
+}
+
+// Returns sorted pairs which have stored ticks
+func (mysqlConn *MySQLConn) Pairs() ([]crypto.Pair, error) {
+	if err := mysqlConn.beforeRead(); err != nil {
+		return nil, err
+	}
+	tables := []string{mysqlConn.tables.Ticks}
+	if mysqlConn.layout != Single {
+		var err error
+		if tables, err = mysqlConn.tablesOf(mysqlConn.tables.Ticks); err != nil {
+			return nil, err
+		}
+	}
+	union, _ := mysqlConn.union(tables, "SELECT DISTINCT `symbol` FROM %s")
+	rows, err := mysqlConn.db.Query("SELECT DISTINCT `symbol` FROM (" + union + ") AS `t` ORDER BY `symbol`;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pairs []crypto.Pair
+	for rows.Next() {
+		var symbol string
+		if err = rows.Scan(&symbol); err != nil {
+			return nil, err
+		}
+		pair, err := crypto.ParsePair(symbol, '-')
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair)
+	}
+	return pairs, rows.Err()
+}
+
+// Returns min, max and avg bid and ask of pair ticks in range [from, to) grouped by interval
+// Interval should be a whole number of seconds, as timestamps are stored in seconds
+func (mysqlConn *MySQLConn) Aggregate(ctx context.Context, pair crypto.Pair, from time.Time, to time.Time, interval time.Duration) ([]storage.Bucket, error) {
+	if interval < time.Second || interval%time.Second != 0 {
+		return nil, fmt.Errorf("interval should be a whole number of seconds: %s", interval)
+	}
+	if err := mysqlConn.beforeRead(); err != nil {
+		return nil, err
+	}
+	tables, err := mysqlConn.readTables(pair)
+	if err != nil {
+		return nil, err
+	}
+	seconds := int64(interval / time.Second)
+	union, args := mysqlConn.union(tables, "SELECT `timestamp`, `bid`, `ask` FROM %s WHERE "+rangeCondition,
+		mysqlConn.rangeArgs(pair, from, to)...)
+	rows, err := mysqlConn.db.QueryContext(ctx, "SELECT `timestamp` DIV ? * ? AS `bucket`, COUNT(*), "+
+		"MIN(`bid`), MAX(`bid`), AVG(`bid`), MIN(`ask`), MAX(`ask`), AVG(`ask`) FROM ("+union+") AS `t` "+
+		"GROUP BY `bucket` ORDER BY `bucket`;", append([]interface{}{seconds, seconds}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var buckets []storage.Bucket
+	for rows.Next() {
+		var ts int64
+		b := storage.Bucket{Interval: interval}
+		if err = rows.Scan(&ts, &b.Count, &b.MinBid, &b.MaxBid, &b.AvgBid, &b.MinAsk, &b.MaxAsk, &b.AvgAsk); err != nil {
+			return nil, err
+		}
+		b.T = time.Unix(ts, 0).UTC()
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
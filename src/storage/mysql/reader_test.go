@@ -0,0 +1,202 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/storage"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Answers queries of reader by query, records them in queries
+func answer(d *fDriver, queries *[][]driver.Value, query func(query string) ([]string, [][]driver.Value, error)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.query = func(q string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		*queries = append(*queries, args)
+		return query(q)
+	}
+}
+
+func TestMySQLConn_Reader(t *testing.T) {
+	var _ storage.Reader = &MySQLConn{}
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	from, to := time.Unix(100, 0), time.Unix(200, 0)
+
+	t.Run("not opened", func(t *testing.T) {
+		c, _ := New()
+		_, err := c.Ticks(context.Background(), btc_usd, from, to)
+		assert.Error(t, err)
+		_, err = c.LatestTick(btc_usd)
+		assert.Error(t, err)
+		_, err = c.Pairs()
+		assert.Error(t, err)
+		_, err = c.Aggregate(context.Background(), btc_usd, from, to, time.Minute)
+		assert.Error(t, err)
+	})
+
+	t.Run("Ticks flushes queue and iterates", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		var queries [][]driver.Value
+		answer(d, &queries, func(q string) ([]string, [][]driver.Value, error) {
+			return []string{"timestamp", "time", "received", "bid", "ask"}, [][]driver.Value{
+				{int64(100), nil, nil, []byte("1.5"), []byte("2")},
+				{int64(150), nil, nil, []byte("1.6"), []byte("2.1")},
+			}, nil
+		})
+
+		assert.NoError(t, c.WriteTick(tickAt(100)))
+		it, err := c.Ticks(context.Background(), btc_usd, from, to)
+		assert.NoError(t, err)
+		inserts, _ := d.written()
+		assert.Equal(t, []int{1}, inserts)
+		assert.Equal(t, []driver.Value{"BTC-USD", int64(100), int64(200), int64(100e9), int64(200e9), int64(100), int64(200)}, queries[0])
+
+		var ticks []crypto.Tick
+		for it.Next() {
+			ticks = append(ticks, it.Tick())
+		}
+		assert.NoError(t, it.Err())
+		assert.NoError(t, it.Close())
+		assert.NoError(t, it.Close())
+		assert.Equal(t, []crypto.Tick{
+			{T: time.Unix(100, 0).UTC(), P: btc_usd, Bid: crypto.MustDecimal("1.5"), Ask: crypto.MustDecimal("2")},
+			{T: time.Unix(150, 0).UTC(), P: btc_usd, Bid: crypto.MustDecimal("1.6"), Ask: crypto.MustDecimal("2.1")},
+		}, ticks)
+	})
+
+	t.Run("Ticks compares sub-second range with precise time", func(t *testing.T) {
+		for _, precision := range []Precision{Nanoseconds, Microseconds} {
+			c, _ := New()
+			assert.NoError(t, c.SetPrecision(precision))
+			d := openFake(t, c)
+			var queries [][]driver.Value
+			answer(d, &queries, func(q string) ([]string, [][]driver.Value, error) {
+				if !strings.Contains(q, "`time` >= ? AND `time` < ? OR `time` IS NULL") {
+					return nil, nil, fmt.Errorf("unexpected query: %s", q)
+				}
+				return []string{"timestamp", "time", "received", "bid", "ask"}, nil, nil
+			})
+
+			from, to := time.Unix(100, 250000500), time.Unix(200, 750000000)
+			_, err := c.Ticks(context.Background(), btc_usd, from, to)
+			assert.NoError(t, err)
+			_, err = c.Aggregate(context.Background(), btc_usd, from, to, time.Minute)
+			assert.NoError(t, err)
+			bounds := []driver.Value{int64(100250000500), int64(200750000000)}
+			if precision == Microseconds {
+				bounds = []driver.Value{time.Unix(100, 250000000).UTC(), time.Unix(200, 750000000).UTC()}
+			}
+			expected := append(append([]driver.Value{"BTC-USD", int64(100), int64(200)}, bounds...), int64(101), int64(201))
+			assert.Equal(t, expected, queries[0], precision)
+			assert.Equal(t, expected, queries[1][2:], precision)
+			assert.NoError(t, c.Close())
+		}
+	})
+
+	t.Run("Ticks stops on bad row", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		var queries [][]driver.Value
+		answer(d, &queries, func(q string) ([]string, [][]driver.Value, error) {
+			return []string{"timestamp", "time", "received", "bid", "ask"}, [][]driver.Value{
+				{int64(100), nil, nil, []byte("1.5"), []byte("2")},
+				{int64(150), nil, nil, []byte("bid"), []byte("2.1")},
+				{int64(160), []byte("1.6"), []byte("2.1")},
+			}, nil
+		})
+
+		it, err := c.Ticks(context.Background(), btc_usd, from, to)
+		assert.NoError(t, err)
+		assert.True(t, it.Next())
+		assert.False(t, it.Next())
+		assert.False(t, it.Next())
+		assert.Error(t, it.Err())
+		assert.NoError(t, it.Close())
+	})
+
+	t.Run("LatestTick", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		var queries [][]driver.Value
+		var rows [][]driver.Value
+		answer(d, &queries, func(q string) ([]string, [][]driver.Value, error) {
+			return []string{"timestamp", "time", "received", "bid", "ask"}, rows, nil
+		})
+
+		tick, err := c.LatestTick(btc_usd)
+		assert.NoError(t, err)
+		assert.True(t, tick.T.IsZero())
+
+		rows = [][]driver.Value{{int64(150), nil, nil, []byte("1.6"), []byte("2.1")}}
+		tick, err = c.LatestTick(btc_usd)
+		assert.NoError(t, err)
+		assert.Equal(t, crypto.Tick{T: time.Unix(150, 0).UTC(), P: btc_usd, Bid: crypto.MustDecimal("1.6"), Ask: crypto.MustDecimal("2.1")}, tick)
+	})
+
+	t.Run("Pairs", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		var queries [][]driver.Value
+		symbols := [][]driver.Value{{[]byte("BTC-USD")}, {[]byte("ETH-BTC")}}
+		answer(d, &queries, func(q string) ([]string, [][]driver.Value, error) {
+			return []string{"symbol"}, symbols, nil
+		})
+
+		pairs, err := c.Pairs()
+		assert.NoError(t, err)
+		eth_btc, _ := crypto.NewPair("eth", "btc")
+		assert.Equal(t, []crypto.Pair{btc_usd, eth_btc}, pairs)
+
+		symbols = [][]driver.Value{{[]byte("BTCUSD")}}
+		_, err = c.Pairs()
+		assert.Error(t, err)
+	})
+
+	t.Run("Aggregate", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		var queries [][]driver.Value
+		answer(d, &queries, func(q string) ([]string, [][]driver.Value, error) {
+			if !strings.Contains(q, "GROUP BY `bucket`") {
+				return nil, nil, fmt.Errorf("unexpected query: %s", q)
+			}
+			return []string{"bucket", "count", "min_bid", "max_bid", "avg_bid", "min_ask", "max_ask", "avg_ask"}, [][]driver.Value{
+				{int64(60), int64(3), []byte("1"), []byte("3"), []byte("2.0000"), []byte("2"), []byte("4"), []byte("3.0000")},
+				{int64(180), int64(1), []byte("5"), []byte("5"), []byte("5.0000"), []byte("6"), []byte("6"), []byte("6.0000")},
+			}, nil
+		})
+
+		_, err := c.Aggregate(context.Background(), btc_usd, from, to, 1500*time.Millisecond)
+		assert.Error(t, err)
+		_, err = c.Aggregate(context.Background(), btc_usd, from, to, 0)
+		assert.Error(t, err)
+
+		buckets, err := c.Aggregate(context.Background(), btc_usd, from, to, time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, []driver.Value{int64(60), int64(60), "BTC-USD", int64(100), int64(200), int64(100e9), int64(200e9), int64(100), int64(200)}, queries[0])
+		assert.Len(t, buckets, 2)
+		assert.Equal(t, storage.Bucket{
+			T:        time.Unix(60, 0).UTC(),
+			Interval: time.Minute,
+			Count:    3,
+			MinBid:   crypto.MustDecimal("1"),
+			MaxBid:   crypto.MustDecimal("3"),
+			AvgBid:   crypto.MustDecimal("2.0000"),
+			MinAsk:   crypto.MustDecimal("2"),
+			MaxAsk:   crypto.MustDecimal("4"),
+			AvgAsk:   crypto.MustDecimal("3.0000"),
+		}, buckets[0])
+		assert.Equal(t, time.Unix(180, 0).UTC(), buckets[1].T)
+	})
+}
@@ -0,0 +1,464 @@
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/storage"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Defaults of asynchronous tick writes
+const (
+	DefaultBatchSize     = 100
+	DefaultBatchInterval = time.Second
+	DefaultQueueCapacity = 10000
+)
+
+// Columns of ticks written by INSERT
+var tickColumns = []string{"timestamp", "time", "received", "symbol", "bid", "ask",
+	"exchange", "sequence", "trade_id", "price", "size", "volume_24h", "bid_size", "ask_size", "raw"}
+
+// Failed INSERTs of one batch while database is reachable, the batch is discarded after them
+// so broken tick doesn't block the next ones. Batches are kept while database is down
+const writeAttempts = 3
+
+// Max ticks of one INSERT, MySQL allows 65535 placeholders per statement, a tick has 15 columns
+const maxBatchSize = 65535 / 15
+
+// tickRow is a queued tick, it's kept in spill file as JSON line
+type tickRow struct {
+	// empty table is base table of ticks
+	Table     string `json:"table,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+	// Unix time in nanoseconds reported by exchange and of receive, 0 if unknown
+	Time     int64  `json:"time,omitempty"`
+	Received int64  `json:"received,omitempty"`
+	Symbol   string `json:"symbol"`
+	Bid      string `json:"bid"`
+	Ask      string `json:"ask"`
+	// metadata of exchange, empty or 0 if unknown
+	Exchange  string `json:"exchange,omitempty"`
+	Sequence  int64  `json:"sequence,omitempty"`
+	TradeId   int64  `json:"trade_id,omitempty"`
+	Price     string `json:"price,omitempty"`
+	Size      string `json:"size,omitempty"`
+	Volume24h string `json:"volume_24h,omitempty"`
+	BidSize   string `json:"bid_size,omitempty"`
+	AskSize   string `json:"ask_size,omitempty"`
+	Raw       []byte `json:"raw,omitempty"`
+}
+
+// Stats describes asynchronous tick writes
+type Stats struct {
+	// ticks waiting in queue and in spill file
+	Queued  int
+	Spilled int
+	// ticks written to DB and dropped by DropOldest policy
+	Written uint64
+	Dropped uint64
+	// ticks of batches discarded after writeAttempts failed INSERTs
+	Discarded uint64
+	// INSERTs of batches, failed batches are queued again
+	Batches uint64
+	Failed  uint64
+	// latency of batch INSERTs
+	LastLatency  time.Duration
+	MaxLatency   time.Duration
+	TotalLatency time.Duration
+}
+
+// Returns average latency of batch INSERTs
+func (s Stats) AvgLatency() time.Duration {
+	if s.Batches == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Batches)
+}
+
+// Sets size and interval of batches, ticks are written once batch is full or interval has passed
+// Zero size is DefaultBatchSize, zero interval turns periodic writes off. Must be invoked before Open
+func (mysqlConn *MySQLConn) SetBatch(size int, interval time.Duration) error {
+	if size < 0 || size > maxBatchSize {
+		return fmt.Errorf("size should be in range [0, %d]: %d", maxBatchSize, size)
+	}
+	if interval < 0 {
+		return fmt.Errorf("interval should not be negative: %s", interval)
+	}
+	if size == 0 {
+		size = DefaultBatchSize
+	}
+	mysqlConn.batchSize = size
+	mysqlConn.batchInterval = interval
+	return nil
+}
+
+// Sets capacity of tick queue and policy which is applied once queue is full
+// spillPath is a file of spilled ticks, required by storage.Spill. Zero capacity is DefaultQueueCapacity
+// Must be invoked before Open
+func (mysqlConn *MySQLConn) SetQueue(capacity int, policy storage.OverflowPolicy, spillPath string) error {
+	if capacity < 0 {
+		return fmt.Errorf("capacity should not be negative: %d", capacity)
+	}
+	switch policy {
+	case storage.Block, storage.DropOldest:
+	case storage.Spill:
+		if spillPath == "" {
+			return fmt.Errorf("spill path should be set for %s policy", policy)
+		}
+	default:
+		return fmt.Errorf("overflow policy is not supported: %s", policy)
+	}
+	if capacity == 0 {
+		capacity = DefaultQueueCapacity
+	}
+	mysqlConn.capacity = capacity
+	mysqlConn.policy = policy
+	mysqlConn.spillPath = spillPath
+	return nil
+}
+
+// Returns Stats of asynchronous tick writes
+func (mysqlConn *MySQLConn) Stats() Stats {
+	mysqlConn.mu.Lock()
+	defer mysqlConn.mu.Unlock()
+	s := mysqlConn.stats
+	s.Queued = len(mysqlConn.queue)
+	s.Spilled = mysqlConn.spilled
+	return s
+}
+
+// Opens spill file and counts ticks which were spilled before, they are replayed by the next write
+func (mysqlConn *MySQLConn) openSpill() (err error) {
+	if mysqlConn.policy != storage.Spill {
+		return nil
+	}
+	mysqlConn.spill, err = os.OpenFile(mysqlConn.spillPath, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	rows, err := readSpill(mysqlConn.spillPath)
+	mysqlConn.spilled = len(rows)
+	return err
+}
+
+// Queues tick according to overflow policy, wakes writer once batch is full
+// Returns error if storage is closed or spill failed, also error of the last background write if there was one
+func (mysqlConn *MySQLConn) enqueue(row tickRow) error {
+	mysqlConn.mu.Lock()
+	defer mysqlConn.mu.Unlock()
+	if mysqlConn.db == nil || mysqlConn.closed {
+		return fmt.Errorf("storage isn't opened")
+	}
+	full := len(mysqlConn.queue) >= mysqlConn.capacity
+	switch {
+	case mysqlConn.policy == storage.Spill && (full || mysqlConn.spilled > 0):
+		// spilled ticks are older than new ones, so new ones follow them to keep order
+		if err := mysqlConn.spillRows(row); err != nil {
+			return err
+		}
+	case mysqlConn.policy == storage.DropOldest && full:
+		mysqlConn.queue = append(mysqlConn.queue[1:], row)
+		mysqlConn.stats.Dropped++
+	default:
+		for len(mysqlConn.queue) >= mysqlConn.capacity && !mysqlConn.closed {
+			mysqlConn.space.Wait()
+		}
+		if mysqlConn.closed {
+			return fmt.Errorf("storage is closed")
+		}
+		mysqlConn.queue = append(mysqlConn.queue, row)
+	}
+	if len(mysqlConn.queue) >= mysqlConn.batchSize || len(mysqlConn.queue) >= mysqlConn.capacity {
+		select {
+		case mysqlConn.wake <- struct{}{}:
+		default:
+		}
+	}
+	err := mysqlConn.err
+	mysqlConn.err = nil
+	return err
+}
+
+// Appends rows to spill file, must be invoked under mu
+func (mysqlConn *MySQLConn) spillRows(rows ...tickRow) error {
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	if _, err := mysqlConn.spill.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	mysqlConn.spilled += len(rows)
+	return nil
+}
+
+// Reads spilled rows of file
+func readSpill(path string) ([]tickRow, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rows []tickRow
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		row := tickRow{}
+		if err = json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return nil, fmt.Errorf("bad spill file %s: %s", path, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// Starts writer of queued ticks
+func (mysqlConn *MySQLConn) start() {
+	mysqlConn.wake = make(chan struct{}, 1)
+	mysqlConn.done = make(chan struct{})
+	mysqlConn.writer.Add(1)
+	go mysqlConn.run()
+	if mysqlConn.retention > 0 {
+		mysqlConn.writer.Add(1)
+		go mysqlConn.maintainPartitions()
+	}
+}
+
+// Writes queued ticks in background until Close
+func (mysqlConn *MySQLConn) run() {
+	defer mysqlConn.writer.Done()
+	var interval <-chan time.Time
+	if mysqlConn.batchInterval > 0 {
+		ticker := time.NewTicker(mysqlConn.batchInterval)
+		defer ticker.Stop()
+		interval = ticker.C
+	}
+	for {
+		var err error
+		select {
+		case <-mysqlConn.done:
+			return
+		case <-mysqlConn.wake:
+			err = mysqlConn.write(false)
+		case <-interval:
+			err = mysqlConn.write(true)
+		}
+		if err != nil {
+			mysqlConn.mu.Lock()
+			mysqlConn.err = err
+			mysqlConn.mu.Unlock()
+		}
+	}
+}
+
+// Writes queued ticks to DB to the last one, then replays spilled ticks
+func (mysqlConn *MySQLConn) Flush() error {
+	return mysqlConn.write(true)
+}
+
+// Writes queued ticks by batches, if all is false only full batches are written
+// Failed batch is queued again in front of the others, so ticks keep order. It's discarded once it has failed
+// writeAttempts times in a row while database is reachable
+func (mysqlConn *MySQLConn) write(all bool) error {
+	mysqlConn.writeMu.Lock()
+	defer mysqlConn.writeMu.Unlock()
+	for {
+		mysqlConn.mu.Lock()
+		n := len(mysqlConn.queue)
+		if n == 0 || !all && n < mysqlConn.batchSize && n < mysqlConn.capacity {
+			mysqlConn.mu.Unlock()
+			break
+		}
+		if n > mysqlConn.batchSize {
+			n = mysqlConn.batchSize
+		}
+		batch := make([]tickRow, n)
+		copy(batch, mysqlConn.queue)
+		mysqlConn.queue = mysqlConn.queue[n:]
+		mysqlConn.space.Broadcast()
+		mysqlConn.mu.Unlock()
+
+		if rest, err := mysqlConn.insertRows(batch); err != nil {
+			giveUp := mysqlConn.giveUp(&mysqlConn.failures)
+			mysqlConn.mu.Lock()
+			defer mysqlConn.mu.Unlock()
+			if giveUp {
+				return mysqlConn.discard(rest, err)
+			}
+			mysqlConn.queue = append(rest, mysqlConn.queue...)
+			return err
+		}
+		mysqlConn.failures = 0
+	}
+	if !all {
+		return nil
+	}
+	return mysqlConn.replaySpill()
+}
+
+// Writes spilled ticks to DB and truncates spill file, must be invoked under writeMu
+// Ticks which haven't been written are put back in front of spill file, failed batch is discarded like queued one
+func (mysqlConn *MySQLConn) replaySpill() error {
+	mysqlConn.mu.Lock()
+	if mysqlConn.spilled == 0 {
+		mysqlConn.mu.Unlock()
+		return nil
+	}
+	rows, err := readSpill(mysqlConn.spillPath)
+	if err == nil {
+		err = mysqlConn.spill.Truncate(0)
+	}
+	if err != nil {
+		mysqlConn.mu.Unlock()
+		return err
+	}
+	mysqlConn.spilled = 0
+	mysqlConn.mu.Unlock()
+
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > mysqlConn.batchSize {
+			n = mysqlConn.batchSize
+		}
+		if rest, err := mysqlConn.insertRows(rows[:n]); err != nil {
+			giveUp := mysqlConn.giveUp(&mysqlConn.spillFailures)
+			mysqlConn.mu.Lock()
+			defer mysqlConn.mu.Unlock()
+			if giveUp {
+				err = mysqlConn.discard(rest, err)
+				rest = nil
+			}
+			return mysqlConn.unspill(append(rest, rows[n:]...), err)
+		}
+		mysqlConn.spillFailures = 0
+		rows = rows[n:]
+	}
+	return nil
+}
+
+// Counts failed INSERT of batch, must be invoked under writeMu
+// Returns true if batch has failed writeAttempts times in a row, failures aren't counted while database is down
+func (mysqlConn *MySQLConn) giveUp(failures *int) bool {
+	if mysqlConn.db.Ping() != nil {
+		return false
+	}
+	*failures++
+	if *failures < writeAttempts {
+		return false
+	}
+	*failures = 0
+	return true
+}
+
+// Discards rows of batch which has been given up, must be invoked under mu. Returns error describing it
+func (mysqlConn *MySQLConn) discard(rows []tickRow, err error) error {
+	mysqlConn.stats.Discarded += uint64(len(rows))
+	return fmt.Errorf("%d ticks are discarded after %d failed writes: %s", len(rows), writeAttempts, err)
+}
+
+// Puts rows in front of spill file, must be invoked under mu. Returns err of failed write
+func (mysqlConn *MySQLConn) unspill(rows []tickRow, err error) error {
+	spilled, readErr := readSpill(mysqlConn.spillPath)
+	if readErr != nil {
+		return readErr
+	}
+	if truncErr := mysqlConn.spill.Truncate(0); truncErr != nil {
+		return truncErr
+	}
+	mysqlConn.spilled = 0
+	if spillErr := mysqlConn.spillRows(append(rows, spilled...)...); spillErr != nil {
+		return spillErr
+	}
+	return err
+}
+
+// Writes rows by one INSERT per table, tables of exchanges and pairs are created once they are met
+// Returns rows which haven't been written if INSERT failed
+func (mysqlConn *MySQLConn) insertRows(rows []tickRow) ([]tickRow, error) {
+	var tables []string
+	byTable := map[string][]tickRow{}
+	for _, row := range rows {
+		table := row.Table
+		if table == "" {
+			table = mysqlConn.tables.Ticks
+		}
+		if _, ok := byTable[table]; !ok {
+			tables = append(tables, table)
+		}
+		byTable[table] = append(byTable[table], row)
+	}
+	for i, table := range tables {
+		err := mysqlConn.ensureTable(mysqlConn.tables.Ticks, table)
+		if err == nil {
+			err = mysqlConn.insertTicks(table, byTable[table])
+		}
+		if err != nil {
+			var rest []tickRow
+			for _, t := range tables[i:] {
+				rest = append(rest, byTable[t]...)
+			}
+			return rest, err
+		}
+	}
+	return nil, nil
+}
+
+// Writes rows to table by one multi-row INSERT and updates stats
+func (mysqlConn *MySQLConn) insertTicks(table string, rows []tickRow) error {
+	values := make([]interface{}, 0, len(rows)*len(tickColumns))
+	for _, row := range rows {
+		values = append(values, row.Timestamp, mysqlConn.timeValue(row.Time), mysqlConn.timeValue(row.Received), row.Symbol, row.Bid, row.Ask,
+			orNull(row.Exchange), orNull(row.Sequence), orNull(row.TradeId), orNull(row.Price), orNull(row.Size), orNull(row.Volume24h),
+			orNull(row.BidSize), orNull(row.AskSize), orNull(row.Raw))
+	}
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(tickColumns)), ", ") + "), "
+	query := "INSERT INTO " + mysqlConn.qualified(table) + " (`" + strings.Join(tickColumns, "`, `") + "`) VALUES " +
+		strings.TrimSuffix(strings.Repeat(placeholders, len(rows)), ", ") + ";"
+	start := time.Now()
+	_, err := mysqlConn.db.Exec(query, values...)
+	latency := time.Since(start)
+
+	mysqlConn.mu.Lock()
+	defer mysqlConn.mu.Unlock()
+	s := &mysqlConn.stats
+	s.Batches++
+	s.LastLatency = latency
+	s.TotalLatency += latency
+	if latency > s.MaxLatency {
+		s.MaxLatency = latency
+	}
+	if err != nil {
+		s.Failed++
+		return err
+	}
+	s.Written += uint64(len(rows))
+	return nil
+}
+
+// Returns NULL for zero value of optional column
+func orNull(v interface{}) interface{} {
+	switch value := v.(type) {
+	case string:
+		if value == "" {
+			return nil
+		}
+	case int64:
+		if value == 0 {
+			return nil
+		}
+	case []byte:
+		if len(value) == 0 {
+			return nil
+		}
+	}
+	return v
+}
@@ -0,0 +1,419 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/storage"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fDriver records tables and rows of tick INSERTs, fails them and Ping while down is set, INSERTs also fail by insertErr
+// Other statements are recorded in execs and fail by execErr. Listing of tables returns tables,
+// other queries are answered by query func
+type fDriver struct {
+	mu        sync.Mutex
+	down      bool
+	insertErr error
+	inserts   []int
+	into      []string
+	rows      [][]driver.Value
+	execs     []string
+	// args of execs
+	execArgs [][]driver.Value
+	execErr  func(query string) error
+	tables   []string
+	query    func(query string, args []driver.Value) ([]string, [][]driver.Value, error)
+}
+
+func (d *fDriver) Open(name string) (driver.Conn, error) {
+	return &fConn{d: d}, nil
+}
+
+// Sets state of fake database
+func (d *fDriver) setDown(down bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.down = down
+}
+
+// Returns count of INSERTs and rows written
+func (d *fDriver) written() (inserts []int, rows [][]driver.Value) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]int(nil), d.inserts...), append([][]driver.Value(nil), d.rows...)
+}
+
+type fConn struct {
+	d *fDriver
+}
+
+func (c *fConn) Prepare(query string) (driver.Stmt, error) {
+	return &fStmt{d: c.d, query: query}, nil
+}
+
+func (c *fConn) Close() error {
+	return nil
+}
+
+func (c *fConn) Ping(ctx context.Context) error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if c.d.down {
+		return fmt.Errorf("connection refused")
+	}
+	return nil
+}
+
+func (c *fConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions are not supported")
+}
+
+type fStmt struct {
+	d     *fDriver
+	query string
+}
+
+func (s *fStmt) Close() error {
+	return nil
+}
+
+func (s *fStmt) NumInput() int {
+	return -1
+}
+
+func (s *fStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if s.d.down {
+		return nil, fmt.Errorf("connection refused")
+	}
+	if !strings.Contains(s.query, "(`timestamp`, `time`, `received`, `symbol`, `bid`, `ask`, ") {
+		if s.d.execErr != nil {
+			if err := s.d.execErr(s.query); err != nil {
+				return nil, err
+			}
+		}
+		s.d.execs = append(s.d.execs, s.query)
+		s.d.execArgs = append(s.d.execArgs, args)
+		return driver.RowsAffected(0), nil
+	}
+	if s.d.insertErr != nil {
+		return nil, s.d.insertErr
+	}
+	s.d.inserts = append(s.d.inserts, len(args)/len(tickColumns))
+	s.d.into = append(s.d.into, strings.Fields(s.query)[2])
+	for i := 0; i < len(args); i += len(tickColumns) {
+		s.d.rows = append(s.d.rows, args[i:i+len(tickColumns)])
+	}
+	return driver.RowsAffected(len(args) / len(tickColumns)), nil
+}
+
+func (s *fStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if strings.Contains(s.query, "table_name LIKE ?") {
+		var rows [][]driver.Value
+		prefix := strings.Replace(strings.TrimSuffix(args[1].(string), "%"), `\_`, "_", -1)
+		for _, table := range s.d.tables {
+			if strings.HasPrefix(table, prefix) {
+				rows = append(rows, []driver.Value{table})
+			}
+		}
+		return &fRows{columns: []string{"table_name"}, rows: rows}, nil
+	}
+	if s.d.query == nil {
+		return nil, fmt.Errorf("queries are not supported")
+	}
+	columns, rows, err := s.d.query(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fRows{columns: columns, rows: rows}, nil
+}
+
+type fRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fRows) Close() error {
+	return nil
+}
+
+func (r *fRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var fDriverN int
+
+// Creates MySQLConn over fake driver without schema init and starts its writer
+func openFake(t *testing.T, c *MySQLConn) *fDriver {
+	d := &fDriver{}
+	fDriverN++
+	name := fmt.Sprintf("fmysql%d", fDriverN)
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	assert.NoError(t, err)
+	assert.NoError(t, c.openSpill())
+	c.db = db
+	c.start()
+	return d
+}
+
+// Returns tick of second n
+func tickAt(n int) crypto.Tick {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	return crypto.Tick{T: time.Unix(int64(n), 0), P: btc_usd, Bid: crypto.MustDecimal("1.5"), Ask: crypto.MustDecimal("2")}
+}
+
+// Returns timestamps of written rows
+func timestamps(rows [][]driver.Value) []int64 {
+	ts := make([]int64, len(rows))
+	for i, row := range rows {
+		ts[i] = row[0].(int64)
+	}
+	return ts
+}
+
+func TestMySQLConn_SetBatch(t *testing.T) {
+	c, _ := New()
+	assert.Error(t, c.SetBatch(-1, 0))
+	assert.Error(t, c.SetBatch(maxBatchSize+1, 0))
+	assert.Error(t, c.SetBatch(1, -time.Second))
+	assert.NoError(t, c.SetBatch(0, time.Minute))
+	assert.Equal(t, DefaultBatchSize, c.batchSize)
+
+	assert.Error(t, c.SetQueue(-1, storage.Block, ""))
+	assert.Error(t, c.SetQueue(1, storage.Spill, ""))
+	assert.Error(t, c.SetQueue(1, storage.OverflowPolicy(42), ""))
+	assert.NoError(t, c.SetQueue(0, storage.DropOldest, ""))
+	assert.Equal(t, DefaultQueueCapacity, c.capacity)
+
+	assert.Error(t, c.WriteTick(tickAt(1)))
+	assert.NoError(t, c.Flush())
+	assert.NoError(t, c.Close())
+}
+
+func TestMySQLConn_WriteTick(t *testing.T) {
+	t.Run("multi-row INSERT by batch size and Flush", func(t *testing.T) {
+		c, _ := New()
+		assert.NoError(t, c.SetBatch(3, 0))
+		d := openFake(t, c)
+
+		for i := 0; i < 7; i++ {
+			assert.NoError(t, c.WriteTick(tickAt(i)))
+		}
+		assert.NoError(t, c.Flush())
+		inserts, rows := d.written()
+		assert.Equal(t, []int{3, 3, 1}, inserts)
+		assert.Equal(t, []int64{0, 1, 2, 3, 4, 5, 6}, timestamps(rows))
+		assert.Equal(t, []driver.Value{int64(0), nil, nil, "BTC-USD", "1.5", "2", nil, nil, nil, nil, nil, nil, nil, nil, nil}, rows[0])
+
+		s := c.Stats()
+		assert.Equal(t, uint64(7), s.Written)
+		assert.Equal(t, uint64(3), s.Batches)
+		assert.Equal(t, 0, s.Queued)
+		assert.True(t, s.MaxLatency >= s.AvgLatency())
+
+		assert.NoError(t, c.WriteTick(tickAt(7)))
+		assert.NoError(t, c.Close())
+		assert.NoError(t, c.Close())
+		_, rows = d.written()
+		assert.Len(t, rows, 8)
+		assert.Error(t, c.WriteTick(tickAt(8)))
+	})
+
+	t.Run("metadata of tick is written", func(t *testing.T) {
+		c, _ := New()
+		d := openFake(t, c)
+		defer c.Close()
+		tick := tickAt(1)
+		tick.ExchangeId, tick.Sequence, tick.TradeId = "coinbase", 42, 7
+		tick.Price, tick.Size, tick.Volume24h = crypto.MustDecimal("1.6"), crypto.MustDecimal("0.01"), crypto.MustDecimal("1000")
+		tick.BidSize, tick.AskSize = crypto.MustDecimal("0.5"), crypto.MustDecimal("0.25")
+		tick.Raw = []byte(`{"type":"ticker"}`)
+
+		assert.NoError(t, c.WriteTick(tick))
+		assert.NoError(t, c.Flush())
+		_, rows := d.written()
+		assert.Equal(t, []driver.Value{int64(1), int64(1000000000), nil, "BTC-USD", "1.5", "2",
+			"coinbase", int64(42), int64(7), "1.6", "0.01", "1000", "0.5", "0.25", []byte(`{"type":"ticker"}`)}, rows[0])
+	})
+
+	t.Run("interval writes partial batch", func(t *testing.T) {
+		c, _ := New()
+		assert.NoError(t, c.SetBatch(100, 10*time.Millisecond))
+		d := openFake(t, c)
+		defer c.Close()
+
+		assert.NoError(t, c.WriteTick(tickAt(1)))
+		deadline := time.Now().Add(5 * time.Second)
+		for c.Stats().Written == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		inserts, _ := d.written()
+		assert.Equal(t, []int{1}, inserts)
+	})
+
+	t.Run("failed batch is queued again and error is reported", func(t *testing.T) {
+		c, _ := New()
+		assert.NoError(t, c.SetBatch(2, 0))
+		d := openFake(t, c)
+		d.setDown(true)
+
+		assert.NoError(t, c.WriteTick(tickAt(1)))
+		assert.NoError(t, c.WriteTick(tickAt(2)))
+		assert.Error(t, c.Flush())
+		assert.Equal(t, 2, c.Stats().Queued)
+		assert.True(t, c.Stats().Failed > 0)
+
+		d.setDown(false)
+		assert.NoError(t, c.Flush())
+		assert.NoError(t, c.Close())
+		_, rows := d.written()
+		assert.Equal(t, []int64{1, 2}, timestamps(rows))
+	})
+
+	t.Run("batch failed while database is up is discarded after attempts", func(t *testing.T) {
+		c, _ := New()
+		assert.NoError(t, c.SetBatch(10, 0))
+		d := openFake(t, c)
+		d.mu.Lock()
+		d.insertErr = fmt.Errorf("data too long")
+		d.mu.Unlock()
+
+		assert.NoError(t, c.WriteTick(tickAt(1)))
+		assert.NoError(t, c.WriteTick(tickAt(2)))
+		for i := 1; i < writeAttempts; i++ {
+			assert.EqualError(t, c.Flush(), "data too long")
+			assert.Equal(t, 2, c.Stats().Queued)
+		}
+		err := c.Flush()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "2 ticks are discarded")
+		s := c.Stats()
+		assert.Equal(t, 0, s.Queued)
+		assert.Equal(t, uint64(2), s.Discarded)
+		assert.Equal(t, uint64(writeAttempts), s.Failed)
+
+		// the next ticks aren't blocked by discarded batch
+		d.mu.Lock()
+		d.insertErr = nil
+		d.mu.Unlock()
+		assert.NoError(t, c.WriteTick(tickAt(3)))
+		assert.NoError(t, c.Close())
+		_, rows := d.written()
+		assert.Equal(t, []int64{3}, timestamps(rows))
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		c, _ := New()
+		assert.NoError(t, c.SetBatch(10, 0))
+		assert.NoError(t, c.SetQueue(2, storage.DropOldest, ""))
+		d := openFake(t, c)
+		d.setDown(true)
+
+		for i := 0; i < 5; i++ {
+			_ = c.WriteTick(tickAt(i))
+		}
+		assert.Error(t, c.Flush())
+		s := c.Stats()
+		assert.True(t, s.Dropped >= 3)
+		assert.Equal(t, 2, s.Queued)
+
+		d.setDown(false)
+		assert.NoError(t, c.Close())
+		_, rows := d.written()
+		assert.Equal(t, []int64{3, 4}, timestamps(rows))
+	})
+
+	t.Run("block waits for space", func(t *testing.T) {
+		c, _ := New()
+		assert.NoError(t, c.SetBatch(1, 0))
+		assert.NoError(t, c.SetQueue(1, storage.Block, ""))
+		d := openFake(t, c)
+		d.setDown(true)
+
+		assert.NoError(t, c.WriteTick(tickAt(1)))
+		written := make(chan error, 1)
+		go func() {
+			written <- c.WriteTick(tickAt(2))
+		}()
+		select {
+		case <-written:
+			t.Fatal("WriteTick hasn't blocked")
+		case <-time.After(50 * time.Millisecond):
+		}
+		d.setDown(false)
+		assert.NoError(t, c.Flush())
+		select {
+		case <-written:
+		case <-time.After(5 * time.Second):
+			t.Fatal("WriteTick hasn't been unblocked")
+		}
+		assert.NoError(t, c.Close())
+		_, rows := d.written()
+		assert.Equal(t, []int64{1, 2}, timestamps(rows))
+	})
+
+	t.Run("spill to disk and replay", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "mysql")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		spill := filepath.Join(dir, "ticks.spill")
+
+		c, _ := New()
+		assert.NoError(t, c.SetBatch(10, 0))
+		assert.NoError(t, c.SetQueue(2, storage.Spill, spill))
+		d := openFake(t, c)
+		d.setDown(true)
+		for i := 0; i < 5; i++ {
+			_ = c.WriteTick(tickAt(i))
+		}
+		s := c.Stats()
+		assert.Equal(t, 2, s.Queued)
+		assert.Equal(t, 3, s.Spilled)
+
+		// database is still down, queued ticks are put in front of spilled ones
+		assert.NoError(t, c.Close())
+		rows, err := readSpill(spill)
+		assert.NoError(t, err)
+		assert.Len(t, rows, 5)
+		assert.Equal(t, int64(0), rows[0].Timestamp)
+
+		// spilled ticks of previous run are replayed before new ones
+		c, _ = New()
+		assert.NoError(t, c.SetBatch(10, 0))
+		assert.NoError(t, c.SetQueue(2, storage.Spill, spill))
+		d = openFake(t, c)
+		assert.Equal(t, 5, c.Stats().Spilled)
+		assert.NoError(t, c.WriteTick(tickAt(5)))
+		assert.NoError(t, c.Flush())
+		assert.NoError(t, c.Close())
+		_, written := d.written()
+		assert.Equal(t, []int64{0, 1, 2, 3, 4, 5}, timestamps(written))
+		rows, err = readSpill(spill)
+		assert.NoError(t, err)
+		assert.Empty(t, rows)
+	})
+}
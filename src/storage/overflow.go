@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OverflowPolicy describes what asynchronous storage does with a write when its queue is full,
+// e.g. database falls behind or is unavailable
+type OverflowPolicy int
+
+const (
+	// Block waits until queue has space
+	Block OverflowPolicy = iota + 1
+	// DropOldest drops the oldest queued write to make space
+	DropOldest
+	// Spill appends writes to file on disk, they are replayed once queue is drained
+	Spill
+)
+
+// Names of overflow policies, used by configs
+var overflowNames = map[OverflowPolicy]string{
+	Block:      "block",
+	DropOldest: "drop_oldest",
+	Spill:      "spill",
+}
+
+// Returns name of OverflowPolicy
+func (p OverflowPolicy) String() string {
+	if name, ok := overflowNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(p))
+}
+
+// Returns OverflowPolicy by name, case insensitive
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	for p, n := range overflowNames {
+		if strings.EqualFold(n, name) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("overflow policy not found: %s", name)
+}
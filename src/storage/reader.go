@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"time"
+)
+
+// Reader is optional read side of Storage, consumers check it by type assertion
+type Reader interface {
+	// Ticks returns TickIterator of pair ticks in range [from, to) ordered by time, it stops once ctx is done
+	Ticks(ctx context.Context, pair crypto.Pair, from time.Time, to time.Time) (TickIterator, error)
+	// LatestTick returns the last stored tick of pair, zero Tick if there is no ticks
+	LatestTick(pair crypto.Pair) (crypto.Tick, error)
+	// Pairs returns sorted pairs which have stored ticks
+	Pairs() ([]crypto.Pair, error)
+	// Aggregate returns non-empty buckets of pair ticks in range [from, to) ordered by time,
+	// buckets are aligned to multiples of interval since Unix epoch
+	Aggregate(ctx context.Context, pair crypto.Pair, from time.Time, to time.Time, interval time.Duration) ([]Bucket, error)
+}
+
+// TickIterator iterates over ticks like sql.Rows:
+//
+//	for it.Next() {
+//		tick := it.Tick()
+//	}
+//	err = it.Err()
+//
+// Close must be invoked if iteration is stopped before Next returns false
+type TickIterator interface {
+	// Next advances to the next tick, returns false once ticks are over or error occurred
+	Next() bool
+	// Tick returns current tick
+	Tick() crypto.Tick
+	// Err returns error occurred during iteration
+	Err() error
+	// Close releases iterator, it's safe to invoke it twice
+	Close() error
+}
+
+// Bucket is an aggregate of ticks in [T, T + Interval)
+type Bucket struct {
+	T        time.Time
+	Interval time.Duration
+	Count    int
+	MinBid   crypto.Decimal
+	MaxBid   crypto.Decimal
+	AvgBid   crypto.Decimal
+	MinAsk   crypto.Decimal
+	MaxAsk   crypto.Decimal
+	AvgAsk   crypto.Decimal
+}
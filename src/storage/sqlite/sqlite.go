@@ -0,0 +1,525 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/storage"
+	_ "github.com/mattn/go-sqlite3"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of batched writes, ticks and trades are written in one transaction once batch is full or interval has passed
+const (
+	DefaultBatchSize     = 100
+	DefaultBatchInterval = time.Second
+)
+
+// Attempts of flush of pending rows, rows are dropped after the last one so broken database doesn't grow batches endlessly
+const flushAttempts = 3
+
+// Schema is the same as schema of storage/mysql, decimals are kept as text to keep precision
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS Ticks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp BIGINT NOT NULL,
+		symbol VARCHAR(255) NOT NULL,
+		bid TEXT NOT NULL,
+		ask TEXT NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS Trades (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp BIGINT NOT NULL,
+		symbol VARCHAR(255) NOT NULL,
+		trade_id VARCHAR(255) NOT NULL,
+		price TEXT NOT NULL,
+		size TEXT NOT NULL,
+		side VARCHAR(8) NOT NULL,
+		maker_order_id VARCHAR(255) NOT NULL,
+		taker_order_id VARCHAR(255) NOT NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS Candles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp BIGINT NOT NULL,
+		symbol VARCHAR(255) NOT NULL,
+		granularity INTEGER NOT NULL,
+		open TEXT NOT NULL,
+		high TEXT NOT NULL,
+		low TEXT NOT NULL,
+		close TEXT NOT NULL,
+		volume TEXT NOT NULL,
+		UNIQUE (symbol, granularity, timestamp)
+	);`,
+}
+
+// Columns of exchange metadata added to Ticks of older schema, NULL if unknown
+var tickMetaColumns = [][2]string{
+	{"exchange", "VARCHAR(64)"},
+	{"received", "BIGINT"},
+	{"sequence", "BIGINT"},
+	{"trade_id", "BIGINT"},
+	{"price", "TEXT"},
+	{"size", "TEXT"},
+	{"volume_24h", "TEXT"},
+	{"bid_size", "TEXT"},
+	{"ask_size", "TEXT"},
+	{"raw", "TEXT"},
+}
+
+// Inserts of batched rows
+const (
+	insertTick = "INSERT INTO Ticks (timestamp, symbol, bid, ask, exchange, received, sequence, trade_id, price, size, volume_24h, bid_size, ask_size, raw) " +
+		"VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);"
+	insertTrade = "INSERT INTO Trades (timestamp, symbol, trade_id, price, size, side, maker_order_id, taker_order_id) VALUES(?, ?, ?, ?, ?, ?, ?, ?);"
+)
+
+// SQLiteConn implements storage.Storage over one SQLite file in WAL mode
+// Ticks and trades are written in batches by one transaction
+type SQLiteConn struct {
+	db *sql.DB
+
+	batchSize     int
+	batchInterval time.Duration
+
+	mu     sync.Mutex
+	ticks  [][]interface{}
+	trades [][]interface{}
+	// error of background flush, returned by the next write
+	err error
+	// failed flushes of pending rows in a row
+	failures int
+
+	done    chan struct{}
+	flusher sync.WaitGroup
+}
+
+// Registers SQLiteConn as sqlite storage
+func init() {
+	storage.Register("sqlite", func() (storage.Storage, error) {
+		return New()
+	})
+}
+
+// Creates SQLiteConn
+func New() (*SQLiteConn, error) {
+	c := new(SQLiteConn)
+	c.batchSize = DefaultBatchSize
+	c.batchInterval = DefaultBatchInterval
+	return c, nil
+}
+
+// Sets size and interval of batches, size 1 writes every tick at once, zero interval turns periodic flush off
+// Must be invoked before Open
+func (c *SQLiteConn) SetBatch(size int, interval time.Duration) error {
+	if size < 0 {
+		return fmt.Errorf("size should not be negative: %d", size)
+	}
+	if interval < 0 {
+		return fmt.Errorf("interval should not be negative: %s", interval)
+	}
+	if size == 0 {
+		size = DefaultBatchSize
+	}
+	c.batchSize = size
+	c.batchInterval = interval
+	return nil
+}
+
+// Opens database file, creates schema and starts periodic flush
+// DSN is URL of file, e.g. sqlite:///var/lib/ticks.db, sqlite://ticks.db for relative path or sqlite://:memory:
+// Query parameters are passed to go-sqlite3, e.g. _busy_timeout=10000
+func (c *SQLiteConn) Open(dsn string) (err error) {
+	if dsn, err = driverDSN(dsn); err != nil {
+		return err
+	}
+	c.db, err = sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	// SQLite has one writer, one connection also keeps :memory: database alive
+	c.db.SetMaxOpenConns(1)
+	if err = c.init(); err != nil {
+		_ = c.db.Close()
+		c.db = nil
+		return err
+	}
+	c.done = make(chan struct{})
+	if c.batchInterval > 0 {
+		c.flusher.Add(1)
+		go c.flushPeriodically()
+	}
+	return nil
+}
+
+// Converts URL-style DSN to DSN of go-sqlite3, WAL mode is turned on
+func driverDSN(dsn string) (string, error) {
+	const scheme = "sqlite://"
+	if !strings.HasPrefix(strings.ToLower(dsn), scheme) {
+		return "", fmt.Errorf("bad DSN scheme, expected %s", scheme)
+	}
+	rest := dsn[len(scheme):]
+	path, rawQuery := rest, ""
+	if i := strings.Index(rest, "?"); i >= 0 {
+		path, rawQuery = rest[:i], rest[i+1:]
+	}
+	if path == "" {
+		return "", fmt.Errorf("path of database file isn't set")
+	}
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", fmt.Errorf("bad DSN: %s", err)
+	}
+	if q.Get("_journal_mode") == "" {
+		q.Set("_journal_mode", "WAL")
+	}
+	if q.Get("_busy_timeout") == "" {
+		q.Set("_busy_timeout", "5000")
+	}
+	return "file:" + path + "?" + q.Encode(), nil
+}
+
+// init creates schema
+func (c *SQLiteConn) init() error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range schema {
+		if _, err = tx.Exec(stmt); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if err = addColumns(tx, "Ticks", tickMetaColumns); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Adds columns which table doesn't have yet, SQLite has no ADD COLUMN IF NOT EXISTS
+func addColumns(tx *sql.Tx, table string, columns [][2]string) error {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?);", table)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+	for _, column := range columns {
+		if existing[column[0]] {
+			continue
+		}
+		if _, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column[0], column[1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Adds crypto.Ticker to batch of ticks, metadata and raw payload of crypto.Tick are written as well
+// Receive time is Unix time in nanoseconds
+func (c *SQLiteConn) WriteTick(ticker crypto.Ticker) error {
+	pair, _ := ticker.Pair()
+	bestBid, _ := ticker.BestBid()
+	bestAsk, _ := ticker.BestAsk()
+	tick, _ := ticker.(crypto.Tick)
+	var received, raw interface{}
+	if !tick.Received.IsZero() {
+		received = tick.Received.UnixNano()
+	}
+	if len(tick.Raw) > 0 {
+		raw = string(tick.Raw)
+	}
+	return c.add(&c.ticks, ticker.Timestamp().Unix(), pair.String('-'), bestBid.String(), bestAsk.String(),
+		nullString(tick.ExchangeId), received, nullInt(tick.Sequence), nullInt(tick.TradeId), nullDecimal(tick.Price),
+		nullDecimal(tick.Size), nullDecimal(tick.Volume24h), nullDecimal(tick.BidSize), nullDecimal(tick.AskSize), raw)
+}
+
+// Returns NULL for empty string, which is unknown value of metadata
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// Returns NULL for 0, which is unknown value of metadata
+func nullInt(i int64) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+// Returns NULL for 0, which is unknown value of metadata, decimals are kept as text
+func nullDecimal(d crypto.Decimal) interface{} {
+	if d.IsZero() {
+		return nil
+	}
+	return d.String()
+}
+
+// Adds crypto.Trade to batch of trades
+func (c *SQLiteConn) WriteTrade(trade crypto.Trade) error {
+	return c.add(&c.trades, trade.T.Unix(), trade.P.String('-'), trade.Id, trade.Price.String(), trade.Size.String(),
+		trade.Side.String(), trade.MakerOrderId, trade.TakerOrderId)
+}
+
+// Write crypto.Candle to DB at once, replaces candle of same symbol, granularity and timestamp
+func (c *SQLiteConn) WriteCandle(candle crypto.Candle) error {
+	if c.db == nil {
+		return fmt.Errorf("storage isn't opened")
+	}
+	_, err := c.db.Exec("INSERT INTO Candles (timestamp, symbol, granularity, open, high, low, close, volume) VALUES(?, ?, ?, ?, ?, ?, ?, ?) "+
+		"ON CONFLICT (symbol, granularity, timestamp) DO UPDATE SET open = excluded.open, high = excluded.high, low = excluded.low, close = excluded.close, volume = excluded.volume;",
+		candle.T.Unix(), candle.P.String('-'), int64(candle.Interval.Seconds()), candle.Open.String(), candle.High.String(),
+		candle.Low.String(), candle.Close.String(), candle.Volume.String())
+	return err
+}
+
+// Appends row to batch, writes batches once it's full
+// Row is kept even if error is returned, error of the last background flush is reported first
+func (c *SQLiteConn) add(batch *[][]interface{}, row ...interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		return fmt.Errorf("storage isn't opened")
+	}
+	*batch = append(*batch, row)
+	err := c.err
+	c.err = nil
+	if len(*batch) >= c.batchSize {
+		if flushErr := c.flush(); err == nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
+// Writes pending ticks and trades to DB
+func (c *SQLiteConn) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
+
+// Writes every batch in one transaction, must be invoked under mu
+// Broken rows are skipped, so they don't block the next ones. Batches are kept if transaction failed
+// and dropped after flushAttempts failures in a row
+func (c *SQLiteConn) flush() error {
+	if c.db == nil || len(c.ticks) == 0 && len(c.trades) == 0 {
+		return nil
+	}
+	skipped, err := c.write()
+	if err != nil {
+		c.failures++
+		n := len(c.ticks) + len(c.trades)
+		if c.failures < flushAttempts {
+			return fmt.Errorf("%s, %d rows are kept for retry", err, n)
+		}
+		c.reset()
+		return fmt.Errorf("%s, %d rows are dropped after %d attempts", err, n, flushAttempts)
+	}
+	c.reset()
+	if len(skipped) > 0 {
+		return fmt.Errorf("%d rows are skipped: %s", len(skipped), skipped[0])
+	}
+	return nil
+}
+
+// Drops pending rows, must be invoked under mu
+func (c *SQLiteConn) reset() {
+	c.ticks = c.ticks[:0]
+	c.trades = c.trades[:0]
+	c.failures = 0
+}
+
+// Inserts every batch in one transaction, must be invoked under mu
+// Returns errors of skipped rows, err if transaction failed and nothing has been written
+func (c *SQLiteConn) write() (skipped []error, err error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	batches := []struct {
+		query string
+		rows  [][]interface{}
+	}{{insertTick, c.ticks}, {insertTrade, c.trades}}
+	for _, b := range batches {
+		errs, err := insert(tx, b.query, b.rows)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		skipped = append(skipped, errs...)
+	}
+	return skipped, tx.Commit()
+}
+
+// Inserts rows by one prepared statement, failed row is skipped since SQLite rolls back its statement only
+// Returns errors of skipped rows, err if statement hasn't been prepared
+func insert(tx *sql.Tx, query string, rows [][]interface{}) (skipped []error, err error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	for _, row := range rows {
+		if _, err = stmt.Exec(row...); err != nil {
+			skipped = append(skipped, err)
+		}
+	}
+	return skipped, nil
+}
+
+// Flushes batches every batch interval until Close
+func (c *SQLiteConn) flushPeriodically() {
+	defer c.flusher.Done()
+	ticker := time.NewTicker(c.batchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			if err := c.flush(); err != nil {
+				c.err = err
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Returns stored ticks of pair in time range [from, to) ordered by time
+// Pending ticks are flushed before
+func (c *SQLiteConn) Ticks(pair crypto.Pair, from time.Time, to time.Time) ([]crypto.Tick, error) {
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	if c.db == nil {
+		return nil, fmt.Errorf("storage isn't opened")
+	}
+	rows, err := c.db.Query("SELECT timestamp, bid, ask FROM Ticks WHERE symbol = ? AND timestamp >= ? AND timestamp < ? ORDER BY timestamp, id;",
+		pair.String('-'), from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ticks []crypto.Tick
+	for rows.Next() {
+		var ts int64
+		var bid, ask string
+		if err = rows.Scan(&ts, &bid, &ask); err != nil {
+			return nil, err
+		}
+		tick := crypto.Tick{T: time.Unix(ts, 0).UTC(), P: pair}
+		if tick.Bid, err = crypto.NewDecimal(bid); err != nil {
+			return nil, err
+		}
+		if tick.Ask, err = crypto.NewDecimal(ask); err != nil {
+			return nil, err
+		}
+		ticks = append(ticks, tick)
+	}
+	return ticks, rows.Err()
+}
+
+// Returns stored trades of pair in time range [from, to) ordered by time
+// Pending trades are flushed before
+func (c *SQLiteConn) Trades(pair crypto.Pair, from time.Time, to time.Time) ([]crypto.Trade, error) {
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	if c.db == nil {
+		return nil, fmt.Errorf("storage isn't opened")
+	}
+	rows, err := c.db.Query("SELECT timestamp, trade_id, price, size, side, maker_order_id, taker_order_id FROM Trades "+
+		"WHERE symbol = ? AND timestamp >= ? AND timestamp < ? ORDER BY timestamp, id;", pair.String('-'), from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var trades []crypto.Trade
+	for rows.Next() {
+		var ts int64
+		var price, size, side string
+		trade := crypto.Trade{P: pair}
+		if err = rows.Scan(&ts, &trade.Id, &price, &size, &side, &trade.MakerOrderId, &trade.TakerOrderId); err != nil {
+			return nil, err
+		}
+		trade.T = time.Unix(ts, 0).UTC()
+		if trade.Price, err = crypto.NewDecimal(price); err != nil {
+			return nil, err
+		}
+		if trade.Size, err = crypto.NewDecimal(size); err != nil {
+			return nil, err
+		}
+		if trade.Side, err = parseSide(side); err != nil {
+			return nil, err
+		}
+		trades = append(trades, trade)
+	}
+	return trades, rows.Err()
+}
+
+// Returns crypto.Side by its name
+func parseSide(s string) (crypto.Side, error) {
+	for _, side := range []crypto.Side{crypto.Bid, crypto.Ask} {
+		if side.String() == s {
+			return side, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown side: %s", s)
+}
+
+// Returns time of the last stored candle of pair and interval, zero time if there is no candles
+func (c *SQLiteConn) LastCandle(pair crypto.Pair, interval time.Duration) (time.Time, error) {
+	if c.db == nil {
+		return time.Time{}, fmt.Errorf("storage isn't opened")
+	}
+	var last sql.NullInt64
+	err := c.db.QueryRow("SELECT MAX(timestamp) FROM Candles WHERE symbol = ? AND granularity = ?;",
+		pair.String('-'), int64(interval.Seconds())).Scan(&last)
+	if err != nil || !last.Valid {
+		return time.Time{}, err
+	}
+	return time.Unix(last.Int64, 0).UTC(), nil
+}
+
+// Flushes pending rows and closes database
+func (c *SQLiteConn) Close() error {
+	if c.db == nil {
+		return nil
+	}
+	close(c.done)
+	c.flusher.Wait()
+	c.mu.Lock()
+	err := c.flush()
+	if c.err != nil && err == nil {
+		err = c.err
+	}
+	db := c.db
+	c.db = nil
+	c.mu.Unlock()
+	if closeErr := db.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,220 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
+	"github.com/Sn0w1eo/crypto-fetcher/src/storage"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_driverDSN(t *testing.T) {
+	cases := []struct {
+		dsn      string
+		expected string
+		hasError bool
+	}{
+		{"sqlite:///var/lib/ticks.db", "file:/var/lib/ticks.db?_busy_timeout=5000&_journal_mode=WAL", false},
+		{"sqlite://ticks.db?_busy_timeout=100", "file:ticks.db?_busy_timeout=100&_journal_mode=WAL", false},
+		{"sqlite://:memory:", "file::memory:?_busy_timeout=5000&_journal_mode=WAL", false},
+		{"sqlite://", "", true},
+		{"file:///tmp", "", true},
+		{"sqlite://ticks.db?%zz", "", true},
+	}
+	for _, testCase := range cases {
+		dsn, err := driverDSN(testCase.dsn)
+		if testCase.hasError {
+			assert.Error(t, err, testCase.dsn)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, dsn)
+	}
+}
+
+func TestSQLiteConn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dsn := "sqlite://" + filepath.ToSlash(filepath.Join(dir, "ticks.db"))
+
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	eth_usd, _ := crypto.NewPair("eth", "usd")
+	now := time.Unix(1609459200, 0).UTC()
+	tick := crypto.Tick{T: now, P: btc_usd, Bid: crypto.MustDecimal("29000.123456789"), Ask: crypto.MustDecimal("29001")}
+	trade := crypto.Trade{T: now, P: btc_usd, Id: "1", Price: crypto.MustDecimal("29000.5"), Size: crypto.MustDecimal("0.25"), Side: crypto.Ask, MakerOrderId: "m", TakerOrderId: "t"}
+
+	c, _ := New()
+	assert.Error(t, c.WriteTick(tick))
+	assert.NoError(t, c.SetBatch(2, 0))
+	assert.NoError(t, c.Open(dsn))
+
+	var mode string
+	assert.NoError(t, c.db.QueryRow("PRAGMA journal_mode;").Scan(&mode))
+	assert.Equal(t, "wal", mode)
+
+	count := func() (n int) {
+		assert.NoError(t, c.db.QueryRow("SELECT COUNT(*) FROM Ticks;").Scan(&n))
+		return n
+	}
+	assert.NoError(t, c.WriteTick(tick))
+	assert.Equal(t, 0, count())
+	assert.NoError(t, c.WriteTrade(trade))
+	assert.Equal(t, 0, count())
+	assert.NoError(t, c.WriteTick(crypto.Tick{T: now.Add(time.Second), P: eth_usd, Bid: tick.Bid, Ask: tick.Ask}))
+	assert.Equal(t, 2, count())
+	assert.NoError(t, c.WriteTick(crypto.Tick{T: now.Add(time.Minute), P: btc_usd, Bid: tick.Bid, Ask: tick.Ask}))
+
+	ticks, err := c.Ticks(btc_usd, now, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []crypto.Tick{tick}, ticks)
+	trades, err := c.Trades(btc_usd, now, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []crypto.Trade{trade}, trades)
+
+	candle := crypto.Candle{T: now, P: btc_usd, Interval: time.Minute, Open: tick.Bid, High: tick.Ask, Low: tick.Bid, Close: tick.Ask, Volume: trade.Size}
+	assert.NoError(t, c.WriteCandle(candle))
+	candle.Close = tick.Bid
+	assert.NoError(t, c.WriteCandle(candle))
+	last, err := c.LastCandle(btc_usd, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, now, last)
+	last, err = c.LastCandle(btc_usd, time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, last.IsZero())
+
+	assert.NoError(t, c.WriteTick(tick))
+	assert.NoError(t, c.Close())
+	assert.NoError(t, c.Close())
+
+	// pending tick is flushed on Close, schema is idempotent
+	st, err := storage.Open(dsn)
+	assert.NoError(t, err)
+	ticks, err = st.(*SQLiteConn).Ticks(btc_usd, now, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, ticks, 3)
+	assert.NoError(t, st.Close())
+}
+
+func TestSQLiteConn_flushPeriodically(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	c, _ := New()
+	assert.Error(t, c.SetBatch(-1, 0))
+	assert.Error(t, c.SetBatch(1, -time.Second))
+	assert.NoError(t, c.SetBatch(0, 10*time.Millisecond))
+	assert.Equal(t, DefaultBatchSize, c.batchSize)
+	assert.NoError(t, c.Open("sqlite://:memory:"))
+	defer c.Close()
+
+	assert.NoError(t, c.WriteTick(crypto.Tick{T: time.Now(), P: btc_usd, Bid: crypto.MustDecimal("1"), Ask: crypto.MustDecimal("2")}))
+	deadline := time.Now().Add(5 * time.Second)
+	n := 0
+	for n == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		c.mu.Lock()
+		assert.NoError(t, c.db.QueryRow("SELECT COUNT(*) FROM Ticks;").Scan(&n))
+		c.mu.Unlock()
+	}
+	assert.Equal(t, 1, n)
+}
+
+func TestSQLiteConn_add(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	tick := crypto.Tick{T: time.Now(), P: btc_usd, Bid: crypto.MustDecimal("1"), Ask: crypto.MustDecimal("2")}
+	c, _ := New()
+	assert.NoError(t, c.SetBatch(2, 0))
+	assert.NoError(t, c.Open("sqlite://:memory:"))
+	defer c.Close()
+
+	// tick is kept while error of background flush is reported
+	c.err = fmt.Errorf("background flush failed")
+	assert.EqualError(t, c.WriteTick(tick), "background flush failed")
+	assert.NoError(t, c.WriteTick(tick))
+	var n int
+	assert.NoError(t, c.db.QueryRow("SELECT COUNT(*) FROM Ticks;").Scan(&n))
+	assert.Equal(t, 2, n)
+}
+
+func TestSQLiteConn_flush(t *testing.T) {
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	tick := crypto.Tick{T: time.Now(), P: btc_usd, Bid: crypto.MustDecimal("1"), Ask: crypto.MustDecimal("2")}
+	c, _ := New()
+	assert.NoError(t, c.SetBatch(10, 0))
+	assert.NoError(t, c.Open("sqlite://:memory:"))
+	defer c.Close()
+	count := func(table string) (n int) {
+		assert.NoError(t, c.db.QueryRow("SELECT COUNT(*) FROM "+table+";").Scan(&n))
+		return n
+	}
+
+	// row with NULL timestamp is skipped, the others are written
+	assert.NoError(t, c.WriteTick(tick))
+	assert.NoError(t, c.add(&c.ticks, make([]interface{}, 14)...))
+	assert.NoError(t, c.WriteTick(tick))
+	err := c.Flush()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1 rows are skipped")
+	assert.Equal(t, 2, count("Ticks"))
+	assert.NoError(t, c.Flush())
+
+	// rows are kept while transaction fails and dropped after the last attempt
+	_, err = c.db.Exec("DROP TABLE Trades;")
+	assert.NoError(t, err)
+	assert.NoError(t, c.WriteTrade(crypto.Trade{T: time.Now(), P: btc_usd, Id: "1", Price: tick.Bid, Size: tick.Ask, Side: crypto.Bid}))
+	assert.NoError(t, c.WriteTick(tick))
+	for i := 1; i < flushAttempts; i++ {
+		err = c.Flush()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "2 rows are kept for retry")
+	}
+	err = c.Flush()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "2 rows are dropped")
+	assert.Empty(t, c.ticks)
+	assert.Empty(t, c.trades)
+	assert.Equal(t, 2, count("Ticks"))
+}
+
+func TestSQLiteConn_metadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ticks.db")
+
+	// Ticks of older schema get columns of metadata
+	db, err := sql.Open("sqlite3", path)
+	assert.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE Ticks (id INTEGER PRIMARY KEY AUTOINCREMENT, timestamp BIGINT NOT NULL, symbol VARCHAR(255) NOT NULL, bid TEXT NOT NULL, ask TEXT NOT NULL);")
+	assert.NoError(t, err)
+	assert.NoError(t, db.Close())
+
+	btc_usd, _ := crypto.NewPair("btc", "usd")
+	received := time.Unix(1609459200, 500).UTC()
+	tick := crypto.Tick{T: time.Unix(1609459200, 0), P: btc_usd, Bid: crypto.MustDecimal("1"), Ask: crypto.MustDecimal("2"), Received: received,
+		ExchangeId: "coinbase", Sequence: 42, Price: crypto.MustDecimal("1.5"), BidSize: crypto.MustDecimal("0.25"), Raw: []byte(`{"type":"ticker"}`)}
+	c, _ := New()
+	assert.NoError(t, c.Open("sqlite://"+filepath.ToSlash(path)))
+	defer c.Close()
+	assert.NoError(t, c.WriteTick(tick))
+	assert.NoError(t, c.Flush())
+
+	var exchange, price, bidSize, raw string
+	var receivedNanos, sequence int64
+	var tradeId sql.NullInt64
+	var size sql.NullString
+	assert.NoError(t, c.db.QueryRow("SELECT exchange, received, sequence, trade_id, price, size, bid_size, raw FROM Ticks;").
+		Scan(&exchange, &receivedNanos, &sequence, &tradeId, &price, &size, &bidSize, &raw))
+	assert.Equal(t, "coinbase", exchange)
+	assert.Equal(t, received.UnixNano(), receivedNanos)
+	assert.Equal(t, int64(42), sequence)
+	assert.False(t, tradeId.Valid)
+	assert.Equal(t, "1.5", price)
+	assert.False(t, size.Valid)
+	assert.Equal(t, "0.25", bidSize)
+	assert.Equal(t, `{"type":"ticker"}`, raw)
+}
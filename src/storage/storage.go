@@ -3,13 +3,10 @@ package storage
 import (
 	"fmt"
 	"github.com/Sn0w1eo/crypto-fetcher/src/crypto"
-	"github.com/Sn0w1eo/crypto-fetcher/src/storage/mysql"
-)
-
-type Type int
-
-const (
-	MySQL Type = iota + 1
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
 )
 
 // Storage used like abstraction interface to manipulate with different storage providers
@@ -18,16 +15,105 @@ type Storage interface {
 	Open(dsn string) error
 	// WriteTick writes Ticker to storage
 	WriteTick(ticker crypto.Ticker) error
+	// WriteTrade writes crypto.Trade to storage
+	WriteTrade(trade crypto.Trade) error
+	// WriteCandle writes crypto.Candle to storage, candle of same pair, interval and time is replaced
+	WriteCandle(candle crypto.Candle) error
 	// Close closes current storage
 	Close() error
 }
 
-// Creates new storage based on Type. Returns error if Type not found
-func New(storageType Type) (Storage, error) {
-	switch storageType {
-	case MySQL:
-		return mysql.New()
-	default:
-		return nil, fmt.Errorf("storage not implemented yet")
+// Factory creates new Storage of registered type
+type Factory func() (Storage, error)
+
+var (
+	registryMu sync.RWMutex
+	// factories by lower case type, which is DSN scheme as well
+	registry = make(map[string]Factory)
+)
+
+// Register makes Storage available by type name, the name is used as scheme of URL-style DSN, e.g. mysql://
+// Storages invoke it in init, so package of storage should be imported for side effects
+// Panics if factory is nil or type has been registered twice
+func Register(name string, factory Factory) {
+	if factory == nil {
+		panic("storage: Register factory is nil for " + name)
+	}
+	key := strings.ToLower(name)
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[key]; dup {
+		panic("storage: Register called twice for " + key)
+	}
+	registry[key] = factory
+}
+
+// Returns sorted names of registered storage types
+func Types() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	types := make([]string, 0, len(registry))
+	for name := range registry {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Returns true if storage type is registered, case insensitive
+func Registered(name string) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	_, ok := registry[strings.ToLower(name)]
+	return ok
+}
+
+// Creates new storage by type name, case insensitive. Returns error if type isn't registered
+func New(name string) (Storage, error) {
+	registryMu.RLock()
+	factory, ok := registry[strings.ToLower(name)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("storage type not found: %s", name)
+	}
+	return factory()
+}
+
+// Returns lower case scheme of URL-style DSN, e.g. postgres for postgres://host/db
+// Returns empty string if DSN has no scheme, e.g. DSN of go-sql-driver/mysql
+func Scheme(dsn string) string {
+	i := strings.Index(dsn, "://")
+	if i <= 0 {
+		return ""
+	}
+	u, err := url.Parse(dsn[:i+3])
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme)
+}
+
+// Returns storage type by scheme of DSN, def if DSN has no scheme
+func TypeOf(dsn string, def string) string {
+	if scheme := Scheme(dsn); scheme != "" {
+		return scheme
+	}
+	return def
+}
+
+// Creates storage by scheme of DSN and opens it
+// Returns error if DSN has no scheme or scheme isn't registered
+func Open(dsn string) (Storage, error) {
+	scheme := Scheme(dsn)
+	if scheme == "" {
+		return nil, fmt.Errorf("DSN has no scheme, expected one of: %s", strings.Join(Types(), ", "))
+	}
+	st, err := New(scheme)
+	if err != nil {
+		return nil, err
+	}
+	if err = st.Open(dsn); err != nil {
+		return nil, err
 	}
+	return st, nil
 }